@@ -2,12 +2,18 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// +build go1.8
-
 package xorm
 
 import "context"
 
+// Context creates a session with the context, the context will be passed
+// to the driver when executing any query, exec or transaction on the session.
+func (engine *Engine) Context(ctx context.Context) *Session {
+	session := engine.NewSession()
+	session.isAutoClose = true
+	return session.Context(ctx)
+}
+
 // PingContext tests if database is alive
 func (engine *Engine) PingContext(ctx context.Context) error {
 	session := engine.NewSession()
@@ -15,12 +21,25 @@ func (engine *Engine) PingContext(ctx context.Context) error {
 	return session.PingContext(ctx)
 }
 
-// PingContext test if database is ok
+// Context sets the context on this session, all the following operations
+// will be cancelled when the context is done
+func (session *Session) Context(ctx context.Context) *Session {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	session.ctx = ctx
+	return session
+}
+
+// PingContext test if database is ok, the context is only used by the ping and
+// the context of the session is kept
 func (session *Session) PingContext(ctx context.Context) error {
 	if session.isAutoClose {
 		defer session.Close()
 	}
 
-	session.engine.logger.Infof("PING DATABASE %v", session.engine.DriverName())
-	return session.DB().PingContext(ctx)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return session.ping(ctx)
 }
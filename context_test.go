@@ -2,12 +2,12 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// +build go1.8
-
 package xorm
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -15,10 +15,49 @@ import (
 func TestPingContext(t *testing.T) {
 	assert.NoError(t, prepareEngine())
 
-	// TODO: Since EngineInterface should be compitable with old Go version, PingContext is not supported.
-	/*
-		ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
-		err := testEngine.PingContext(ctx)
-		assert.NoError(t, err)
-	*/
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := testEngine.PingContext(ctx)
+	assert.NoError(t, err)
+
+	// the context of the ping is not kept by the session
+	sess := testEngine.NewSession()
+	defer sess.Close()
+	canceled, cancelPing := context.WithCancel(context.Background())
+	cancelPing()
+	assert.Error(t, sess.PingContext(canceled))
+	assert.NoError(t, sess.Ping())
+}
+
+func TestContextCanceled(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+
+	type ContextQueryStruct struct {
+		Id   int64
+		Name string
+	}
+
+	assertSync(t, new(ContextQueryStruct))
+
+	_, err := testEngine.Context(context.Background()).Insert(&ContextQueryStruct{Name: "1"})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var records []ContextQueryStruct
+	err = testEngine.Context(ctx).Find(&records)
+	assert.Error(t, err)
+
+	_, err = testEngine.Context(ctx).Insert(&ContextQueryStruct{Name: "2"})
+	assert.Error(t, err)
+
+	sess := testEngine.NewSession()
+	defer sess.Close()
+	assert.Error(t, sess.Context(ctx).Begin())
+
+	cnt, err := testEngine.Count(new(ContextQueryStruct))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
 }
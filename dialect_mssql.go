@@ -7,8 +7,10 @@ package xorm
 import (
 	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-xorm/core"
 )
@@ -276,6 +278,11 @@ func (db *mssql) SupportInsertMany() bool {
 	return true
 }
 
+// SupportWindowFunc returns true since the window functions are supported
+func (db *mssql) SupportWindowFunc() bool {
+	return true
+}
+
 func (db *mssql) IsReserved(name string) bool {
 	_, ok := mssqlReservedWords[name]
 	return ok
@@ -536,10 +543,119 @@ func (db *mssql) ForUpdateSql(query string) string {
 	return query
 }
 
+// RowLockSql renders the row locking as the hints of the table, the shared locks
+// are kept until the end of the transaction by REPEATABLEREAD
+func (db *mssql) RowLockSql(lock *rowLock) (clause, tableHint string, err error) {
+	if len(lock.tables) > 0 {
+		return "", "", ErrLockNotSupported
+	}
+
+	var hints = []string{"UPDLOCK"}
+	if lock.share {
+		hints[0] = "REPEATABLEREAD"
+	}
+	if lock.noWait {
+		hints = append(hints, "NOWAIT")
+	} else if lock.skipLocked {
+		hints = append(hints, "READPAST")
+	}
+	return "", " WITH (" + strings.Join(hints, ", ") + ")", nil
+}
+
+// AdvisoryLockSql returns the sql of sp_getapplock, the lock is owned by the
+// session instead of the transaction
+func (db *mssql) AdvisoryLockSql(key string, timeout time.Duration) (string, []interface{}) {
+	var milliseconds int64 = -1
+	if timeout >= 0 {
+		milliseconds = ceilMilliseconds(timeout)
+	}
+	return "DECLARE @r int; EXEC @r = sp_getapplock @Resource = @p1, @LockMode = 'Exclusive', " +
+			"@LockOwner = 'Session', @LockTimeout = @p2; SELECT CASE WHEN @r >= 0 THEN 1 ELSE 0 END",
+		[]interface{}{advisoryLockName(key, 255), milliseconds}
+}
+
+// AdvisoryUnlockSql returns the sql of sp_releaseapplock
+func (db *mssql) AdvisoryUnlockSql(key string) (string, []interface{}) {
+	return "EXEC sp_releaseapplock @Resource = @p1, @LockOwner = 'Session'",
+		[]interface{}{advisoryLockName(key, 255)}
+}
+
 func (db *mssql) Filters() []core.Filter {
 	return []core.Filter{&core.IdFilter{}, &core.QuoteFilter{}}
 }
 
+func (db *mssql) SavePointSql(name string) string {
+	return "SAVE TRANSACTION " + name
+}
+
+// ReleaseSavePointSql returns empty since mssql has no way to release a savepoint,
+// it will be released when the outer transaction is committed.
+func (db *mssql) ReleaseSavePointSql(name string) string {
+	return ""
+}
+
+func (db *mssql) RollbackToSavePointSql(name string) string {
+	return "ROLLBACK TRANSACTION " + name
+}
+
+// IsRetryableError returns true when the transaction was chosen as a deadlock victim (1205)
+func (db *mssql) IsRetryableError(err error) bool {
+	return driverErrorField(err, "Number") == "1205"
+}
+
+// BatchLimits returns the limits of a batch insert, mssql allows at most 1000
+// rows in the VALUES and 2100 parameters in a statement
+func (db *mssql) BatchLimits() (maxRows, maxParams, maxBytes int) {
+	return 1000, 2100, 0
+}
+
+var (
+	mssqlConstraintPattern = regexp.MustCompile(`(?:constraint|index) ['"]([^'"]+)['"]`)
+	mssqlTablePattern      = regexp.MustCompile(`(?:object|table) ['"]([^'"]+)['"]`)
+	mssqlColumnPattern     = regexp.MustCompile(`column '([^']+)'`)
+)
+
+// TranslateError translates the errors of the mssql driver, the constraint, the table
+// and the column are parsed from the message since the driver only reports the number
+func (db *mssql) TranslateError(err error) *DBError {
+	var dbErr DBError
+	var message = driverErrorField(err, "Message")
+	switch driverErrorField(err, "Number") {
+	case "2601", "2627":
+		dbErr.Kind = UniqueViolation
+	case "547":
+		// 547 is also returned for check constraints
+		if !strings.Contains(message, "FOREIGN KEY") && !strings.Contains(message, "REFERENCE") {
+			return nil
+		}
+		dbErr.Kind = ForeignKeyViolation
+	case "515":
+		dbErr.Kind = NotNullViolation
+	case "1205":
+		dbErr.Kind = Deadlock
+		return &dbErr
+	default:
+		return nil
+	}
+
+	if m := mssqlConstraintPattern.FindStringSubmatch(message); m != nil {
+		dbErr.Constraint = m[1]
+	}
+	if dbErr.Kind == ForeignKeyViolation && !strings.Contains(message, "REFERENCE") {
+		// the inserted or updated row refers to a missing row, the referenced table
+		// and column are reported instead of the referencing ones
+		return &dbErr
+	}
+	if m := mssqlTablePattern.FindStringSubmatch(message); m != nil {
+		// the table is reported as database.schema.table or schema.table
+		dbErr.Table = m[1][strings.LastIndex(m[1], ".")+1:]
+	}
+	if m := mssqlColumnPattern.FindStringSubmatch(message); m != nil {
+		dbErr.Column = m[1]
+	}
+	return &dbErr
+}
+
 type odbcDriver struct {
 }
 
@@ -11,6 +11,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-xorm/core"
@@ -172,6 +173,12 @@ type mysql struct {
 	allowAllFiles     bool
 	allowOldPasswords bool
 	clientFoundRows   bool
+
+	packetOnce    sync.Once
+	maxPacketSize int
+
+	versionMutex  sync.Mutex
+	serverVersion string
 }
 
 func (db *mysql) Init(d *core.DB, uri *core.Uri, drivername, dataSourceName string) error {
@@ -491,6 +498,149 @@ func (db *mysql) Filters() []core.Filter {
 	return []core.Filter{&core.IdFilter{}}
 }
 
+func (db *mysql) SavePointSql(name string) string {
+	return "SAVEPOINT " + name
+}
+
+func (db *mysql) ReleaseSavePointSql(name string) string {
+	return "RELEASE SAVEPOINT " + name
+}
+
+func (db *mysql) RollbackToSavePointSql(name string) string {
+	return "ROLLBACK TO SAVEPOINT " + name
+}
+
+// IsRetryableError returns true when the transaction failed because of a
+// deadlock (1213) or a lock wait timeout (1205)
+func (db *mysql) IsRetryableError(err error) bool {
+	switch driverErrorField(err, "Number") {
+	case "1213", "1205":
+		return true
+	}
+	return false
+}
+
+var (
+	mysqlDuplicateKeyPattern = regexp.MustCompile("for key '([^']+)'")
+	mysqlForeignKeyPattern   = regexp.MustCompile("\\(`[^`]+`\\.`([^`]+)`, CONSTRAINT `([^`]+)` FOREIGN KEY \\(`([^`]+)`\\)")
+	mysqlColumnPattern       = regexp.MustCompile("(?:Column|Field) '([^']+)'")
+)
+
+// BatchLimits returns the limits of a batch insert, the size of a statement
+// is limited by max_allowed_packet
+func (db *mysql) BatchLimits() (maxRows, maxParams, maxBytes int) {
+	db.packetOnce.Do(func() {
+		// the default value of max_allowed_packet before mysql 8.0
+		db.maxPacketSize = 4 << 20
+		var size int
+		if err := db.DB().QueryRow("SELECT @@max_allowed_packet").Scan(&size); err == nil && size > 0 {
+			db.maxPacketSize = size
+		}
+	})
+	return 0, 65535, db.maxPacketSize
+}
+
+// version returns the version of the server, such as 8.0.32 or 10.6.12-MariaDB,
+// only the version queried successfully is cached so a failed query is retried
+// next time
+func (db *mysql) version() (string, error) {
+	db.versionMutex.Lock()
+	defer db.versionMutex.Unlock()
+	if db.serverVersion == "" {
+		if err := db.DB().QueryRow("SELECT VERSION()").Scan(&db.serverVersion); err != nil {
+			db.serverVersion = ""
+			return "", err
+		}
+	}
+	return db.serverVersion, nil
+}
+
+// supportLockOptions returns true if FOR SHARE, NOWAIT, SKIP LOCKED and OF are
+// supported, they are added by mysql 8.0 and not all of them by mariadb
+func (db *mysql) supportLockOptions() (bool, error) {
+	version, err := db.version()
+	if err != nil {
+		return false, err
+	}
+	if strings.Contains(version, "MariaDB") {
+		return false, nil
+	}
+	var major int
+	fmt.Sscanf(version, "%d", &major)
+	return major >= 8, nil
+}
+
+// RowLockSql renders the row locking, the shared lock without the options is
+// LOCK IN SHARE MODE which is supported before mysql 8.0, and the options are
+// not supported before mysql 8.0
+func (db *mysql) RowLockSql(lock *rowLock) (clause, tableHint string, err error) {
+	if lock.share && !lock.noWait && !lock.skipLocked && len(lock.tables) == 0 {
+		return " LOCK IN SHARE MODE", "", nil
+	}
+	if lock.share || lock.noWait || lock.skipLocked || len(lock.tables) > 0 {
+		supported, err := db.supportLockOptions()
+		if err != nil {
+			return "", "", err
+		}
+		if !supported {
+			return "", "", ErrLockNotSupported
+		}
+	}
+	return lock.clause(db.Quote, "FOR SHARE"), "", nil
+}
+
+// AdvisoryLockSql returns the sql of GET_LOCK, the name of a lock is at most 64
+// characters so a longer key is hashed
+func (db *mysql) AdvisoryLockSql(key string, timeout time.Duration) (string, []interface{}) {
+	var seconds int64 = -1
+	if timeout >= 0 {
+		seconds = (ceilMilliseconds(timeout) + 999) / 1000
+	}
+	return "SELECT GET_LOCK(?, ?)", []interface{}{advisoryLockName(key, 64), seconds}
+}
+
+// AdvisoryUnlockSql returns the sql of RELEASE_LOCK
+func (db *mysql) AdvisoryUnlockSql(key string) (string, []interface{}) {
+	return "SELECT RELEASE_LOCK(?)", []interface{}{advisoryLockName(key, 64)}
+}
+
+// TranslateError translates the errors of the mysql driver, the table and the
+// column are parsed from the message since the driver only reports the number
+func (db *mysql) TranslateError(err error) *DBError {
+	var dbErr DBError
+	var message = driverErrorField(err, "Message")
+	switch driverErrorField(err, "Number") {
+	case "1062", "1586":
+		dbErr.Kind = UniqueViolation
+		if m := mysqlDuplicateKeyPattern.FindStringSubmatch(message); m != nil {
+			// mysql 8.0 reports the key name as table.key
+			if idx := strings.LastIndex(m[1], "."); idx > -1 {
+				dbErr.Table = m[1][:idx]
+				dbErr.Constraint = m[1][idx+1:]
+			} else {
+				dbErr.Constraint = m[1]
+			}
+		}
+	case "1216", "1217", "1451", "1452":
+		dbErr.Kind = ForeignKeyViolation
+		if m := mysqlForeignKeyPattern.FindStringSubmatch(message); m != nil {
+			dbErr.Table = m[1]
+			dbErr.Constraint = m[2]
+			dbErr.Column = m[3]
+		}
+	case "1048", "1364":
+		dbErr.Kind = NotNullViolation
+		if m := mysqlColumnPattern.FindStringSubmatch(message); m != nil {
+			dbErr.Column = m[1]
+		}
+	case "1213":
+		dbErr.Kind = Deadlock
+	default:
+		return nil
+	}
+	return &dbErr
+}
+
 type mymysqlDriver struct {
 }
 
@@ -546,6 +546,11 @@ func (db *oracle) SupportInsertMany() bool {
 	return true
 }
 
+// SupportWindowFunc returns true since the window functions are supported
+func (db *oracle) SupportWindowFunc() bool {
+	return true
+}
+
 func (db *oracle) IsReserved(name string) bool {
 	_, ok := oracleReservedWords[name]
 	return ok
@@ -854,6 +859,77 @@ func (db *oracle) Filters() []core.Filter {
 	return []core.Filter{&core.QuoteFilter{}, &core.SeqFilter{Prefix: ":", Start: 1}, &core.IdFilter{}}
 }
 
+func (db *oracle) SavePointSql(name string) string {
+	return "SAVEPOINT " + name
+}
+
+// ReleaseSavePointSql returns empty since oracle has no RELEASE SAVEPOINT statement
+func (db *oracle) ReleaseSavePointSql(name string) string {
+	return ""
+}
+
+func (db *oracle) RollbackToSavePointSql(name string) string {
+	return "ROLLBACK TO SAVEPOINT " + name
+}
+
+func (db *oracle) BatchLimits() (maxRows, maxParams, maxBytes int) {
+	return 0, 65535, 0
+}
+
+// RowLockSql renders the row locking, oracle has no shared row lock and FOR
+// UPDATE OF takes the columns instead of the tables
+func (db *oracle) RowLockSql(lock *rowLock) (clause, tableHint string, err error) {
+	if lock.share || len(lock.tables) > 0 {
+		return "", "", ErrLockNotSupported
+	}
+	return lock.clause(db.Quote, ""), "", nil
+}
+
+var (
+	oracleErrorPattern      = regexp.MustCompile(`ORA-(\d{5})`)
+	oracleConstraintPattern = regexp.MustCompile(`constraint \(([^)]+)\)`)
+	oracleColumnPattern     = regexp.MustCompile(`\(("[^"]+"(?:\."[^"]+")*)\)`)
+)
+
+// TranslateError translates the errors of the oracle drivers by the ORA code in the message
+func (db *oracle) TranslateError(err error) *DBError {
+	var message = err.Error()
+	m := oracleErrorPattern.FindStringSubmatch(message)
+	if m == nil {
+		return nil
+	}
+
+	var dbErr DBError
+	switch m[1] {
+	case "00001":
+		dbErr.Kind = UniqueViolation
+	case "02291", "02292":
+		dbErr.Kind = ForeignKeyViolation
+	case "01400", "01407":
+		dbErr.Kind = NotNullViolation
+		// the column is reported as ("SCHEMA"."TABLE"."COLUMN")
+		if m := oracleColumnPattern.FindStringSubmatch(message); m != nil {
+			names := strings.Split(strings.Replace(m[1], `"`, "", -1), ".")
+			if len(names) >= 2 {
+				dbErr.Table = names[len(names)-2]
+			}
+			dbErr.Column = names[len(names)-1]
+		}
+		return &dbErr
+	case "00060":
+		dbErr.Kind = Deadlock
+		return &dbErr
+	default:
+		return nil
+	}
+
+	// the constraint is reported as (SCHEMA.CONSTRAINT)
+	if m := oracleConstraintPattern.FindStringSubmatch(message); m != nil {
+		dbErr.Constraint = m[1][strings.LastIndex(m[1], ".")+1:]
+	}
+	return &dbErr
+}
+
 type goracleDriver struct {
 }
 
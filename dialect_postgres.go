@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-xorm/core"
 )
@@ -766,6 +767,9 @@ var (
 	}
 )
 
+// postgresPublicSchema is the default schema of postgres
+const postgresPublicSchema = "public"
+
 type postgres struct {
 	core.Base
 }
@@ -774,6 +778,23 @@ func (db *postgres) Init(d *core.DB, uri *core.Uri, drivername, dataSourceName s
 	return db.Base.Init(d, db, uri, drivername, dataSourceName)
 }
 
+// getSchema returns the schema set by Engine.SetSchema or the DSN, public by default
+func (db *postgres) getSchema() string {
+	if db.URI() != nil && db.URI().Schema != "" {
+		return db.URI().Schema
+	}
+	return postgresPublicSchema
+}
+
+// splitTableName returns the schema and the name of the table, the default
+// schema is returned if the table name is not qualified by a schema
+func (db *postgres) splitTableName(tableName string) (string, string) {
+	if idx := strings.LastIndex(tableName, "."); idx > 0 {
+		return tableName[:idx], tableName[idx+1:]
+	}
+	return db.getSchema(), tableName
+}
+
 func (db *postgres) SqlType(c *core.Column) string {
 	var res string
 	switch t := c.SQLType.Name; t {
@@ -837,6 +858,11 @@ func (db *postgres) SupportInsertMany() bool {
 	return true
 }
 
+// SupportWindowFunc returns true since the window functions are supported
+func (db *postgres) SupportWindowFunc() bool {
+	return true
+}
+
 func (db *postgres) IsReserved(name string) bool {
 	_, ok := postgresReservedWords[name]
 	return ok
@@ -868,14 +894,16 @@ func (db *postgres) IndexOnTable() bool {
 }
 
 func (db *postgres) IndexCheckSql(tableName, idxName string) (string, []interface{}) {
-	args := []interface{}{tableName, idxName}
+	schema, tableName := db.splitTableName(tableName)
+	args := []interface{}{schema, tableName, idxName}
 	return `SELECT indexname FROM pg_indexes ` +
-		`WHERE tablename = ? AND indexname = ?`, args
+		`WHERE schemaname = ? AND tablename = ? AND indexname = ?`, args
 }
 
 func (db *postgres) TableCheckSql(tableName string) (string, []interface{}) {
-	args := []interface{}{tableName}
-	return `SELECT tablename FROM pg_tables WHERE tablename = ?`, args
+	schema, tableName := db.splitTableName(tableName)
+	args := []interface{}{schema, tableName}
+	return `SELECT tablename FROM pg_tables WHERE schemaname = ? AND tablename = ?`, args
 }
 
 /*func (db *postgres) ColumnCheckSql(tableName, colName string) (string, []interface{}) {
@@ -889,10 +917,23 @@ func (db *postgres) ModifyColumnSql(tableName string, col *core.Column) string {
 		tableName, col.Name, db.SqlType(col))
 }
 
+func (db *postgres) CreateIndexSql(tableName string, index *core.Index) string {
+	var unique string
+	if index.Type == core.UniqueType {
+		unique = " UNIQUE"
+	}
+	// the index is always created in the schema of the table
+	_, name := db.splitTableName(tableName)
+	return fmt.Sprintf("CREATE%s INDEX %v ON %v (%v)", unique,
+		db.Quote(index.XName(name)), db.Quote(tableName),
+		db.Quote(strings.Join(index.Cols, db.Quote(","))))
+}
+
 func (db *postgres) DropIndexSql(tableName string, index *core.Index) string {
 	//var unique string
 	quote := db.Quote
 	idxName := index.Name
+	schema, tableName := db.splitTableName(tableName)
 
 	if !strings.HasPrefix(idxName, "UQE_") &&
 		!strings.HasPrefix(idxName, "IDX_") {
@@ -902,13 +943,14 @@ func (db *postgres) DropIndexSql(tableName string, index *core.Index) string {
 			idxName = fmt.Sprintf("IDX_%v_%v", tableName, index.Name)
 		}
 	}
-	return fmt.Sprintf("DROP INDEX %v", quote(idxName))
+	return fmt.Sprintf("DROP INDEX %v", quote(schema+"."+idxName))
 }
 
 func (db *postgres) IsColumnExist(tableName, colName string) (bool, error) {
-	args := []interface{}{tableName, colName}
-	query := "SELECT column_name FROM INFORMATION_SCHEMA.COLUMNS WHERE table_name = $1" +
-		" AND column_name = $2"
+	schema, tableName := db.splitTableName(tableName)
+	args := []interface{}{schema, tableName, colName}
+	query := "SELECT column_name FROM INFORMATION_SCHEMA.COLUMNS WHERE table_schema = $1" +
+		" AND table_name = $2 AND column_name = $3"
 	db.LogSQL(query, args)
 
 	rows, err := db.DB().Query(query, args...)
@@ -921,8 +963,8 @@ func (db *postgres) IsColumnExist(tableName, colName string) (bool, error) {
 }
 
 func (db *postgres) GetColumns(tableName string) ([]string, map[string]*core.Column, error) {
-	// FIXME: the schema should be replaced by user custom's
-	args := []interface{}{tableName, "public"}
+	schema, tableName := db.splitTableName(tableName)
+	args := []interface{}{tableName, schema}
 	s := `SELECT column_name, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_precision_radix ,
     CASE WHEN p.contype = 'p' THEN true ELSE false END AS primarykey,
     CASE WHEN p.contype = 'u' THEN true ELSE false END AS uniquekey
@@ -933,7 +975,7 @@ FROM pg_attribute f
     LEFT JOIN pg_constraint p ON p.conrelid = c.oid AND f.attnum = ANY (p.conkey)
     LEFT JOIN pg_class AS g ON p.confrelid = g.oid
     LEFT JOIN INFORMATION_SCHEMA.COLUMNS s ON s.column_name=f.attname AND c.relname=s.table_name
-WHERE c.relkind = 'r'::char AND c.relname = $1 AND s.table_schema = $2 AND f.attnum > 0 ORDER BY f.attnum;`
+WHERE c.relkind = 'r'::char AND c.relname = $1 AND s.table_schema = $2 AND n.nspname = $2 AND f.attnum > 0 ORDER BY f.attnum;`
 	db.LogSQL(s, args)
 
 	rows, err := db.DB().Query(s, args...)
@@ -1023,8 +1065,12 @@ WHERE c.relkind = 'r'::char AND c.relname = $1 AND s.table_schema = $2 AND f.att
 }
 
 func (db *postgres) GetTables() ([]*core.Table, error) {
-	// FIXME: replace public to user customrize schema
-	args := []interface{}{"public"}
+	return db.GetSchemaTables(db.getSchema())
+}
+
+// GetSchemaTables returns the tables of the schema
+func (db *postgres) GetSchemaTables(schema string) ([]*core.Table, error) {
+	args := []interface{}{schema}
 	s := fmt.Sprintf("SELECT tablename FROM pg_tables WHERE schemaname = $1")
 	db.LogSQL(s, args)
 
@@ -1049,8 +1095,8 @@ func (db *postgres) GetTables() ([]*core.Table, error) {
 }
 
 func (db *postgres) GetIndexes(tableName string) (map[string]*core.Index, error) {
-	// FIXME: replace the public schema to user specify schema
-	args := []interface{}{"public", tableName}
+	schema, tableName := db.splitTableName(tableName)
+	args := []interface{}{schema, tableName}
 	s := fmt.Sprintf("SELECT indexname, indexdef FROM pg_indexes WHERE schemaname=$1 AND tablename=$2")
 	db.LogSQL(s, args)
 
@@ -1103,6 +1149,79 @@ func (db *postgres) Filters() []core.Filter {
 	return []core.Filter{&core.IdFilter{}, &core.QuoteFilter{}, &core.SeqFilter{Prefix: "$", Start: 1}}
 }
 
+func (db *postgres) SavePointSql(name string) string {
+	return "SAVEPOINT " + name
+}
+
+func (db *postgres) ReleaseSavePointSql(name string) string {
+	return "RELEASE SAVEPOINT " + name
+}
+
+func (db *postgres) RollbackToSavePointSql(name string) string {
+	return "ROLLBACK TO SAVEPOINT " + name
+}
+
+// IsRetryableError returns true when the transaction failed because of a
+// serialization failure (40001) or a deadlock (40P01)
+func (db *postgres) IsRetryableError(err error) bool {
+	switch driverErrorField(err, "Code") {
+	case "40001", "40P01":
+		return true
+	}
+	return false
+}
+
+func (db *postgres) BatchLimits() (maxRows, maxParams, maxBytes int) {
+	return 0, 65535, 0
+}
+
+// RowLockSql renders the row locking by FOR UPDATE or FOR SHARE
+func (db *postgres) RowLockSql(lock *rowLock) (clause, tableHint string, err error) {
+	return lock.clause(db.Quote, "FOR SHARE"), "", nil
+}
+
+// AdvisoryLockSql returns the sql of pg_advisory_lock, the key is hashed to the
+// bigint id of the lock. The timeout is set to lock_timeout of the statement,
+// which is reset after the statement since it's local to the transaction.
+func (db *postgres) AdvisoryLockSql(key string, timeout time.Duration) (string, []interface{}) {
+	var id = advisoryLockID(key)
+	if timeout == 0 {
+		return fmt.Sprintf("SELECT CASE WHEN pg_try_advisory_lock(%d) THEN 1 ELSE 0 END", id), nil
+	}
+	if timeout < 0 {
+		return fmt.Sprintf("SELECT 1 FROM pg_advisory_lock(%d)", id), nil
+	}
+	// the subquery setting the timeout is fenced by OFFSET 0 to run before the lock
+	return fmt.Sprintf("SELECT (SELECT 1 FROM pg_advisory_lock(%d)) FROM "+
+		"(SELECT set_config('lock_timeout', '%dms', true) OFFSET 0) AS t", id, ceilMilliseconds(timeout)), nil
+}
+
+// AdvisoryUnlockSql returns the sql of pg_advisory_unlock
+func (db *postgres) AdvisoryUnlockSql(key string) (string, []interface{}) {
+	return fmt.Sprintf("SELECT pg_advisory_unlock(%d)", advisoryLockID(key)), nil
+}
+
+// TranslateError translates the errors of the pq driver by the sqlstate
+func (db *postgres) TranslateError(err error) *DBError {
+	var dbErr DBError
+	switch driverErrorField(err, "Code") {
+	case "23505":
+		dbErr.Kind = UniqueViolation
+	case "23503":
+		dbErr.Kind = ForeignKeyViolation
+	case "23502":
+		dbErr.Kind = NotNullViolation
+	case "40P01":
+		dbErr.Kind = Deadlock
+	default:
+		return nil
+	}
+	dbErr.Constraint = driverErrorField(err, "Constraint")
+	dbErr.Table = driverErrorField(err, "Table")
+	dbErr.Column = driverErrorField(err, "Column")
+	return &dbErr
+}
+
 type pqDriver struct {
 }
 
@@ -1116,23 +1235,28 @@ func (vs values) Get(k string) (v string) {
 	return vs[k]
 }
 
-func parseURL(connstr string) (string, error) {
+func parseURL(connstr string, o values) error {
 	u, err := url.Parse(connstr)
 	if err != nil {
-		return "", err
+		return err
 	}
 
 	if u.Scheme != "postgresql" && u.Scheme != "postgres" {
-		return "", fmt.Errorf("invalid connection protocol: %s", u.Scheme)
+		return fmt.Errorf("invalid connection protocol: %s", u.Scheme)
 	}
 
 	escaper := strings.NewReplacer(` `, `\ `, `'`, `\'`, `\`, `\\`)
 
-	if u.Path != "" {
-		return escaper.Replace(u.Path[1:]), nil
+	for k, vs := range u.Query() {
+		if len(vs) > 0 {
+			o.Set(k, vs[0])
+		}
 	}
 
-	return "", nil
+	if u.Path != "" {
+		o.Set("dbname", escaper.Replace(u.Path[1:]))
+	}
+	return nil
 }
 
 func parseOpts(name string, o values) error {
@@ -1156,26 +1280,27 @@ func parseOpts(name string, o values) error {
 
 func (p *pqDriver) Parse(driverName, dataSourceName string) (*core.Uri, error) {
 	db := &core.Uri{DbType: core.POSTGRES}
+	o := make(values)
 	var err error
 
 	if strings.HasPrefix(dataSourceName, "postgresql://") || strings.HasPrefix(dataSourceName, "postgres://") {
-		db.DbName, err = parseURL(dataSourceName)
-		if err != nil {
-			return nil, err
-		}
+		err = parseURL(dataSourceName, o)
 	} else {
-		o := make(values)
 		err = parseOpts(dataSourceName, o)
-		if err != nil {
-			return nil, err
-		}
-
-		db.DbName = o.Get("dbname")
+	}
+	if err != nil {
+		return nil, err
 	}
 
+	db.DbName = o.Get("dbname")
 	if db.DbName == "" {
 		return nil, errors.New("dbname is empty")
 	}
 
+	// the first schema of the search_path is used as the default schema
+	if searchPath := o.Get("search_path"); searchPath != "" {
+		db.Schema = strings.TrimSpace(strings.Split(searchPath, ",")[0])
+	}
+
 	return db, nil
 }
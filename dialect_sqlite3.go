@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/go-xorm/core"
 )
@@ -145,6 +146,9 @@ var (
 
 type sqlite3 struct {
 	core.Base
+
+	returningOnce    sync.Once
+	supportReturning bool
 }
 
 func (db *sqlite3) Init(d *core.DB, uri *core.Uri, drivername, dataSourceName string) error {
@@ -252,6 +256,15 @@ func (db *sqlite3) ForUpdateSql(query string) string {
 	return query
 }
 
+// RowLockSql renders nothing since sqlite locks the whole database, the locked
+// rows could not be skipped or fail without waiting
+func (db *sqlite3) RowLockSql(lock *rowLock) (clause, tableHint string, err error) {
+	if lock.noWait || lock.skipLocked {
+		return "", "", ErrLockNotSupported
+	}
+	return "", "", nil
+}
+
 /*func (db *sqlite3) ColumnCheckSql(tableName, colName string) (string, []interface{}) {
 	args := []interface{}{tableName}
 	sql := "SELECT name FROM sqlite_master WHERE type='table' and name = ? and ((sql like '%`" + colName + "`%') or (sql like '%[" + colName + "]%'))"
@@ -448,6 +461,72 @@ func (db *sqlite3) Filters() []core.Filter {
 	return []core.Filter{&core.IdFilter{}}
 }
 
+func (db *sqlite3) SavePointSql(name string) string {
+	return "SAVEPOINT " + name
+}
+
+func (db *sqlite3) ReleaseSavePointSql(name string) string {
+	return "RELEASE SAVEPOINT " + name
+}
+
+func (db *sqlite3) RollbackToSavePointSql(name string) string {
+	return "ROLLBACK TO SAVEPOINT " + name
+}
+
+// BatchLimits returns the limits of a batch insert, the max number of the
+// parameters is 999 before sqlite 3.32.0
+func (db *sqlite3) BatchLimits() (maxRows, maxParams, maxBytes int) {
+	return 0, 999, 0
+}
+
+// SupportReturning returns true if the sqlite version is 3.35.0 or later
+func (db *sqlite3) SupportReturning() bool {
+	db.returningOnce.Do(func() {
+		var version string
+		if err := db.DB().QueryRow("SELECT sqlite_version()").Scan(&version); err != nil {
+			return
+		}
+		var major, minor int
+		fmt.Sscanf(version, "%d.%d", &major, &minor)
+		db.supportReturning = major > 3 || (major == 3 && minor >= 35)
+	})
+	return db.supportReturning
+}
+
+// TranslateError translates the constraint errors of the sqlite3 driver, sqlite
+// only reports the table and the columns in the message but not the constraint name
+func (db *sqlite3) TranslateError(err error) *DBError {
+	// SQLITE_CONSTRAINT
+	if driverErrorField(err, "Code") != "19" {
+		return nil
+	}
+
+	var dbErr DBError
+	var message = err.Error()
+	switch {
+	case strings.HasPrefix(message, "UNIQUE constraint failed:"):
+		dbErr.Kind = UniqueViolation
+	case strings.HasPrefix(message, "FOREIGN KEY constraint failed"):
+		dbErr.Kind = ForeignKeyViolation
+		return &dbErr
+	case strings.HasPrefix(message, "NOT NULL constraint failed:"):
+		dbErr.Kind = NotNullViolation
+	default:
+		return nil
+	}
+
+	var columns []string
+	for _, name := range strings.Split(message[strings.Index(message, ":")+1:], ",") {
+		fields := strings.SplitN(strings.TrimSpace(name), ".", 2)
+		if len(fields) == 2 {
+			dbErr.Table = fields[0]
+			columns = append(columns, fields[1])
+		}
+	}
+	dbErr.Column = strings.Join(columns, ",")
+	return &dbErr
+}
+
 type sqlite3Driver struct {
 }
 
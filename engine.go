@@ -48,6 +48,23 @@ type Engine struct {
 
 	tagHandlers map[string]tagHandler
 
+	// the has_many and many_to_many relations of the tables, which could not
+	// be kept by core.Table
+	relations     map[reflect.Type][]*relation
+	relationMutex sync.RWMutex
+
+	// the aggregates of the result structs of Aggregate
+	aggregates     map[reflect.Type][]*aggregate
+	aggregateMutex sync.RWMutex
+
+	cursorKey []byte // the key signing the cursors of pagination
+
+	leaseMutex sync.Mutex // serializes the creation of the lock table
+
+	// the listeners of the notifications, they are closed with the engine
+	listeners     []*Listener
+	listenerMutex sync.Mutex
+
 	engineGroup *EngineGroup
 }
 
@@ -58,6 +75,49 @@ func (engine *Engine) BufferSize(size int) *Session {
 	return session.BufferSize(size)
 }
 
+// Preload loads the referenced struct fields of Find and Iterate in batches
+func (engine *Engine) Preload(fieldNames ...string) *Session {
+	session := engine.NewSession()
+	session.isAutoClose = true
+	return session.Preload(fieldNames...)
+}
+
+// Paginate makes Find return at most size records with the keyset pagination
+func (engine *Engine) Paginate(size int) *Session {
+	session := engine.NewSession()
+	session.isAutoClose = true
+	return session.Paginate(size)
+}
+
+// AfterCursor makes the paginated Find return the page after the cursor
+func (engine *Engine) AfterCursor(cursor string) *Session {
+	session := engine.NewSession()
+	session.isAutoClose = true
+	return session.AfterCursor(cursor)
+}
+
+// BeforeCursor makes the paginated Find return the page before the cursor
+func (engine *Engine) BeforeCursor(cursor string) *Session {
+	session := engine.NewSession()
+	session.isAutoClose = true
+	return session.BeforeCursor(cursor)
+}
+
+// CascadeRelations makes Insert and Delete cascade through the has_many and
+// many_to_many relations
+func (engine *Engine) CascadeRelations(trueOrFalse ...bool) *Session {
+	session := engine.NewSession()
+	session.isAutoClose = true
+	return session.CascadeRelations(trueOrFalse...)
+}
+
+// BatchSize sets the max number of the records inserted by one statement
+func (engine *Engine) BatchSize(size int) *Session {
+	session := engine.NewSession()
+	session.isAutoClose = true
+	return session.BatchSize(size)
+}
+
 // CondDeleted returns the conditions whether a record is soft deleted.
 func (engine *Engine) CondDeleted(colName string) builder.Cond {
 	if engine.dialect.DBType() == core.MSSQL {
@@ -118,6 +178,24 @@ func (engine *Engine) DataSourceName() string {
 	return engine.dialect.DataSourceName()
 }
 
+// SetSchema sets the schema of the tables, it's only used on postgres and the
+// table names will be qualified by the schema if it's not public. The schema
+// could also be set by the search_path of the DSN.
+func (engine *Engine) SetSchema(schema string) {
+	engine.dialect.URI().Schema = schema
+}
+
+// tbNameWithSchema qualifies the table name by the schema of the engine
+func (engine *Engine) tbNameWithSchema(v string) string {
+	if engine.dialect.DBType() != core.POSTGRES || v == "" || strings.Contains(v, ".") {
+		return v
+	}
+	if schema := engine.dialect.URI().Schema; schema != "" && schema != postgresPublicSchema {
+		return schema + "." + v
+	}
+	return v
+}
+
 // SetMapper set the name mapping rules
 func (engine *Engine) SetMapper(mapper core.IMapper) {
 	engine.SetTableMapper(mapper)
@@ -279,6 +357,7 @@ func (engine *Engine) NewSession() *Session {
 
 // Close the engine
 func (engine *Engine) Close() error {
+	engine.closeListeners()
 	return engine.db.Close()
 }
 
@@ -338,20 +417,44 @@ func (engine *Engine) NoAutoCondition(no ...bool) *Session {
 
 // DBMetas Retrieve all tables, columns, indexes' informations from database.
 func (engine *Engine) DBMetas() ([]*core.Table, error) {
-	tables, err := engine.dialect.GetTables()
+	return engine.dbMetas("")
+}
+
+// schemaDialect is implemented by the dialects which could list the tables of
+// any schema but not only the default one
+type schemaDialect interface {
+	GetSchemaTables(schema string) ([]*core.Table, error)
+}
+
+// dbMetas retrieves the tables of the schema, the tables of the default schema
+// will be retrieved if the schema is empty
+func (engine *Engine) dbMetas(schema string) ([]*core.Table, error) {
+	var tables []*core.Table
+	var err error
+	if schema == "" {
+		tables, err = engine.dialect.GetTables()
+	} else if dialect, ok := engine.dialect.(schemaDialect); ok {
+		tables, err = dialect.GetSchemaTables(schema)
+	} else {
+		return nil, fmt.Errorf("listing the tables of schema %s is not supported by %v", schema, engine.dialect.DBType())
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	for _, table := range tables {
-		colSeq, cols, err := engine.dialect.GetColumns(table.Name)
+		var tableName = table.Name
+		if schema != "" {
+			tableName = schema + "." + table.Name
+		}
+		colSeq, cols, err := engine.dialect.GetColumns(tableName)
 		if err != nil {
 			return nil, err
 		}
 		for _, name := range colSeq {
 			table.AddColumn(cols[name])
 		}
-		indexes, err := engine.dialect.GetIndexes(table.Name)
+		indexes, err := engine.dialect.GetIndexes(tableName)
 		if err != nil {
 			return nil, err
 		}
@@ -433,12 +536,18 @@ func (engine *Engine) dumpTables(tables []*core.Table, w io.Writer, tp ...core.D
 				return err
 			}
 		}
-		_, err = io.WriteString(w, dialect.CreateTableSql(table, "", table.StoreEngine, "")+";\n")
+		// the tables are qualified by the schema only if both databases are postgres
+		var dstTableName = table.Name
+		if dialect.DBType() == core.POSTGRES {
+			dstTableName = engine.tbNameWithSchema(table.Name)
+		}
+
+		_, err = io.WriteString(w, dialect.CreateTableSql(table, dstTableName, table.StoreEngine, "")+";\n")
 		if err != nil {
 			return err
 		}
 		for _, index := range table.Indexes {
-			_, err = io.WriteString(w, dialect.CreateIndexSql(table.Name, index)+";\n")
+			_, err = io.WriteString(w, dialect.CreateIndexSql(dstTableName, index)+";\n")
 			if err != nil {
 				return err
 			}
@@ -447,7 +556,7 @@ func (engine *Engine) dumpTables(tables []*core.Table, w io.Writer, tp ...core.D
 		cols := table.ColumnsSeq()
 		colNames := dialect.Quote(strings.Join(cols, dialect.Quote(", ")))
 
-		rows, err := engine.DB().Query("SELECT " + colNames + " FROM " + engine.Quote(table.Name))
+		rows, err := engine.DB().Query("SELECT " + colNames + " FROM " + engine.Quote(engine.tbNameWithSchema(table.Name)))
 		if err != nil {
 			return err
 		}
@@ -460,7 +569,7 @@ func (engine *Engine) dumpTables(tables []*core.Table, w io.Writer, tp ...core.D
 				return err
 			}
 
-			_, err = io.WriteString(w, "INSERT INTO "+dialect.Quote(table.Name)+" ("+colNames+") VALUES (")
+			_, err = io.WriteString(w, "INSERT INTO "+dialect.Quote(dstTableName)+" ("+colNames+") VALUES (")
 			if err != nil {
 				return err
 			}
@@ -527,7 +636,7 @@ func (engine *Engine) dumpTables(tables []*core.Table, w io.Writer, tp ...core.D
 
 		// FIXME: Hack for postgres
 		if string(dialect.DBType()) == core.POSTGRES && table.AutoIncrColumn() != nil {
-			_, err = io.WriteString(w, "SELECT setval('table_id_seq', COALESCE((SELECT MAX("+table.AutoIncrColumn().Name+") FROM "+dialect.Quote(table.Name)+"), 1), false);\n")
+			_, err = io.WriteString(w, "SELECT setval('table_id_seq', COALESCE((SELECT MAX("+table.AutoIncrColumn().Name+") FROM "+dialect.Quote(dstTableName)+"), 1), false);\n")
 			if err != nil {
 				return err
 			}
@@ -536,16 +645,6 @@ func (engine *Engine) dumpTables(tables []*core.Table, w io.Writer, tp ...core.D
 	return nil
 }
 
-func (engine *Engine) tableName(beanOrTableName interface{}) (string, error) {
-	v := rValue(beanOrTableName)
-	if v.Type().Kind() == reflect.String {
-		return beanOrTableName.(string), nil
-	} else if v.Type().Kind() == reflect.Struct {
-		return engine.tbName(v), nil
-	}
-	return "", errors.New("bean should be a struct or struct's point")
-}
-
 func (engine *Engine) tbName(v reflect.Value) string {
 	if tb, ok := v.Interface().(TableName); ok {
 		return tb.TableName()
@@ -674,6 +773,20 @@ func (engine *Engine) Omit(columns ...string) *Session {
 	return session.Omit(columns...)
 }
 
+// OnConflict makes the following Insert update or ignore the conflicting records
+func (engine *Engine) OnConflict(columns ...string) *Session {
+	session := engine.NewSession()
+	session.isAutoClose = true
+	return session.OnConflict(columns...)
+}
+
+// Returning makes the following Insert, Update or Delete refresh the bean with the returned values
+func (engine *Engine) Returning(columns ...string) *Session {
+	session := engine.NewSession()
+	session.isAutoClose = true
+	return session.Returning(columns...)
+}
+
 // Nullable set null when column is zero-value and nullable for update
 func (engine *Engine) Nullable(columns ...string) *Session {
 	session := engine.NewSession()
@@ -695,6 +808,20 @@ func (engine *Engine) NotIn(column string, args ...interface{}) *Session {
 	return session.NotIn(column, args...)
 }
 
+// Exists will generate "EXISTS (SELECT ...)"
+func (engine *Engine) Exists(sub interface{}) *Session {
+	session := engine.NewSession()
+	session.isAutoClose = true
+	return session.Exists(sub)
+}
+
+// NotExists will generate "NOT EXISTS (SELECT ...)"
+func (engine *Engine) NotExists(sub interface{}) *Session {
+	session := engine.NewSession()
+	session.isAutoClose = true
+	return session.NotExists(sub)
+}
+
 // Incr provides a update string like "column = column + ?"
 func (engine *Engine) Incr(column string, arg ...interface{}) *Session {
 	session := engine.NewSession()
@@ -723,6 +850,48 @@ func (engine *Engine) Table(tableNameOrBean interface{}) *Session {
 	return session.Table(tableNameOrBean)
 }
 
+// From selects from the subquery with the alias instead of the table
+func (engine *Engine) From(sub interface{}, alias string) *Session {
+	session := engine.NewSession()
+	session.isAutoClose = true
+	return session.From(sub, alias)
+}
+
+// With prepends the subquery as a common table expression named name
+func (engine *Engine) With(name string, sub interface{}) *Session {
+	session := engine.NewSession()
+	session.isAutoClose = true
+	return session.With(name, sub)
+}
+
+// WithRecursive prepends a recursive common table expression named name
+func (engine *Engine) WithRecursive(name string, anchor, recursive interface{}) *Session {
+	session := engine.NewSession()
+	session.isAutoClose = true
+	return session.WithRecursive(name, anchor, recursive)
+}
+
+// Schema qualifies all the tables of the session by the schema
+func (engine *Engine) Schema(name string) *Session {
+	session := engine.NewSession()
+	session.isAutoClose = true
+	return session.Schema(name)
+}
+
+// UseMaster routes the statements to the master of the engine group
+func (engine *Engine) UseMaster() *Session {
+	session := engine.NewSession()
+	session.isAutoClose = true
+	return session.UseMaster()
+}
+
+// UseSlave routes the statements to the slave of the engine group
+func (engine *Engine) UseSlave(slave *Engine) *Session {
+	session := engine.NewSession()
+	session.isAutoClose = true
+	return session.UseSlave(slave)
+}
+
 // Alias set the table alias
 func (engine *Engine) Alias(alias string) *Session {
 	session := engine.NewSession()
@@ -899,6 +1068,8 @@ func (engine *Engine) mapType(v reflect.Value) (*core.Table, error) {
 
 	var idFieldColName string
 	var hasCacheTag, hasNoCacheTag bool
+	var relations []*relation
+	var aggregates []*aggregate
 
 	for i := 0; i < t.NumField(); i++ {
 		tag := t.Field(i).Tag
@@ -985,6 +1156,12 @@ func (engine *Engine) mapType(v reflect.Value) (*core.Table, error) {
 					}
 				}
 
+				if ctx.relation != nil {
+					// the relation is not a column of the table
+					relations = append(relations, ctx.relation)
+					continue
+				}
+
 				if col.SQLType.Name == "" {
 					col.SQLType = core.Type2SQLType(fieldType)
 				}
@@ -1008,6 +1185,11 @@ func (engine *Engine) mapType(v reflect.Value) (*core.Table, error) {
 				for indexName, indexType := range ctx.indexNames {
 					addIndex(indexName, table, col, indexType)
 				}
+
+				if ctx.aggregate != nil {
+					ctx.aggregate.column = col.Name
+					aggregates = append(aggregates, ctx.aggregate)
+				}
 			}
 		} else {
 			var sqlType core.SQLType
@@ -1037,6 +1219,9 @@ func (engine *Engine) mapType(v reflect.Value) (*core.Table, error) {
 
 	} // end for
 
+	engine.setRelations(t, relations)
+	engine.setAggregates(t, aggregates)
+
 	if idFieldColName != "" && len(table.PrimaryKeys) == 0 {
 		col := table.GetColumn(idFieldColName)
 		col.IsPrimaryKey = true
@@ -1173,7 +1358,7 @@ func (engine *Engine) ClearCacheBean(bean interface{}, id string) error {
 	if t.Kind() != reflect.Struct {
 		return errors.New("error params")
 	}
-	tableName := engine.tbName(v)
+	tableName := engine.tbNameWithSchema(engine.tbName(v))
 	table, err := engine.autoMapType(v)
 	if err != nil {
 		return err
@@ -1197,7 +1382,7 @@ func (engine *Engine) ClearCache(beans ...interface{}) error {
 		if t.Kind() != reflect.Struct {
 			return errors.New("error params")
 		}
-		tableName := engine.tbName(v)
+		tableName := engine.tbNameWithSchema(engine.tbName(v))
 		table, err := engine.autoMapType(v)
 		if err != nil {
 			return err
@@ -1224,7 +1409,7 @@ func (engine *Engine) Sync(beans ...interface{}) error {
 
 	for _, bean := range beans {
 		v := rValue(bean)
-		tableName := engine.tbName(v)
+		tableName := engine.tbNameWithSchema(engine.tbName(v))
 		table, err := engine.autoMapType(v)
 		if err != nil {
 			return err
@@ -1325,20 +1510,7 @@ func (engine *Engine) Sync2(beans ...interface{}) error {
 func (engine *Engine) CreateTables(beans ...interface{}) error {
 	session := engine.NewSession()
 	defer session.Close()
-
-	err := session.Begin()
-	if err != nil {
-		return err
-	}
-
-	for _, bean := range beans {
-		err = session.createTable(bean)
-		if err != nil {
-			session.Rollback()
-			return err
-		}
-	}
-	return session.Commit()
+	return session.CreateTables(beans...)
 }
 
 // DropTables drop specify tables
@@ -1410,6 +1582,13 @@ func (engine *Engine) InsertOne(bean interface{}) (int64, error) {
 	return session.InsertOne(bean)
 }
 
+// BulkCopy inserts the records of the slice by the bulk loading of the database
+func (engine *Engine) BulkCopy(rowsSlicePtr interface{}) (int64, error) {
+	session := engine.NewSession()
+	defer session.Close()
+	return session.BulkCopy(rowsSlicePtr)
+}
+
 // Update records, bean's non-empty fields are updated contents,
 // condiBean' non-empty filds are conditions
 // CAUTION:
@@ -1453,6 +1632,14 @@ func (engine *Engine) Find(beans interface{}, condiBeans ...interface{}) error {
 	return session.Find(beans, condiBeans...)
 }
 
+// FindAndCount finds the records and counts all the records matching the
+// conditions without the ordering and the pagination
+func (engine *Engine) FindAndCount(rowsSlicePtr interface{}, condiBean ...interface{}) (int64, error) {
+	session := engine.NewSession()
+	defer session.Close()
+	return session.FindAndCount(rowsSlicePtr, condiBean...)
+}
+
 // Iterate record by record handle records from table, bean's non-empty fields
 // are conditions.
 func (engine *Engine) Iterate(bean interface{}, fun IterFunc) error {
@@ -1475,6 +1662,42 @@ func (engine *Engine) Count(bean ...interface{}) (int64, error) {
 	return session.Count(bean...)
 }
 
+// CountDistinct counts the distinct values of the columns. bean's non-empty
+// fields are conditions.
+func (engine *Engine) CountDistinct(bean interface{}, colNames ...string) (int64, error) {
+	session := engine.NewSession()
+	defer session.Close()
+	return session.CountDistinct(bean, colNames...)
+}
+
+// Min finds the minimum of the column into res. bean's non-empty fields are conditions.
+func (engine *Engine) Min(bean interface{}, colName string, res interface{}) (bool, error) {
+	session := engine.NewSession()
+	defer session.Close()
+	return session.Min(bean, colName, res)
+}
+
+// Max finds the maximum of the column into res. bean's non-empty fields are conditions.
+func (engine *Engine) Max(bean interface{}, colName string, res interface{}) (bool, error) {
+	session := engine.NewSession()
+	defer session.Close()
+	return session.Max(bean, colName, res)
+}
+
+// Avg avg the records by some column. bean's non-empty fields are conditions.
+func (engine *Engine) Avg(bean interface{}, colName string) (float64, error) {
+	session := engine.NewSession()
+	defer session.Close()
+	return session.Avg(bean, colName)
+}
+
+// Aggregate finds the aggregates of the groups into the slice of the result structs
+func (engine *Engine) Aggregate(rowsSlicePtr interface{}) error {
+	session := engine.NewSession()
+	defer session.Close()
+	return session.Aggregate(rowsSlicePtr)
+}
+
 // Sum sum the records by some column. bean's non-empty fields are conditions.
 func (engine *Engine) Sum(bean interface{}, colName string) (float64, error) {
 	session := engine.NewSession()
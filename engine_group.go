@@ -5,6 +5,8 @@
 package xorm
 
 import (
+	"sync"
+
 	"github.com/go-xorm/core"
 )
 
@@ -13,6 +15,13 @@ type EngineGroup struct {
 	*Engine
 	slaves []*Engine
 	policy GroupPolicy
+	router GroupRouter
+
+	consistency *consistency
+
+	mutex   sync.RWMutex
+	health  *healthChecker
+	healthy []bool // whether the slaves at the same indices passed the health check
 }
 
 // NewEngineGroup creates a new engine group
@@ -58,13 +67,15 @@ func NewEngineGroup(args1 interface{}, args2 interface{}, policies ...GroupPolic
 
 // Close the engine
 func (eg *EngineGroup) Close() error {
+	eg.SetHealthCheck(0, 0, 0)
+
 	err := eg.Engine.Close()
 	if err != nil {
 		return err
 	}
 
-	for i := 0; i < len(eg.slaves); i++ {
-		err := eg.slaves[i].Close()
+	for _, slave := range eg.Slaves() {
+		err := slave.Close()
 		if err != nil {
 			return err
 		}
@@ -83,7 +94,7 @@ func (eg *EngineGroup) Ping() error {
 		return err
 	}
 
-	for _, slave := range eg.slaves {
+	for _, slave := range eg.Slaves() {
 		if err := slave.Ping(); err != nil {
 			return err
 		}
@@ -94,101 +105,221 @@ func (eg *EngineGroup) Ping() error {
 // SetColumnMapper set the column name mapping rule
 func (eg *EngineGroup) SetColumnMapper(mapper core.IMapper) {
 	eg.Engine.ColumnMapper = mapper
-	for i := 0; i < len(eg.slaves); i++ {
-		eg.slaves[i].ColumnMapper = mapper
+	for _, slave := range eg.Slaves() {
+		slave.ColumnMapper = mapper
 	}
 }
 
 // SetDefaultCacher set the default cacher
 func (eg *EngineGroup) SetDefaultCacher(cacher core.Cacher) {
 	eg.Engine.SetDefaultCacher(cacher)
-	for i := 0; i < len(eg.slaves); i++ {
-		eg.slaves[i].SetDefaultCacher(cacher)
+	for _, slave := range eg.Slaves() {
+		slave.SetDefaultCacher(cacher)
 	}
 }
 
 // SetLogger set the new logger
 func (eg *EngineGroup) SetLogger(logger core.ILogger) {
 	eg.Engine.SetLogger(logger)
-	for i := 0; i < len(eg.slaves); i++ {
-		eg.slaves[i].SetLogger(logger)
+	for _, slave := range eg.Slaves() {
+		slave.SetLogger(logger)
 	}
 }
 
 // SetLogLevel sets the logger level
 func (eg *EngineGroup) SetLogLevel(level core.LogLevel) {
 	eg.Engine.SetLogLevel(level)
-	for i := 0; i < len(eg.slaves); i++ {
-		eg.slaves[i].SetLogLevel(level)
+	for _, slave := range eg.Slaves() {
+		slave.SetLogLevel(level)
 	}
 }
 
 // SetMapper set the name mapping rules
 func (eg *EngineGroup) SetMapper(mapper core.IMapper) {
 	eg.Engine.SetMapper(mapper)
-	for i := 0; i < len(eg.slaves); i++ {
-		eg.slaves[i].SetMapper(mapper)
+	for _, slave := range eg.Slaves() {
+		slave.SetMapper(mapper)
+	}
+}
+
+// SetCursorKey sets the key signing the cursors of pagination
+func (eg *EngineGroup) SetCursorKey(key []byte) {
+	eg.Engine.SetCursorKey(key)
+	for _, slave := range eg.Slaves() {
+		slave.SetCursorKey(key)
+	}
+}
+
+// SetSchema sets the schema of the tables of master and slaves
+func (eg *EngineGroup) SetSchema(schema string) {
+	eg.Engine.SetSchema(schema)
+	for _, slave := range eg.Slaves() {
+		slave.SetSchema(schema)
 	}
 }
 
 // SetMaxIdleConns set the max idle connections on pool, default is 2
 func (eg *EngineGroup) SetMaxIdleConns(conns int) {
 	eg.Engine.db.SetMaxIdleConns(conns)
-	for i := 0; i < len(eg.slaves); i++ {
-		eg.slaves[i].db.SetMaxIdleConns(conns)
+	for _, slave := range eg.Slaves() {
+		slave.db.SetMaxIdleConns(conns)
 	}
 }
 
 // SetMaxOpenConns is only available for go 1.2+
 func (eg *EngineGroup) SetMaxOpenConns(conns int) {
 	eg.Engine.db.SetMaxOpenConns(conns)
-	for i := 0; i < len(eg.slaves); i++ {
-		eg.slaves[i].db.SetMaxOpenConns(conns)
+	for _, slave := range eg.Slaves() {
+		slave.db.SetMaxOpenConns(conns)
 	}
 }
 
 // SetPolicy set the group policy
 func (eg *EngineGroup) SetPolicy(policy GroupPolicy) *EngineGroup {
+	eg.mutex.Lock()
 	eg.policy = policy
+	eg.mutex.Unlock()
 	return eg
 }
 
 // SetTableMapper set the table name mapping rule
 func (eg *EngineGroup) SetTableMapper(mapper core.IMapper) {
 	eg.Engine.TableMapper = mapper
-	for i := 0; i < len(eg.slaves); i++ {
-		eg.slaves[i].TableMapper = mapper
+	for _, slave := range eg.Slaves() {
+		slave.TableMapper = mapper
 	}
 }
 
 // ShowExecTime show SQL statement and execute time or not on logger if log level is great than INFO
 func (eg *EngineGroup) ShowExecTime(show ...bool) {
 	eg.Engine.ShowExecTime(show...)
-	for i := 0; i < len(eg.slaves); i++ {
-		eg.slaves[i].ShowExecTime(show...)
+	for _, slave := range eg.Slaves() {
+		slave.ShowExecTime(show...)
 	}
 }
 
 // ShowSQL show SQL statement or not on logger if log level is great than INFO
 func (eg *EngineGroup) ShowSQL(show ...bool) {
 	eg.Engine.ShowSQL(show...)
-	for i := 0; i < len(eg.slaves); i++ {
-		eg.slaves[i].ShowSQL(show...)
+	for _, slave := range eg.Slaves() {
+		slave.ShowSQL(show...)
 	}
 }
 
-// Slave returns one of the physical databases which is a slave according the policy
+// Slave returns one of the physical databases which is a slave according the policy,
+// or the master if there is no healthy slave
 func (eg *EngineGroup) Slave() *Engine {
-	switch len(eg.slaves) {
+	var slaves, healthy = eg.slaveHealth()
+	var candidate *Engine
+	var count int
+	for i, slave := range slaves {
+		if healthy[i] {
+			candidate = slave
+			count++
+		}
+	}
+	switch count {
 	case 0:
 		return eg.Engine
 	case 1:
-		return eg.slaves[0]
+		return candidate
 	}
-	return eg.policy.Slave(eg)
+
+	eg.mutex.RLock()
+	var policy = eg.policy
+	eg.mutex.RUnlock()
+	return policy.Slave(eg)
 }
 
-// Slaves returns all the slaves
+// Slaves returns all the slaves including the unhealthy ones, Health reports
+// which of them are healthy. The slice should not be modified since it's
+// replaced rather than changed by AddSlave and RemoveSlave.
 func (eg *EngineGroup) Slaves() []*Engine {
+	eg.mutex.RLock()
+	defer eg.mutex.RUnlock()
 	return eg.slaves
 }
+
+// slaveHealth returns all the slaves and whether the slave at the same index is
+// healthy, so that the policies could skip the unhealthy slaves and still index
+// their weights by the positions of the slaves
+func (eg *EngineGroup) slaveHealth() ([]*Engine, []bool) {
+	eg.mutex.RLock()
+	defer eg.mutex.RUnlock()
+	if eg.health != nil {
+		return eg.slaves, eg.healthy
+	}
+	var healthy = make([]bool, len(eg.slaves))
+	for i := range healthy {
+		healthy[i] = true
+	}
+	return eg.slaves, healthy
+}
+
+// AddSlave adds a slave to the group, it could be called while the queries are
+// running. The slave is healthy until it fails the health check. The logger, the
+// mappers, the cacher, the schema and the sql logging of the master are applied
+// to the slave.
+func (eg *EngineGroup) AddSlave(slave *Engine) {
+	eg.mutex.Lock()
+	defer eg.mutex.Unlock()
+
+	for _, s := range eg.slaves {
+		if s == slave {
+			return
+		}
+	}
+
+	eg.inheritSettings(slave)
+	slave.engineGroup = eg
+	var slaves = make([]*Engine, len(eg.slaves), len(eg.slaves)+1)
+	copy(slaves, eg.slaves)
+	eg.slaves = append(slaves, slave)
+
+	if eg.health != nil {
+		eg.health.states[slave] = &SlaveHealth{Slave: slave, Healthy: true}
+		eg.refreshHealthy()
+	}
+}
+
+// inheritSettings applies the settings of the master to the slave, which have
+// been applied to the other slaves by the setters of the group
+func (eg *EngineGroup) inheritSettings(slave *Engine) {
+	var master = eg.Engine
+	slave.SetLogger(master.logger)
+	slave.ColumnMapper = master.ColumnMapper
+	slave.TableMapper = master.TableMapper
+	slave.SetDefaultCacher(master.Cacher)
+	slave.SetCursorKey(master.cursorKey)
+	slave.SetSchema(master.dialect.URI().Schema)
+	slave.showSQL = master.showSQL
+	slave.showExecTime = master.showExecTime
+}
+
+// RemoveSlave removes a slave from the group, it could be called while the
+// queries are running. The slave is not closed so that the running queries on
+// it could be finished. ErrNotExist is returned if the slave is not in the group.
+func (eg *EngineGroup) RemoveSlave(slave *Engine) error {
+	eg.mutex.Lock()
+	defer eg.mutex.Unlock()
+
+	var slaves = make([]*Engine, 0, len(eg.slaves))
+	for _, s := range eg.slaves {
+		if s != slave {
+			slaves = append(slaves, s)
+		}
+	}
+	if len(slaves) == len(eg.slaves) {
+		return ErrNotExist
+	}
+	eg.slaves = slaves
+
+	if eg.health != nil {
+		delete(eg.health.states, slave)
+		eg.refreshHealthy()
+	}
+	if observer, ok := eg.policy.(latencyObserver); ok {
+		observer.forget(slave.DB())
+	}
+	return nil
+}
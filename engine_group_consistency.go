@@ -0,0 +1,174 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// LagProvider checks the replication of the slaves, it could be implemented by
+// comparing the GTID of mysql or the LSN of postgres
+type LagProvider interface {
+	// Reached returns true if the slave has replayed the replication position
+	Reached(ctx context.Context, slave *Engine, position string) (bool, error)
+}
+
+// LagProviderHandler should be used when a function is a LagProvider
+type LagProviderHandler func(ctx context.Context, slave *Engine, position string) (bool, error)
+
+// Reached implements LagProvider
+func (h LagProviderHandler) Reached(ctx context.Context, slave *Engine, position string) (bool, error) {
+	return h(ctx, slave, position)
+}
+
+// ConsistencyToken records the last write of a session or a context, the reads
+// of them will stick to the master until the write is visible on the slaves
+type ConsistencyToken struct {
+	mu       sync.Mutex
+	written  time.Time
+	position string
+}
+
+// NewConsistencyToken creates a token which could be shared by the sessions
+// through the context made by WithConsistencyToken
+func NewConsistencyToken() *ConsistencyToken {
+	return &ConsistencyToken{}
+}
+
+// SetPosition sets the replication position of the last write, the reads will
+// stick to the master until the slave reaches the position according the
+// LagProvider of the group
+func (token *ConsistencyToken) SetPosition(position string) {
+	token.mu.Lock()
+	token.position = position
+	token.mu.Unlock()
+}
+
+// Written returns the time of the last write
+func (token *ConsistencyToken) Written() time.Time {
+	token.mu.Lock()
+	defer token.mu.Unlock()
+	return token.written
+}
+
+func (token *ConsistencyToken) markWritten() {
+	token.mu.Lock()
+	token.written = time.Now()
+	token.mu.Unlock()
+}
+
+func (token *ConsistencyToken) state() (time.Time, string) {
+	token.mu.Lock()
+	defer token.mu.Unlock()
+	return token.written, token.position
+}
+
+type consistencyContextKey struct{}
+
+// WithConsistencyToken returns a context which carries the token, the writes of
+// the sessions using the context will be recorded by the token
+func WithConsistencyToken(ctx context.Context, token *ConsistencyToken) context.Context {
+	return context.WithValue(ctx, consistencyContextKey{}, token)
+}
+
+func consistencyTokenOf(ctx context.Context) *ConsistencyToken {
+	if ctx == nil {
+		return nil
+	}
+	token, _ := ctx.Value(consistencyContextKey{}).(*ConsistencyToken)
+	return token
+}
+
+// consistency is the read-your-writes settings of an engine group
+type consistency struct {
+	window time.Duration
+	lag    LagProvider
+}
+
+// SetConsistency makes the reads of a session or a context token stick to the
+// master after a write, until the window is passed, or until the slave reaches
+// the replication position of the token if the lag provider is not nil. A zero
+// window and a nil lag provider disable it.
+func (eg *EngineGroup) SetConsistency(window time.Duration, lag LagProvider) *EngineGroup {
+	eg.mutex.Lock()
+	defer eg.mutex.Unlock()
+	if window <= 0 && lag == nil {
+		eg.consistency = nil
+	} else {
+		eg.consistency = &consistency{window: window, lag: lag}
+	}
+	return eg
+}
+
+// consistencySettings returns the read-your-writes settings, nil if it's disabled
+func (eg *EngineGroup) consistencySettings() *consistency {
+	eg.mutex.RLock()
+	defer eg.mutex.RUnlock()
+	return eg.consistency
+}
+
+// visible returns true if the last write recorded by the token is visible on the slave
+func (eg *EngineGroup) visible(ctx context.Context, settings *consistency, token *ConsistencyToken, slave *Engine) bool {
+	written, position := token.state()
+	if written.IsZero() {
+		return true
+	}
+
+	if position != "" && settings.lag != nil {
+		reached, err := settings.lag.Reached(ctx, slave, position)
+		if err != nil {
+			eg.logger.Warnf("check replication position %s of %s failed: %v", position, eg.engineName(slave), err)
+			return false
+		}
+		return reached
+	}
+	return time.Since(written) >= settings.window
+}
+
+// consistentSlave returns the slave if the writes of the session and the context
+// are visible on it, otherwise the master
+func (eg *EngineGroup) consistentSlave(ctx context.Context, session *Session, slave *Engine) *Engine {
+	var settings = eg.consistencySettings()
+	if settings == nil || slave == eg.Engine {
+		return slave
+	}
+	for _, token := range []*ConsistencyToken{session.consistency, consistencyTokenOf(ctx)} {
+		if token != nil && !eg.visible(ctx, settings, token, slave) {
+			return eg.Master()
+		}
+	}
+	return slave
+}
+
+// markWrittenIfSucceeded records the write of the session after the statement is
+// executed, the failed or rejected statements don't stick the reads to the master
+func (session *Session) markWrittenIfSucceeded(kind SQLKind, err *error) {
+	if *err == nil && session.engine.engineGroup != nil && kind == WriteSQL {
+		session.markWritten()
+	}
+}
+
+// markWritten records the write of the session
+func (session *Session) markWritten() {
+	group := session.engine.engineGroup
+	if group == nil || group.consistencySettings() == nil {
+		return
+	}
+	if !session.isAutoCommit {
+		// the write is visible after the transaction is committed
+		session.txWritten = true
+		return
+	}
+
+	if session.consistency == nil {
+		session.consistency = NewConsistencyToken()
+	}
+	session.consistency.markWritten()
+	if token := consistencyTokenOf(session.ctx); token != nil {
+		token.markWritten()
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"context"
+	"time"
+)
+
+// SlaveHealth is the health state of a slave reported by EngineGroup.Health
+type SlaveHealth struct {
+	Slave     *Engine
+	Healthy   bool
+	Failures  int // consecutive failed pings
+	Successes int // consecutive successful pings
+	LastCheck time.Time
+	LastError error
+}
+
+// healthChecker pings the slaves of a group in the background
+type healthChecker struct {
+	interval    time.Duration
+	maxFailures int
+	minRecovery int
+	states      map[*Engine]*SlaveHealth
+	ctx         context.Context
+	cancel      context.CancelFunc
+}
+
+// SetHealthCheck starts pinging the slaves every interval in the background. A
+// slave is removed from the candidates of the policy after maxFailures
+// consecutive failed pings, and added back after minRecovery consecutive
+// successful pings. The reads go to the master if there is no healthy slave.
+// Slaves still returns all the slaves, and Health reports which are healthy.
+// A non-positive interval stops the health check.
+func (eg *EngineGroup) SetHealthCheck(interval time.Duration, maxFailures, minRecovery int) *EngineGroup {
+	eg.mutex.Lock()
+	defer eg.mutex.Unlock()
+
+	if eg.health != nil {
+		eg.health.cancel()
+		eg.health = nil
+		eg.healthy = nil
+	}
+	if interval <= 0 {
+		return eg
+	}
+
+	if maxFailures <= 0 {
+		maxFailures = 1
+	}
+	if minRecovery <= 0 {
+		minRecovery = 1
+	}
+	checker := &healthChecker{
+		interval:    interval,
+		maxFailures: maxFailures,
+		minRecovery: minRecovery,
+		states:      make(map[*Engine]*SlaveHealth, len(eg.slaves)),
+	}
+	checker.ctx, checker.cancel = context.WithCancel(context.Background())
+	for _, slave := range eg.slaves {
+		checker.states[slave] = &SlaveHealth{Slave: slave, Healthy: true}
+	}
+	eg.health = checker
+	eg.refreshHealthy()
+
+	go eg.runHealthCheck(checker)
+	return eg
+}
+
+func (eg *EngineGroup) runHealthCheck(checker *healthChecker) {
+	ticker := time.NewTicker(checker.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-checker.ctx.Done():
+			return
+		case <-ticker.C:
+			eg.checkHealth(checker)
+		}
+	}
+}
+
+// checkHealth pings all the slaves once
+func (eg *EngineGroup) checkHealth(checker *healthChecker) {
+	eg.mutex.RLock()
+	var slaves = eg.slaves
+	eg.mutex.RUnlock()
+
+	for _, slave := range slaves {
+		ctx, cancel := context.WithTimeout(checker.ctx, checker.interval)
+		err := slave.DB().PingContext(ctx)
+		cancel()
+		eg.updateHealth(checker, slave, err)
+	}
+}
+
+// updateHealth records the result of a ping and updates the healthy slaves if
+// the state of the slave is changed
+func (eg *EngineGroup) updateHealth(checker *healthChecker, slave *Engine, err error) {
+	eg.mutex.Lock()
+	if eg.health != checker {
+		// the health check has been stopped or restarted
+		eg.mutex.Unlock()
+		return
+	}
+	state, ok := checker.states[slave]
+	if !ok {
+		eg.mutex.Unlock()
+		return
+	}
+
+	var changed bool
+	state.LastCheck = time.Now()
+	state.LastError = err
+	if err != nil {
+		state.Successes = 0
+		state.Failures++
+		changed = state.Healthy && state.Failures >= checker.maxFailures
+	} else {
+		state.Failures = 0
+		state.Successes++
+		changed = !state.Healthy && state.Successes >= checker.minRecovery
+	}
+	if changed {
+		state.Healthy = !state.Healthy
+		eg.refreshHealthy()
+	}
+	var healthy, failures = 0, state.Failures
+	for _, ok := range eg.healthy {
+		if ok {
+			healthy++
+		}
+	}
+	eg.mutex.Unlock()
+
+	if !changed {
+		return
+	}
+	if err != nil {
+		eg.logger.Warnf("[health] %s is unhealthy after %d failed pings: %v", eg.engineName(slave), failures, err)
+		if healthy == 0 {
+			eg.logger.Warnf("[health] no healthy slave, reads will go to the master")
+		}
+	} else {
+		eg.logger.Infof("[health] %s is healthy again", eg.engineName(slave))
+	}
+}
+
+// refreshHealthy rebuilds the health of the slaves by their indices, the mutex
+// should be held
+func (eg *EngineGroup) refreshHealthy() {
+	var healthy = make([]bool, len(eg.slaves))
+	for i, slave := range eg.slaves {
+		healthy[i] = eg.health.states[slave].Healthy
+	}
+	eg.healthy = healthy
+}
+
+// Health returns the health states of the slaves, all the slaves are healthy if
+// the health check is not started
+func (eg *EngineGroup) Health() []SlaveHealth {
+	eg.mutex.RLock()
+	defer eg.mutex.RUnlock()
+
+	var states = make([]SlaveHealth, 0, len(eg.slaves))
+	for _, slave := range eg.slaves {
+		if eg.health == nil {
+			states = append(states, SlaveHealth{Slave: slave, Healthy: true})
+		} else {
+			states = append(states, *eg.health.states[slave])
+		}
+	}
+	return states
+}
@@ -5,9 +5,12 @@
 package xorm
 
 import (
+	"context"
 	"math/rand"
 	"sync"
 	"time"
+
+	"github.com/go-xorm/core"
 )
 
 // GroupPolicy is be used by chosing the current slave from slaves
@@ -23,11 +26,28 @@ func (h GroupPolicyHandler) Slave(eg *EngineGroup) *Engine {
 	return h(eg)
 }
 
+// healthySlaves returns the healthy slaves of the group, it's used by the policies
+// which don't index the slaves by their positions
+func healthySlaves(g *EngineGroup) []*Engine {
+	var slaves, healthy = g.slaveHealth()
+	var candidates = make([]*Engine, 0, len(slaves))
+	for i, slave := range slaves {
+		if healthy[i] {
+			candidates = append(candidates, slave)
+		}
+	}
+	return candidates
+}
+
 // RandomPolicy implmentes randomly chose the slave of slaves
 func RandomPolicy() GroupPolicyHandler {
 	var r = rand.New(rand.NewSource(time.Now().UnixNano()))
 	return func(g *EngineGroup) *Engine {
-		return g.Slaves()[r.Intn(len(g.Slaves()))]
+		var slaves = healthySlaves(g)
+		if len(slaves) == 0 {
+			return g.Master()
+		}
+		return slaves[r.Intn(len(slaves))]
 	}
 }
 
@@ -42,12 +62,24 @@ func WeightRandomPolicy(weights []int) GroupPolicyHandler {
 	var r = rand.New(rand.NewSource(time.Now().UnixNano()))
 
 	return func(g *EngineGroup) *Engine {
-		var slaves = g.Slaves()
-		idx := rands[r.Intn(len(rands))]
-		if idx >= len(slaves) {
-			idx = len(slaves) - 1
+		var slaves, healthy = g.slaveHealth()
+		if len(slaves) == 0 {
+			return g.Master()
 		}
-		return slaves[idx]
+		// the weights are chosen from the healthy slaves only
+		var candidates = make([]int, 0, len(rands))
+		for _, idx := range rands {
+			if idx >= len(slaves) {
+				idx = len(slaves) - 1
+			}
+			if healthy[idx] {
+				candidates = append(candidates, idx)
+			}
+		}
+		if len(candidates) == 0 {
+			return g.Master()
+		}
+		return slaves[candidates[r.Intn(len(candidates))]]
 	}
 }
 
@@ -55,7 +87,10 @@ func RoundRobinPolicy() GroupPolicyHandler {
 	var pos = -1
 	var lock sync.Mutex
 	return func(g *EngineGroup) *Engine {
-		var slaves = g.Slaves()
+		var slaves = healthySlaves(g)
+		if len(slaves) == 0 {
+			return g.Master()
+		}
 
 		lock.Lock()
 		defer lock.Unlock()
@@ -79,26 +114,38 @@ func WeightRoundRobinPolicy(weights []int) GroupPolicyHandler {
 	var lock sync.Mutex
 
 	return func(g *EngineGroup) *Engine {
-		var slaves = g.Slaves()
+		var slaves, healthy = g.slaveHealth()
+		if len(slaves) == 0 {
+			return g.Master()
+		}
 		lock.Lock()
 		defer lock.Unlock()
-		pos++
-		if pos >= len(rands) {
-			pos = 0
-		}
+		// the unhealthy slaves are skipped without changing the order of the others
+		for i := 0; i < len(rands); i++ {
+			pos++
+			if pos >= len(rands) {
+				pos = 0
+			}
 
-		idx := rands[pos]
-		if idx >= len(slaves) {
-			idx = len(slaves) - 1
+			idx := rands[pos]
+			if idx >= len(slaves) {
+				idx = len(slaves) - 1
+			}
+			if healthy[idx] {
+				return slaves[idx]
+			}
 		}
-		return slaves[idx]
+		return g.Master()
 	}
 }
 
 // LeastConnPolicy implements GroupPolicy, every time will get the least connections slave
 func LeastConnPolicy() GroupPolicyHandler {
 	return func(g *EngineGroup) *Engine {
-		var slaves = g.Slaves()
+		var slaves = healthySlaves(g)
+		if len(slaves) == 0 {
+			return g.Master()
+		}
 		connections := 0
 		idx := 0
 		for i := 0; i < len(slaves); i++ {
@@ -114,3 +161,103 @@ func LeastConnPolicy() GroupPolicyHandler {
 		return slaves[idx]
 	}
 }
+
+// latencyObserver is implemented by the policies which choose the slaves by the
+// latencies of the queries on them
+type latencyObserver interface {
+	observe(db *core.DB, latency time.Duration, err error)
+	forget(db *core.DB)
+}
+
+const (
+	// the default weight of a new sample of LatencyPolicy
+	defaultLatencyDecay = 0.1
+	// how much the error rate makes a slave slower, a slave failing all the
+	// queries is treated as 10 times slower
+	latencyErrorPenalty = 9
+	// the probability of choosing a random slave to measure it again
+	latencyExploreRate = 0.05
+)
+
+type latencyStats struct {
+	latency float64 // EWMA of the latencies in nanoseconds
+	errRate float64 // EWMA of the error rate
+}
+
+type latencyPolicy struct {
+	decay   float64
+	explore float64
+	mutex   sync.Mutex
+	stats   map[*core.DB]*latencyStats
+	r       *rand.Rand
+}
+
+// LatencyPolicy implements GroupPolicy, it chooses the slave with the lowest EWMA
+// of the query latencies weighted by the error rate. The decay is the weight of
+// a new sample which should be in (0, 1], 0.1 is used if it's out of the range.
+// The slaves never measured are chosen first, and a random slave is chosen once
+// in a while so that a slow slave could be chosen again after it recovers.
+func LatencyPolicy(decay float64) GroupPolicy {
+	if decay <= 0 || decay > 1 {
+		decay = defaultLatencyDecay
+	}
+	return &latencyPolicy{
+		decay:   decay,
+		explore: latencyExploreRate,
+		stats:   make(map[*core.DB]*latencyStats),
+		r:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Slave implements GroupPolicy
+func (p *latencyPolicy) Slave(g *EngineGroup) *Engine {
+	var slaves = healthySlaves(g)
+	if len(slaves) == 0 {
+		return g.Master()
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.r.Float64() < p.explore {
+		return slaves[p.r.Intn(len(slaves))]
+	}
+
+	var idx, best = 0, 0.0
+	for i, slave := range slaves {
+		stats, ok := p.stats[slave.DB()]
+		if !ok {
+			return slave
+		}
+		score := stats.latency * (1 + latencyErrorPenalty*stats.errRate)
+		if i == 0 || score < best {
+			idx, best = i, score
+		}
+	}
+	return slaves[idx]
+}
+
+func (p *latencyPolicy) observe(db *core.DB, latency time.Duration, err error) {
+	if err == context.Canceled {
+		return
+	}
+	var failed float64
+	if err != nil {
+		failed = 1
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	stats, ok := p.stats[db]
+	if !ok {
+		p.stats[db] = &latencyStats{latency: float64(latency), errRate: failed}
+		return
+	}
+	stats.latency += p.decay * (float64(latency) - stats.latency)
+	stats.errRate += p.decay * (failed - stats.errRate)
+}
+
+func (p *latencyPolicy) forget(db *core.DB) {
+	p.mutex.Lock()
+	delete(p.stats, db)
+	p.mutex.Unlock()
+}
@@ -0,0 +1,147 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrWriteOnSlave is returned when a write statement is routed to a slave
+var ErrWriteOnSlave = errors.New("Write statement could not be executed on a slave")
+
+// SQLKind is the kind of a statement to be routed
+type SQLKind int
+
+// the kinds of the statements
+const (
+	// ReadSQL reads the records without locks, e.g. a plain SELECT
+	ReadSQL SQLKind = iota
+	// LockingReadSQL reads the records with locks, e.g. SELECT ... FOR UPDATE
+	LockingReadSQL
+	// WriteSQL changes the database, e.g. INSERT, UPDATE, DELETE or DDL
+	WriteSQL
+)
+
+// String returns the name of the kind
+func (kind SQLKind) String() string {
+	switch kind {
+	case ReadSQL:
+		return "read"
+	case LockingReadSQL:
+		return "locking read"
+	}
+	return "write"
+}
+
+// RouteInfo describes the statement to be routed
+type RouteInfo struct {
+	Context context.Context
+	SQL     string
+	Args    []interface{}
+	Kind    SQLKind
+}
+
+// GroupRouter decides which engine of the group the autocommit statements of a
+// session go to. Returning nil falls back to the default routing, which sends
+// writes, locking reads and the reads of a context made by WithMaster to the
+// engine of the session, usually the master, and the other reads to a slave
+// chosen by the policy, or to the master if the writes of the session are not
+// visible on the slave yet, see SetConsistency.
+type GroupRouter interface {
+	Route(*EngineGroup, *RouteInfo) *Engine
+}
+
+// GroupRouterHandler should be used when a function is a GroupRouter
+type GroupRouterHandler func(*EngineGroup, *RouteInfo) *Engine
+
+// Route implements GroupRouter
+func (h GroupRouterHandler) Route(eg *EngineGroup, info *RouteInfo) *Engine {
+	return h(eg, info)
+}
+
+// SetRouter sets the router which decides where the statements go
+func (eg *EngineGroup) SetRouter(router GroupRouter) *EngineGroup {
+	eg.mutex.Lock()
+	eg.router = router
+	eg.mutex.Unlock()
+	return eg
+}
+
+type masterContextKey struct{}
+
+// WithMaster returns a context whose statements will be routed to the master
+func WithMaster(ctx context.Context) context.Context {
+	return context.WithValue(ctx, masterContextKey{}, true)
+}
+
+// isMasterContext returns true if the context is made by WithMaster
+func isMasterContext(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	master, _ := ctx.Value(masterContextKey{}).(bool)
+	return master
+}
+
+// sqlKind returns the kind of the statement by its leading keyword and locks, it's
+// used to route the queries, the statements executed are always writes
+func sqlKind(sqlStr string) SQLKind {
+	sqlStr = strings.TrimLeft(sqlStr, " \t\r\n(")
+	var keyword = sqlStr
+	if idx := strings.IndexAny(sqlStr, " \t\r\n("); idx >= 0 {
+		keyword = sqlStr[:idx]
+	}
+
+	switch strings.ToUpper(keyword) {
+	case "SELECT", "WITH":
+		upper := strings.ToUpper(sqlStr)
+		if strings.Contains(upper, " FOR UPDATE") || strings.Contains(upper, " FOR SHARE") ||
+			strings.Contains(upper, " LOCK IN SHARE MODE") || strings.Contains(upper, "UPDLOCK") {
+			return LockingReadSQL
+		}
+		return ReadSQL
+	case "SHOW", "EXPLAIN", "DESCRIBE", "DESC", "PRAGMA":
+		return ReadSQL
+	}
+	return WriteSQL
+}
+
+// route returns the engine which the autocommit statement should go to, the
+// engine set by UseMaster or UseSlave of the session takes precedence over the
+// router and the default routing
+func (eg *EngineGroup) route(session *Session, info *RouteInfo) *Engine {
+	if session.route != nil {
+		return session.route
+	}
+	eg.mutex.RLock()
+	var router = eg.router
+	eg.mutex.RUnlock()
+	if router != nil {
+		if engine := router.Route(eg, info); engine != nil {
+			return engine
+		}
+	}
+	if info.Kind != ReadSQL || isMasterContext(info.Context) {
+		// the engine of the session is the master unless it's created by a slave
+		return session.engine
+	}
+	return eg.consistentSlave(info.Context, session, eg.Slave())
+}
+
+// engineName returns the name of the engine in the group used by the logs
+func (eg *EngineGroup) engineName(engine *Engine) string {
+	if engine == eg.Engine {
+		return "master"
+	}
+	for i, slave := range eg.Slaves() {
+		if slave == engine {
+			return "slave " + strconv.Itoa(i)
+		}
+	}
+	return "unknown"
+}
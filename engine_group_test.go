@@ -0,0 +1,351 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type GroupRecord struct {
+	Id   int64
+	Name string
+}
+
+// newTestEngineGroup creates a group of two independent sqlite databases so
+// that the records written to the master are never seen by the slave
+func newTestEngineGroup(t *testing.T, name string) *EngineGroup {
+	master, err := NewEngine("sqlite3", "file:"+name+"_master?mode=memory&cache=shared")
+	assert.NoError(t, err)
+	slave, err := NewEngine("sqlite3", "file:"+name+"_slave?mode=memory&cache=shared")
+	assert.NoError(t, err)
+
+	eg, err := NewEngineGroup(master, []*Engine{slave})
+	assert.NoError(t, err)
+	eg.ShowSQL(*showSQL)
+
+	assert.NoError(t, master.Sync2(new(GroupRecord)))
+	assert.NoError(t, slave.Sync2(new(GroupRecord)))
+	return eg
+}
+
+func TestEngineGroupRoute(t *testing.T) {
+	eg := newTestEngineGroup(t, "route")
+	defer eg.Close()
+
+	_, err := eg.Insert(&GroupRecord{Name: "a"})
+	assert.NoError(t, err)
+
+	cnt, err := eg.Count(new(GroupRecord))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, cnt)
+
+	cnt, err = eg.UseMaster().Count(new(GroupRecord))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+
+	cnt, err = eg.Context(WithMaster(context.Background())).Count(new(GroupRecord))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+
+	_, err = eg.UseSlave(nil).Insert(&GroupRecord{Name: "b"})
+	assert.EqualValues(t, ErrWriteOnSlave, err)
+
+	// the statements prepared on the master are not reused on the slave
+	session := eg.NewSession()
+	defer session.Close()
+	cnt, err = session.UseMaster().Prepare().Count(new(GroupRecord))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+	cnt, err = session.UseSlave(nil).Prepare().Count(new(GroupRecord))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, cnt)
+
+	// the statements executed go to the master whatever their leading keywords
+	_, err = eg.Exec("WITH t AS (SELECT 'c' AS name) INSERT INTO group_record (name) SELECT name FROM t")
+	assert.NoError(t, err)
+	cnt, err = eg.UseMaster().Count(new(GroupRecord))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, cnt)
+
+	// the reads executed are sent to the slave chosen by UseSlave
+	_, err = eg.UseSlave(nil).Exec("SELECT * FROM group_record")
+	assert.NoError(t, err)
+
+	eg.SetRouter(GroupRouterHandler(func(eg *EngineGroup, info *RouteInfo) *Engine {
+		if strings.Contains(info.SQL, "group_record") {
+			return eg.Master()
+		}
+		return nil
+	}))
+	cnt, err = eg.Count(new(GroupRecord))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, cnt)
+
+	eg.SetRouter(GroupRouterHandler(func(eg *EngineGroup, info *RouteInfo) *Engine {
+		return eg.Slave()
+	}))
+	_, err = eg.Exec("DELETE FROM group_record")
+	assert.EqualValues(t, ErrWriteOnSlave, err)
+}
+
+func TestEngineGroupConsistency(t *testing.T) {
+	eg := newTestEngineGroup(t, "consistency")
+	defer eg.Close()
+
+	eg.SetConsistency(time.Hour, nil)
+
+	session := eg.NewSession()
+	defer session.Close()
+
+	cnt, err := session.Count(new(GroupRecord))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, cnt)
+
+	_, err = session.Insert(&GroupRecord{Name: "a"})
+	assert.NoError(t, err)
+	cnt, err = session.Count(new(GroupRecord))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+
+	// the writes of a transaction are recorded after committed
+	session2 := eg.NewSession()
+	defer session2.Close()
+	assert.NoError(t, session2.Begin())
+	_, err = session2.Insert(&GroupRecord{Name: "b"})
+	assert.NoError(t, err)
+	assert.NoError(t, session2.Commit())
+	cnt, err = session2.Count(new(GroupRecord))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, cnt)
+
+	// the other sessions are not affected unless sharing a token
+	cnt, err = eg.Count(new(GroupRecord))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, cnt)
+
+	token := NewConsistencyToken()
+	ctx := WithConsistencyToken(context.Background(), token)
+	_, err = eg.Context(ctx).Insert(&GroupRecord{Name: "c"})
+	assert.NoError(t, err)
+	assert.False(t, token.Written().IsZero())
+	cnt, err = eg.Context(ctx).Count(new(GroupRecord))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, cnt)
+
+	// the failed writes are not recorded
+	failed := NewConsistencyToken()
+	_, err = eg.Context(WithConsistencyToken(context.Background(), failed)).
+		Exec("INSERT INTO " + eg.Quote("unknown_group_record") + " (id) VALUES (1)")
+	assert.Error(t, err)
+	assert.True(t, failed.Written().IsZero())
+
+	var reached bool
+	eg.SetConsistency(0, LagProviderHandler(func(ctx context.Context, slave *Engine, position string) (bool, error) {
+		assert.EqualValues(t, "pos-1", position)
+		return reached, nil
+	}))
+	token.SetPosition("pos-1")
+	cnt, err = eg.Context(ctx).Count(new(GroupRecord))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, cnt)
+
+	reached = true
+	cnt, err = eg.Context(ctx).Count(new(GroupRecord))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, cnt)
+
+	eg.SetConsistency(0, nil)
+	cnt, err = session.Count(new(GroupRecord))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, cnt)
+}
+
+func TestEngineGroupHealth(t *testing.T) {
+	eg := newTestEngineGroup(t, "health")
+	defer eg.Close()
+
+	slave := eg.Slaves()[0]
+	eg.SetHealthCheck(time.Hour, 2, 2)
+	checker := eg.health
+
+	health := eg.Health()
+	assert.EqualValues(t, 1, len(health))
+	assert.True(t, health[0].Healthy)
+
+	eg.updateHealth(checker, slave, errors.New("connection refused"))
+	assert.True(t, eg.Health()[0].Healthy)
+	assert.True(t, slave == eg.Slave())
+
+	eg.updateHealth(checker, slave, errors.New("connection refused"))
+	health = eg.Health()
+	assert.False(t, health[0].Healthy)
+	assert.EqualValues(t, 2, health[0].Failures)
+	assert.EqualValues(t, 1, len(eg.Slaves()))
+	assert.True(t, eg.Master() == eg.Slave())
+
+	eg.checkHealth(checker)
+	assert.False(t, eg.Health()[0].Healthy)
+	eg.checkHealth(checker)
+	health = eg.Health()
+	assert.True(t, health[0].Healthy)
+	assert.EqualValues(t, 2, health[0].Successes)
+	assert.NoError(t, health[0].LastError)
+	assert.True(t, slave == eg.Slave())
+
+	eg.SetHealthCheck(0, 0, 0)
+	eg.updateHealth(checker, slave, errors.New("connection refused"))
+	assert.True(t, eg.Health()[0].Healthy)
+}
+
+func TestEngineGroupWeightPolicyHealth(t *testing.T) {
+	eg := newTestEngineGroup(t, "weight")
+	defer eg.Close()
+
+	var slaves = []*Engine{eg.Slaves()[0]}
+	for _, name := range []string{"weight_slave1", "weight_slave2"} {
+		slave, err := NewEngine("sqlite3", "file:"+name+"?mode=memory&cache=shared")
+		assert.NoError(t, err)
+		defer slave.Close()
+		eg.AddSlave(slave)
+		slaves = append(slaves, slave)
+	}
+	eg.SetHealthCheck(time.Hour, 1, 1)
+	eg.updateHealth(eg.health, slaves[0], errors.New("connection refused"))
+
+	// the weights are still applied to the slaves at their original positions
+	for _, policy := range []GroupPolicy{WeightRandomPolicy([]int{1, 0, 1}), WeightRoundRobinPolicy([]int{1, 0, 1})} {
+		eg.SetPolicy(policy)
+		for i := 0; i < 10; i++ {
+			assert.True(t, slaves[2] == eg.Slave())
+		}
+	}
+}
+
+func TestEngineGroupMembership(t *testing.T) {
+	eg := newTestEngineGroup(t, "membership")
+	defer eg.Close()
+
+	slave := eg.Slaves()[0]
+	slave2, err := NewEngine("sqlite3", "file:membership_slave2?mode=memory&cache=shared")
+	assert.NoError(t, err)
+	defer slave2.Close()
+	assert.NoError(t, slave2.Sync2(new(GroupRecord)))
+	_, err = slave2.Insert(&GroupRecord{Name: "a"})
+	assert.NoError(t, err)
+
+	eg.SetHealthCheck(time.Hour, 1, 1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				_, err := eg.Count(new(GroupRecord))
+				assert.NoError(t, err)
+			}
+		}()
+	}
+
+	eg.AddSlave(slave2)
+	eg.AddSlave(slave2)
+	assert.EqualValues(t, 2, len(eg.Slaves()))
+	assert.EqualValues(t, 2, len(eg.Health()))
+	assert.EqualValues(t, "slave 1", eg.engineName(slave2))
+
+	assert.NoError(t, eg.RemoveSlave(slave))
+	assert.EqualValues(t, ErrNotExist, eg.RemoveSlave(slave))
+	wg.Wait()
+
+	assert.EqualValues(t, []*Engine{slave2}, eg.Slaves())
+	cnt, err := eg.Count(new(GroupRecord))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+}
+
+func TestEngineGroupAddSlaveSettings(t *testing.T) {
+	eg := newTestEngineGroup(t, "settings")
+	defer eg.Close()
+
+	cacher := NewLRUCacher(NewMemoryStore(), 100)
+	eg.SetDefaultCacher(cacher)
+	eg.SetCursorKey([]byte("key"))
+	eg.ShowExecTime(true)
+
+	slave2, err := NewEngine("sqlite3", "file:settings_slave2?mode=memory&cache=shared")
+	assert.NoError(t, err)
+	defer slave2.Close()
+
+	// the slave gets the settings applied to the group before it's added
+	eg.AddSlave(slave2)
+	assert.True(t, slave2.logger == eg.logger)
+	assert.True(t, slave2.Cacher == cacher)
+	assert.EqualValues(t, eg.ColumnMapper, slave2.ColumnMapper)
+	assert.EqualValues(t, eg.TableMapper, slave2.TableMapper)
+	assert.EqualValues(t, "key", string(slave2.cursorKey))
+	assert.EqualValues(t, eg.showSQL, slave2.showSQL)
+	assert.True(t, slave2.showExecTime)
+}
+
+func TestLatencyPolicy(t *testing.T) {
+	eg := newTestEngineGroup(t, "latency")
+	defer eg.Close()
+
+	slave := eg.Slaves()[0]
+	slave2, err := NewEngine("sqlite3", "file:latency_slave2?mode=memory&cache=shared")
+	assert.NoError(t, err)
+	defer slave2.Close()
+	eg.AddSlave(slave2)
+
+	policy := LatencyPolicy(0.5).(*latencyPolicy)
+	policy.explore = 0
+	eg.SetPolicy(policy)
+
+	// the slave never measured is chosen first
+	policy.observe(slave.DB(), 10*time.Millisecond, nil)
+	assert.True(t, slave2 == eg.Slave())
+
+	policy.observe(slave2.DB(), 20*time.Millisecond, nil)
+	assert.True(t, slave == eg.Slave())
+
+	// the errors make the slave slower
+	policy.observe(slave.DB(), 10*time.Millisecond, errors.New("connection refused"))
+	assert.EqualValues(t, 0.5, policy.stats[slave.DB()].errRate)
+	assert.True(t, slave2 == eg.Slave())
+
+	// the queries on the slaves are observed, the table is not synced to slave2
+	assert.NoError(t, eg.RemoveSlave(slave2))
+	assert.Nil(t, policy.stats[slave2.DB()])
+	eg.AddSlave(slave2)
+	_, err = eg.Count(new(GroupRecord))
+	assert.Error(t, err)
+	assert.EqualValues(t, 1, policy.stats[slave2.DB()].errRate)
+}
+
+func TestSQLKind(t *testing.T) {
+	var kases = []struct {
+		sql  string
+		kind SQLKind
+	}{
+		{"SELECT * FROM user", ReadSQL},
+		{" (select id from user) union (select id from admin)", ReadSQL},
+		{"WITH t AS (SELECT 1) SELECT * FROM t", ReadSQL},
+		{"SELECT * FROM user WHERE id = ? FOR UPDATE", LockingReadSQL},
+		{"SELECT * FROM user LOCK IN SHARE MODE", LockingReadSQL},
+		{"INSERT INTO user (name) VALUES (?)", WriteSQL},
+		{"update user set name = ?", WriteSQL},
+		{"CREATE TABLE user (id INTEGER)", WriteSQL},
+	}
+	for _, kase := range kases {
+		assert.EqualValues(t, kase.kind, sqlKind(kase.sql), kase.sql)
+	}
+}
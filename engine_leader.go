@@ -0,0 +1,130 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// the interval of checking the leadership if a non-positive one is given
+const defaultLeaderInterval = advisoryLeaseDuration / 3
+
+// LeaderElector elects one leader among the nodes sharing the key by the
+// advisory lock of the key, e.g. only the leader runs the cron jobs
+type LeaderElector struct {
+	engine   *Engine
+	key      string
+	interval time.Duration
+
+	mutex   sync.Mutex
+	lock    advisoryLock
+	leading context.Context // done when the leadership is lost or resigned
+	cancel  context.CancelFunc
+}
+
+// NewLeaderElector returns the elector of the key, the leadership is checked and
+// the lease is renewed every interval, 10 seconds is used if it's not positive.
+// The leadership of a lease is lost as soon as it's not renewed in half of the
+// lease, without waiting for the next check.
+func (engine *Engine) NewLeaderElector(key string, interval time.Duration) *LeaderElector {
+	if interval <= 0 {
+		interval = defaultLeaderInterval
+	}
+	return &LeaderElector{
+		engine:   engine,
+		key:      key,
+		interval: interval,
+	}
+}
+
+// Campaign blocks until the node becomes the leader or ctx is done. The returned
+// channel is closed when the leadership is lost, e.g. the connection holding the
+// lock is broken or the lease could not be renewed, or after Resign.
+func (elector *LeaderElector) Campaign(ctx context.Context) (<-chan struct{}, error) {
+	elector.mutex.Lock()
+	if elector.lock != nil {
+		defer elector.mutex.Unlock()
+		return elector.leading.Done(), nil
+	}
+	elector.mutex.Unlock()
+
+	lock, err := elector.engine.acquireAdvisoryLock(ctx, elector.key, true)
+	if err != nil {
+		return nil, err
+	}
+	if lock == nil {
+		return nil, ErrLockLost
+	}
+
+	elector.mutex.Lock()
+	defer elector.mutex.Unlock()
+	if elector.lock != nil {
+		// elected by a concurrent campaign
+		lock.Unlock()
+		return elector.leading.Done(), nil
+	}
+	elector.lock = lock
+	elector.leading, elector.cancel = context.WithCancel(context.Background())
+	elector.engine.logger.Infof("[leader] elected as the leader of %s", elector.key)
+	go elector.keepLeading(lock, elector.leading, elector.cancel)
+	return elector.leading.Done(), nil
+}
+
+// keepLeading checks the lock every interval until it's lost or resigned
+func (elector *LeaderElector) keepLeading(lock advisoryLock, leading context.Context, cancel context.CancelFunc) {
+	ticker := time.NewTicker(elector.interval)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-leading.Done():
+			return
+		case <-lock.lost():
+			err = ErrLockLost
+		case <-ticker.C:
+			ctx, cancelCheck := context.WithTimeout(leading, elector.interval)
+			err = lock.check(ctx)
+			cancelCheck()
+		}
+		if err == nil {
+			continue
+		}
+
+		elector.mutex.Lock()
+		if elector.lock == lock {
+			elector.lock = nil
+			cancel()
+			elector.engine.logger.Warnf("[leader] the leadership of %s is lost: %v", elector.key, err)
+		}
+		elector.mutex.Unlock()
+		lock.Unlock()
+		return
+	}
+}
+
+// IsLeader returns true if the node is the leader
+func (elector *LeaderElector) IsLeader() bool {
+	elector.mutex.Lock()
+	defer elector.mutex.Unlock()
+	return elector.lock != nil
+}
+
+// Resign gives up the leadership and releases the lock
+func (elector *LeaderElector) Resign() error {
+	elector.mutex.Lock()
+	var lock = elector.lock
+	if lock == nil {
+		elector.mutex.Unlock()
+		return nil
+	}
+	elector.lock = nil
+	elector.cancel()
+	elector.mutex.Unlock()
+
+	elector.engine.logger.Infof("[leader] resigned the leadership of %s", elector.key)
+	return lock.Unlock()
+}
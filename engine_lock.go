@@ -0,0 +1,453 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const (
+	// the lease of the advisory locks kept by the lock table, it's renewed in
+	// the background every third of it
+	advisoryLeaseDuration = 30 * time.Second
+	// the lock is treated as lost if the lease is not renewed in half of it, so
+	// that the holder stops before the lease expires and is taken over by others
+	advisoryLeaseSafety = advisoryLeaseDuration / 2
+	// the interval of trying to acquire a lock of the lock table held by others,
+	// and the longest wait of a lock of the connection if the driver doesn't
+	// cancel the queries when the context is done
+	advisoryRetryInterval = time.Second
+)
+
+// errLockReleased is the error of checking a lock after it's released
+var errLockReleased = errors.New("advisory lock released")
+
+// Unlocker releases an advisory lock
+type Unlocker interface {
+	Unlock() error
+}
+
+// advisoryLock is an advisory lock which is held
+type advisoryLock interface {
+	Unlocker
+	// check returns an error if the lock is not held anymore
+	check(ctx context.Context) error
+	// lost returns a channel which is closed when the lock is known to be lost
+	// without check, or nil if the loss is only found by check
+	lost() <-chan struct{}
+}
+
+// advisoryLockDialect is implemented by the dialects which have the advisory
+// locks held by the connection. The sql of the lock waits for the lock of the
+// key up to the timeout, it doesn't wait if the timeout is 0 and waits until
+// the lock is acquired if it's negative. It selects 1 if the lock is acquired,
+// and selects 0 or fails with the lock timeout error otherwise.
+type advisoryLockDialect interface {
+	AdvisoryLockSql(key string, timeout time.Duration) (string, []interface{})
+	AdvisoryUnlockSql(key string) (string, []interface{})
+}
+
+// ceilMilliseconds rounds the duration up to milliseconds, so that a lock wait
+// doesn't end before the deadline
+func ceilMilliseconds(d time.Duration) int64 {
+	return int64((d + time.Millisecond - 1) / time.Millisecond)
+}
+
+// isLockTimeout returns true if the error is lock_not_available of postgres,
+// which is raised when lock_timeout is exceeded
+func isLockTimeout(err error) bool {
+	return driverErrorField(err, "Code") == "55P03"
+}
+
+// canCancel returns true if the driver of the connection could cancel the
+// queries when the context is done
+func canCancel(conn *sql.Conn) bool {
+	var ok bool
+	conn.Raw(func(driverConn interface{}) error {
+		_, ok = driverConn.(driver.QueryerContext)
+		return nil
+	})
+	return ok
+}
+
+// advisoryLockID hashes the key to the id of the lock on the databases which
+// identify the locks by integers
+func advisoryLockID(key string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return int64(h.Sum64())
+}
+
+// advisoryLockName returns the key if it's not longer than the max length of
+// the name of a lock, or the hash of the key
+func advisoryLockName(key string, maxLen int) string {
+	if len(key) <= maxLen {
+		return key
+	}
+	return fmt.Sprintf("xorm_%016x", uint64(advisoryLockID(key)))
+}
+
+// AdvisoryLock acquires the advisory lock of the key, it waits until the lock is
+// released by others or ctx is done, the deadline of ctx is the timeout of the
+// wait on the database. The lock is held by a connection on postgres, mysql and
+// mssql, so it's released if the connection is broken. On the other databases
+// the lock is a lease in the table xorm_advisory_lock, which is renewed until the
+// lock is released and expires if the process exits.
+func (engine *Engine) AdvisoryLock(ctx context.Context, key string) (Unlocker, error) {
+	lock, err := engine.acquireAdvisoryLock(ctx, key, true)
+	if err != nil {
+		return nil, err
+	}
+	if lock == nil {
+		return nil, fmt.Errorf("advisory lock %s is not acquired", key)
+	}
+	return lock, nil
+}
+
+// TryAdvisoryLock acquires the advisory lock of the key without waiting, false is
+// returned if the lock is held by others
+func (engine *Engine) TryAdvisoryLock(ctx context.Context, key string) (Unlocker, bool, error) {
+	lock, err := engine.acquireAdvisoryLock(ctx, key, false)
+	if err != nil || lock == nil {
+		return nil, false, err
+	}
+	return lock, true, nil
+}
+
+// acquireAdvisoryLock returns nil if the lock is not acquired
+func (engine *Engine) acquireAdvisoryLock(ctx context.Context, key string, wait bool) (advisoryLock, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if dialect, ok := engine.dialect.(advisoryLockDialect); ok {
+		return engine.acquireConnLock(ctx, dialect, key, wait)
+	}
+	return engine.acquireLeaseLock(ctx, key, wait)
+}
+
+// connLock is an advisory lock held by a connection
+type connLock struct {
+	engine     *Engine
+	conn       *sql.Conn
+	unlockSQL  string
+	unlockArgs []interface{}
+	mutex      sync.Mutex
+}
+
+func (engine *Engine) acquireConnLock(ctx context.Context, dialect advisoryLockDialect, key string, wait bool) (advisoryLock, error) {
+	conn, err := engine.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// the lock is waited for by the database until the deadline, and the wait is
+	// cut into the retry intervals only if the context could be canceled but the
+	// driver couldn't cancel the query
+	deadline, hasDeadline := ctx.Deadline()
+	var bounded = ctx.Done() != nil && !canCancel(conn)
+	for {
+		var timeout time.Duration
+		if wait {
+			timeout = -1
+			if hasDeadline {
+				if timeout = time.Until(deadline); timeout <= 0 {
+					conn.Close()
+					return nil, context.DeadlineExceeded
+				}
+			}
+			if bounded && (timeout < 0 || timeout > advisoryRetryInterval) {
+				timeout = advisoryRetryInterval
+			}
+		}
+
+		sqlStr, args := dialect.AdvisoryLockSql(key, timeout)
+		engine.logSQL(sqlStr, args...)
+		var acquired sql.NullInt64
+		err = conn.QueryRowContext(ctx, sqlStr, args...).Scan(&acquired)
+		if err != nil && !isLockTimeout(err) {
+			conn.Close()
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		if err == nil && acquired.Int64 == 1 {
+			break
+		}
+		if ctx.Err() != nil {
+			conn.Close()
+			return nil, ctx.Err()
+		}
+		if !wait || !bounded {
+			// the wait is only retried if it's cut into the intervals
+			conn.Close()
+			if wait && hasDeadline {
+				return nil, context.DeadlineExceeded
+			}
+			return nil, nil
+		}
+	}
+
+	var lock = connLock{engine: engine, conn: conn}
+	lock.unlockSQL, lock.unlockArgs = dialect.AdvisoryUnlockSql(key)
+	return &lock, nil
+}
+
+// Unlock releases the lock and the connection
+func (lock *connLock) Unlock() error {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+	if lock.conn == nil {
+		return nil
+	}
+	defer func() {
+		lock.conn.Close()
+		lock.conn = nil
+	}()
+
+	lock.engine.logSQL(lock.unlockSQL, lock.unlockArgs...)
+	_, err := lock.conn.ExecContext(context.Background(), lock.unlockSQL, lock.unlockArgs...)
+	return err
+}
+
+// check pings the connection, the lock is lost if the connection is broken
+func (lock *connLock) check(ctx context.Context) error {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+	if lock.conn == nil {
+		return ErrLockLost
+	}
+	if err := lock.conn.PingContext(ctx); err != nil {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// lost returns nil since the connection is only checked by ping
+func (lock *connLock) lost() <-chan struct{} {
+	return nil
+}
+
+// advisoryLease is the row of the lock table, the lock is taken over by others
+// if it expires. The expiry is in unix nanoseconds, so the clocks of the nodes
+// should be synchronized.
+type advisoryLease struct {
+	Name      string `xorm:"'lock_name' varchar(255) pk"`
+	Owner     string `xorm:"'owner' varchar(64) notnull"`
+	ExpiresAt int64  `xorm:"'expires_at' notnull"`
+}
+
+func (advisoryLease) TableName() string {
+	return "xorm_advisory_lock"
+}
+
+// leaseLock is an advisory lock kept by a lease of the lock table
+type leaseLock struct {
+	engine    *Engine
+	name      string
+	owner     string
+	renewedAt time.Time
+	ctx       context.Context // done when the lock is released
+	cancel    context.CancelFunc
+	lostCtx   context.Context // done when the lock is lost or released
+	setLost   context.CancelFunc
+	err       error // why the lock is not held anymore
+	mutex     sync.Mutex
+}
+
+// syncLeaseTable creates the lock table if it doesn't exist, the locks are not
+// acquired so often that it's worth caching
+func (engine *Engine) syncLeaseTable() error {
+	engine.leaseMutex.Lock()
+	defer engine.leaseMutex.Unlock()
+	return engine.Sync2(new(advisoryLease))
+}
+
+func (engine *Engine) acquireLeaseLock(ctx context.Context, key string, wait bool) (advisoryLock, error) {
+	if err := engine.syncLeaseTable(); err != nil {
+		return nil, err
+	}
+
+	var b = make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	var lock = leaseLock{
+		engine: engine,
+		name:   key,
+		owner:  hex.EncodeToString(b),
+	}
+
+	for {
+		acquired, err := lock.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			lock.start()
+			return &lock, nil
+		}
+		if !wait {
+			return nil, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(advisoryRetryInterval):
+		}
+	}
+}
+
+// acquire inserts the lease, the expired lease of others is deleted first
+func (lock *leaseLock) acquire(ctx context.Context) (bool, error) {
+	var now = time.Now()
+	_, err := lock.engine.Context(ctx).Where("lock_name = ? AND expires_at < ?", lock.name, now.UnixNano()).
+		Delete(new(advisoryLease))
+	if err != nil {
+		return false, err
+	}
+
+	_, err = lock.engine.Context(ctx).Insert(&advisoryLease{
+		Name:      lock.name,
+		Owner:     lock.owner,
+		ExpiresAt: now.Add(advisoryLeaseDuration).UnixNano(),
+	})
+	if errors.Is(err, ErrUniqueViolation) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	lock.renewedAt = now
+	return true, nil
+}
+
+// start renews the lease in the background
+func (lock *leaseLock) start() {
+	lock.ctx, lock.cancel = context.WithCancel(context.Background())
+	lock.lostCtx, lock.setLost = context.WithCancel(lock.ctx)
+	go lock.keepAlive()
+}
+
+// expiry returns the time when the lock is treated as lost if the lease is not
+// renewed before it
+func (lock *leaseLock) expiry() time.Time {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+	return lock.renewedAt.Add(advisoryLeaseSafety)
+}
+
+// expire marks the lock lost since the lease is not renewed in time
+func (lock *leaseLock) expire() {
+	lock.setLost()
+	lock.mutex.Lock()
+	if lock.err == nil {
+		lock.err = ErrLockLost
+	}
+	lock.mutex.Unlock()
+}
+
+// renew extends the lease, the lock is lost if the lease has been taken over or
+// it could not be renewed in the safety margin of the lease
+func (lock *leaseLock) renew(ctx context.Context) error {
+	lock.mutex.Lock()
+	var err = lock.err
+	lock.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// the mutex is not held while updating, so the expiry is not blocked
+	var now = time.Now()
+	n, err := lock.engine.Context(ctx).Cols("expires_at").
+		Where("lock_name = ? AND owner = ?", lock.name, lock.owner).
+		Update(&advisoryLease{ExpiresAt: now.Add(advisoryLeaseDuration).UnixNano()})
+
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+	if lock.err != nil {
+		// released or expired while renewing
+		return lock.err
+	}
+	if err == nil && n == 0 {
+		lock.err = ErrLockLost
+	} else if err != nil && now.Sub(lock.renewedAt) >= advisoryLeaseSafety {
+		lock.err = ErrLockLost
+	} else if err != nil {
+		lock.engine.logger.Warnf("[lock] renew the lease of %s failed: %v", lock.name, err)
+	} else if now.After(lock.renewedAt) {
+		lock.renewedAt = now
+	}
+	if lock.err != nil {
+		lock.setLost()
+	}
+	return lock.err
+}
+
+// keepAlive renews the lease until the lock is released or lost, the lock is
+// lost as soon as the safety margin of the lease passes without a renewal
+func (lock *leaseLock) keepAlive() {
+	ticker := time.NewTicker(advisoryLeaseDuration / 3)
+	defer ticker.Stop()
+	for {
+		var expiry = lock.expiry()
+		timer := time.NewTimer(time.Until(expiry))
+		select {
+		case <-lock.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			lock.expire()
+			lock.engine.logger.Errorf("[lock] the lease of %s is lost", lock.name)
+			return
+		case <-ticker.C:
+			timer.Stop()
+		}
+
+		ctx, cancel := context.WithDeadline(lock.ctx, expiry)
+		err := lock.renew(ctx)
+		cancel()
+		if err == errLockReleased {
+			return
+		} else if err != nil {
+			lock.engine.logger.Errorf("[lock] the lease of %s is lost", lock.name)
+			return
+		}
+	}
+}
+
+// Unlock stops renewing the lease and deletes it
+func (lock *leaseLock) Unlock() error {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+	if lock.err == errLockReleased {
+		return nil
+	}
+	lock.err = errLockReleased
+	lock.cancel()
+
+	_, err := lock.engine.Where("lock_name = ? AND owner = ?", lock.name, lock.owner).
+		Delete(new(advisoryLease))
+	return err
+}
+
+// check renews the lease
+func (lock *leaseLock) check(ctx context.Context) error {
+	return lock.renew(ctx)
+}
+
+// lost returns the channel closed when the lease is lost or the lock is released
+func (lock *leaseLock) lost() <-chan struct{} {
+	return lock.lostCtx.Done()
+}
@@ -0,0 +1,284 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-xorm/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdvisoryLock(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+
+	ctx := context.Background()
+	lock, err := testEngine.AdvisoryLock(ctx, "xorm_test_lock")
+	assert.NoError(t, err)
+
+	_, acquired, err := testEngine.TryAdvisoryLock(ctx, "xorm_test_lock")
+	assert.NoError(t, err)
+	assert.False(t, acquired)
+
+	other, acquired, err := testEngine.TryAdvisoryLock(ctx, "xorm_test_other_lock")
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+	assert.NoError(t, other.Unlock())
+
+	// the waiting is stopped by the context even if the driver doesn't cancel the query
+	timeout, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	var start = time.Now()
+	_, err = testEngine.AdvisoryLock(timeout, "xorm_test_lock")
+	cancel()
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < advisoryRetryInterval)
+
+	// the deadline of the context is waited for by the database
+	sqlStr, _ := (&postgres{}).AdvisoryLockSql("xorm_test_lock", 0)
+	assert.Contains(t, sqlStr, "pg_try_advisory_lock")
+	sqlStr, _ = (&postgres{}).AdvisoryLockSql("xorm_test_lock", -1)
+	assert.Contains(t, sqlStr, "FROM pg_advisory_lock")
+	assert.NotContains(t, sqlStr, "lock_timeout")
+	sqlStr, _ = (&postgres{}).AdvisoryLockSql("xorm_test_lock", 1500*time.Microsecond)
+	assert.Contains(t, sqlStr, "set_config('lock_timeout', '2ms', true)")
+	for _, c := range []struct {
+		timeout time.Duration
+		seconds int64
+	}{{0, 0}, {-1, -1}, {1500 * time.Millisecond, 2}} {
+		sqlStr, args := (&mysql{}).AdvisoryLockSql("xorm_test_lock", c.timeout)
+		assert.EqualValues(t, "SELECT GET_LOCK(?, ?)", sqlStr)
+		assert.EqualValues(t, c.seconds, args[1])
+	}
+	_, args := (&mssql{}).AdvisoryLockSql("xorm_test_lock", -1)
+	assert.EqualValues(t, -1, args[1])
+	_, args = (&mssql{}).AdvisoryLockSql("xorm_test_lock", 1500*time.Millisecond)
+	assert.EqualValues(t, 1500, args[1])
+
+	assert.NoError(t, lock.Unlock())
+	assert.NoError(t, lock.Unlock())
+
+	lock, acquired, err = testEngine.TryAdvisoryLock(ctx, "xorm_test_lock")
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+	assert.NoError(t, lock.Unlock())
+}
+
+// advisoryLockTestDialect records the timeouts of the waits of the lock, which
+// is never acquired
+type advisoryLockTestDialect struct {
+	core.Dialect
+	timeouts []time.Duration
+}
+
+func (db *advisoryLockTestDialect) AdvisoryLockSql(key string, timeout time.Duration) (string, []interface{}) {
+	db.timeouts = append(db.timeouts, timeout)
+	return "SELECT 0", nil
+}
+
+func (db *advisoryLockTestDialect) AdvisoryUnlockSql(key string) (string, []interface{}) {
+	return "SELECT 1", nil
+}
+
+func TestAdvisoryLockTimeout(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+
+	var engine *Engine
+	switch e := testEngine.(type) {
+	case *Engine:
+		engine = e
+	case *EngineGroup:
+		engine = e.Master()
+	}
+	dialect := &advisoryLockTestDialect{Dialect: engine.dialect}
+
+	lock, err := engine.acquireConnLock(context.Background(), dialect, "xorm_test_lock", false)
+	assert.NoError(t, err)
+	assert.Nil(t, lock)
+	assert.EqualValues(t, []time.Duration{0}, dialect.timeouts)
+
+	// the lock is waited for without a timeout if the context is never done
+	dialect.timeouts = nil
+	lock, err = engine.acquireConnLock(context.Background(), dialect, "xorm_test_lock", true)
+	assert.NoError(t, err)
+	assert.Nil(t, lock)
+	assert.EqualValues(t, []time.Duration{-1}, dialect.timeouts)
+
+	// the deadline of the context is the timeout of the wait
+	dialect.timeouts = nil
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = engine.acquireConnLock(ctx, dialect, "xorm_test_lock", true)
+	assert.EqualValues(t, context.DeadlineExceeded, err)
+	assert.True(t, len(dialect.timeouts) > 0)
+	assert.True(t, dialect.timeouts[0] > 0 && dialect.timeouts[0] <= 100*time.Millisecond)
+}
+
+func TestAdvisoryLockLease(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+
+	var engine *Engine
+	switch e := testEngine.(type) {
+	case *Engine:
+		engine = e
+	case *EngineGroup:
+		engine = e.Master()
+	}
+	if _, ok := engine.dialect.(advisoryLockDialect); ok {
+		t.Skip("the locks are held by the connections")
+	}
+
+	// the expired lease of others is taken over
+	assert.NoError(t, engine.syncLeaseTable())
+	_, err := engine.Where("lock_name = ?", "xorm_test_lease").Delete(new(advisoryLease))
+	assert.NoError(t, err)
+	_, err = engine.Insert(&advisoryLease{
+		Name:      "xorm_test_lease",
+		Owner:     "other",
+		ExpiresAt: time.Now().Add(-time.Second).UnixNano(),
+	})
+	assert.NoError(t, err)
+
+	lock, acquired, err := engine.TryAdvisoryLock(context.Background(), "xorm_test_lease")
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+
+	var lease advisoryLease
+	has, err := engine.Where("lock_name = ?", "xorm_test_lease").Get(&lease)
+	assert.NoError(t, err)
+	assert.True(t, has)
+	assert.NotEqual(t, "other", lease.Owner)
+
+	// the lock is lost if the lease is deleted
+	_, err = engine.Where("lock_name = ?", "xorm_test_lease").Delete(new(advisoryLease))
+	assert.NoError(t, err)
+	assert.EqualValues(t, ErrLockLost, lock.(advisoryLock).check(context.Background()))
+	assert.NoError(t, lock.Unlock())
+
+	// the lock is lost once the safety margin of the lease passes without renewal
+	var expired = leaseLock{
+		engine:    engine,
+		name:      "xorm_test_lease",
+		owner:     "expired",
+		renewedAt: time.Now().Add(-advisoryLeaseSafety),
+	}
+	expired.start()
+	select {
+	case <-expired.lost():
+	case <-time.After(time.Second):
+		t.Fatal("the lease should be lost")
+	}
+	assert.EqualValues(t, ErrLockLost, expired.check(context.Background()))
+	assert.NoError(t, expired.Unlock())
+}
+
+// leaderTestLock is held until it's marked lost
+type leaderTestLock struct {
+	lostCtx context.Context
+}
+
+func (lock *leaderTestLock) Unlock() error {
+	return nil
+}
+
+func (lock *leaderTestLock) check(ctx context.Context) error {
+	return nil
+}
+
+func (lock *leaderTestLock) lost() <-chan struct{} {
+	return lock.lostCtx.Done()
+}
+
+func TestLeaderElectorLost(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+
+	var engine *Engine
+	switch e := testEngine.(type) {
+	case *Engine:
+		engine = e
+	case *EngineGroup:
+		engine = e.Master()
+	}
+
+	elector := engine.NewLeaderElector("xorm_test_leader", 0)
+	assert.EqualValues(t, defaultLeaderInterval, elector.interval)
+
+	// the loss of the lock is reported without waiting for the next check
+	lostCtx, setLost := context.WithCancel(context.Background())
+	var lock = &leaderTestLock{lostCtx}
+	elector.lock = lock
+	elector.leading, elector.cancel = context.WithCancel(context.Background())
+	go elector.keepLeading(lock, elector.leading, elector.cancel)
+	assert.True(t, elector.IsLeader())
+
+	setLost()
+	select {
+	case <-elector.leading.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the leadership should be lost")
+	}
+	assert.False(t, elector.IsLeader())
+}
+
+func TestLeaderElector(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+
+	var engine *Engine
+	switch e := testEngine.(type) {
+	case *Engine:
+		engine = e
+	case *EngineGroup:
+		engine = e.Master()
+	}
+
+	e1 := engine.NewLeaderElector("xorm_test_leader", 50*time.Millisecond)
+	e2 := engine.NewLeaderElector("xorm_test_leader", 50*time.Millisecond)
+
+	lost, err := e1.Campaign(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, e1.IsLeader())
+
+	again, err := e1.Campaign(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, lost == again)
+
+	timeout, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	_, err = e2.Campaign(timeout)
+	cancel()
+	assert.Error(t, err)
+	assert.False(t, e2.IsLeader())
+
+	if _, ok := engine.dialect.(advisoryLockDialect); !ok {
+		// the leadership is lost when the lease is taken away
+		_, err = engine.Where("lock_name = ?", "xorm_test_leader").Delete(new(advisoryLease))
+		assert.NoError(t, err)
+		select {
+		case <-lost:
+		case <-time.After(time.Second):
+			t.Fatal("the leadership should be lost")
+		}
+		assert.False(t, e1.IsLeader())
+	} else {
+		assert.NoError(t, e1.Resign())
+		select {
+		case <-lost:
+		default:
+			t.Fatal("the leadership should be resigned")
+		}
+	}
+
+	lost, err = e2.Campaign(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, e2.IsLeader())
+	assert.NoError(t, e2.Resign())
+	assert.False(t, e2.IsLeader())
+	select {
+	case <-lost:
+	default:
+		t.Fatal("the leadership should be resigned")
+	}
+	assert.NoError(t, e2.Resign())
+}
@@ -16,7 +16,7 @@ func (engine *Engine) SetConnMaxLifetime(d time.Duration) {
 // SetConnMaxLifetime sets the maximum amount of time a connection may be reused.
 func (eg *EngineGroup) SetConnMaxLifetime(d time.Duration) {
 	eg.Engine.SetConnMaxLifetime(d)
-	for i := 0; i < len(eg.slaves); i++ {
-		eg.slaves[i].SetConnMaxLifetime(d)
+	for _, slave := range eg.Slaves() {
+		slave.SetConnMaxLifetime(d)
 	}
 }
@@ -0,0 +1,218 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-xorm/core"
+	"github.com/lib/pq"
+)
+
+const (
+	// the interval of reconnecting the listener, it's doubled after every failed
+	// attempt up to the max one
+	listenMinReconnectInterval = time.Second
+	listenMaxReconnectInterval = time.Minute
+)
+
+// Notification is a notification of postgres received by Listen
+type Notification struct {
+	Channel string
+	Payload string
+	PID     int // the process id of the notifying backend
+}
+
+// Listener listens to the channels of postgres, it's like time.Ticker that the
+// notifications are received from C and C is not closed when the listener is
+// closed. Done should be selected with C to know when the listener is closed.
+type Listener struct {
+	// C receives the notifications, it's nil for ListenCacheInvalidation
+	C <-chan Notification
+
+	engine    *Engine
+	listener  *pq.Listener
+	ctx       context.Context // done when the listener is closed
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+}
+
+// Listen listens to the channels by LISTEN on postgres, the listener connects
+// by the data source of the engine and reconnects if the connection is broken.
+// The notifications sent while the listener is disconnected are lost. They
+// should be received promptly, or the following notifications are blocked.
+// The listener is closed by Close or when the engine is closed.
+func (engine *Engine) Listen(channels ...string) (*Listener, error) {
+	var notifications = make(chan Notification, 32)
+	l, err := engine.listen(channels, func(l *Listener, n *pq.Notification) {
+		if n == nil {
+			return
+		}
+		select {
+		case notifications <- Notification{Channel: n.Channel, Payload: n.Extra, PID: n.BePid}:
+		case <-l.ctx.Done():
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	l.C = notifications
+	return l, nil
+}
+
+// ListenCacheInvalidation listens to the channel and clears the cache of the
+// table named by the payload of every notification, so the caches of the engines
+// on several nodes are kept consistent if the writes are notified by Notify or a
+// trigger such as pg_notify('channel', TG_TABLE_NAME). The caches of all the
+// tables are cleared after the listener reconnects since the notifications sent
+// while it's disconnected are lost.
+func (engine *Engine) ListenCacheInvalidation(channel string) (*Listener, error) {
+	return engine.listen([]string{channel}, func(_ *Listener, n *pq.Notification) {
+		if n == nil {
+			engine.invalidateCache("")
+		} else if n.Extra != "" {
+			engine.invalidateCache(n.Extra)
+		}
+	})
+}
+
+// listen starts a listener of the channels, handle is called with every
+// notification and with nil after the listener reconnects
+func (engine *Engine) listen(channels []string, handle func(*Listener, *pq.Notification)) (*Listener, error) {
+	if engine.dialect.DBType() != core.POSTGRES {
+		return nil, ErrNotifyNotSupported
+	}
+	if len(channels) == 0 {
+		return nil, errors.New("no channel to listen")
+	}
+
+	// the listener keeps connecting until it's connected, so Listen blocks forever
+	// if the database could not be connected
+	if err := engine.Ping(); err != nil {
+		return nil, err
+	}
+
+	var names = strings.Join(channels, ", ")
+	listener := pq.NewListener(engine.DataSourceName(), listenMinReconnectInterval, listenMaxReconnectInterval,
+		func(event pq.ListenerEventType, err error) {
+			switch event {
+			case pq.ListenerEventConnected:
+				engine.logger.Infof("[listen] listening to %s", names)
+			case pq.ListenerEventDisconnected:
+				engine.logger.Warnf("[listen] the listener of %s is disconnected: %v", names, err)
+			case pq.ListenerEventReconnected:
+				engine.logger.Infof("[listen] the listener of %s is reconnected, the notifications may be lost", names)
+			case pq.ListenerEventConnectionAttemptFailed:
+				engine.logger.Errorf("[listen] the listener of %s failed to connect: %v", names, err)
+			}
+		})
+	for _, channel := range channels {
+		if err := listener.Listen(channel); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+
+	var l = Listener{engine: engine, listener: listener}
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+	engine.listenerMutex.Lock()
+	engine.listeners = append(engine.listeners, &l)
+	engine.listenerMutex.Unlock()
+
+	go func() {
+		for n := range listener.Notify {
+			handle(&l, n)
+		}
+		l.cancel()
+	}()
+	return &l, nil
+}
+
+// Done returns a channel which is closed when the listener is closed
+func (l *Listener) Done() <-chan struct{} {
+	return l.ctx.Done()
+}
+
+// Close stops listening, it could be called more than once
+func (l *Listener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		l.cancel()
+		l.engine.removeListener(l)
+		err = l.listener.Close()
+	})
+	return err
+}
+
+// removeListener removes the closed listener from the engine
+func (engine *Engine) removeListener(l *Listener) {
+	engine.listenerMutex.Lock()
+	defer engine.listenerMutex.Unlock()
+	for i, listener := range engine.listeners {
+		if listener == l {
+			engine.listeners = append(engine.listeners[:i], engine.listeners[i+1:]...)
+			return
+		}
+	}
+}
+
+// closeListeners closes the listeners of the engine
+func (engine *Engine) closeListeners() {
+	engine.listenerMutex.Lock()
+	var listeners = engine.listeners
+	engine.listeners = nil
+	engine.listenerMutex.Unlock()
+
+	for _, l := range listeners {
+		l.Close()
+	}
+}
+
+// invalidateCache clears the ids and the beans of the table from the cachers,
+// the name is qualified by the schema of the engine if it has no schema. The
+// caches of all the tables are cleared if the name is empty.
+func (engine *Engine) invalidateCache(tableName string) {
+	var name, key = tableName, engine.tbNameWithSchema(tableName)
+	if idx := strings.LastIndex(tableName, "."); idx >= 0 {
+		name = tableName[idx+1:]
+	}
+
+	var cachers = make(map[core.Cacher][]string)
+	engine.mutex.RLock()
+	for _, table := range engine.Tables {
+		if table.Cacher == nil {
+			continue
+		}
+		if tableName == "" {
+			cachers[table.Cacher] = append(cachers[table.Cacher], engine.tbNameWithSchema(table.Name))
+		} else if table.Name == name {
+			cachers[table.Cacher] = []string{key}
+		}
+	}
+	engine.mutex.RUnlock()
+	if tableName != "" && engine.Cacher != nil {
+		// the table may not be mapped yet
+		cachers[engine.Cacher] = []string{key}
+	}
+
+	for cacher, tables := range cachers {
+		for _, table := range tables {
+			engine.logger.Debug("[cache] clear table:", table)
+			cacher.ClearIds(table)
+			cacher.ClearBeans(table)
+		}
+	}
+}
+
+// Notify sends the notification with the payload to the channel by pg_notify
+func (engine *Engine) Notify(channel, payload string) error {
+	session := engine.NewSession()
+	defer session.Close()
+	return session.Notify(channel, payload)
+}
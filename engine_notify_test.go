@@ -0,0 +1,129 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-xorm/core"
+	"github.com/stretchr/testify/assert"
+)
+
+type NotifyCacheStruct struct {
+	Id   int64
+	Name string
+}
+
+func TestNotify(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+
+	if testEngine.Dialect().DBType() != core.POSTGRES {
+		_, err := testEngine.Listen("xorm_test")
+		assert.EqualValues(t, ErrNotifyNotSupported, err)
+		assert.EqualValues(t, ErrNotifyNotSupported, testEngine.Notify("xorm_test", "payload"))
+		return
+	}
+
+	listener, err := testEngine.Listen("xorm_test", "xorm_test_other")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	assert.NoError(t, testEngine.Notify("xorm_test", "payload"))
+	select {
+	case n := <-listener.C:
+		assert.EqualValues(t, "xorm_test", n.Channel)
+		assert.EqualValues(t, "payload", n.Payload)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the notification should be received")
+	}
+
+	// the notification of a transaction is sent after it's committed
+	session := testEngine.NewSession()
+	defer session.Close()
+	assert.NoError(t, session.Begin())
+	assert.NoError(t, session.Notify("xorm_test_other", "rollback"))
+	assert.NoError(t, session.Rollback())
+	assert.NoError(t, session.Begin())
+	assert.NoError(t, session.Notify("xorm_test_other", "commit"))
+	assert.NoError(t, session.Commit())
+	select {
+	case n := <-listener.C:
+		assert.EqualValues(t, "xorm_test_other", n.Channel)
+		assert.EqualValues(t, "commit", n.Payload)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the notification should be received")
+	}
+
+	// the notifications are not received after the listener is closed
+	assert.NoError(t, listener.Close())
+	assert.NoError(t, listener.Close())
+	select {
+	case <-listener.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the listener should be closed")
+	}
+	assert.NoError(t, testEngine.Notify("xorm_test", "closed"))
+	select {
+	case n := <-listener.C:
+		t.Fatalf("the notification %v should not be received", n)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNotifyCacheInvalidation(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+
+	var engine *Engine
+	switch e := testEngine.(type) {
+	case *Engine:
+		engine = e
+	case *EngineGroup:
+		engine = e.Master()
+	}
+
+	cacher := NewLRUCacher2(NewMemoryStore(), time.Hour, 10000)
+	assert.NoError(t, engine.MapCacher(new(NotifyCacheStruct), cacher))
+	defer engine.MapCacher(new(NotifyCacheStruct), engine.GetDefaultCacher())
+	assertSync(t, new(NotifyCacheStruct))
+
+	tableName := engine.tbNameWithSchema(engine.TableInfo(new(NotifyCacheStruct)).Name)
+	fill := func() {
+		cacher.PutIds(tableName, "sql", []core.PK{{int64(1)}})
+		if cacher.GetBean(tableName, "1") == nil {
+			cacher.PutBean(tableName, "1", &NotifyCacheStruct{Id: 1})
+		}
+	}
+
+	fill()
+	engine.invalidateCache(tableName)
+	assert.Nil(t, cacher.GetIds(tableName, "sql"))
+	assert.Nil(t, cacher.GetBean(tableName, "1"))
+
+	fill()
+	engine.invalidateCache("other")
+	assert.NotNil(t, cacher.GetBean(tableName, "1"))
+
+	// all the tables are cleared after the listener reconnects
+	engine.invalidateCache("")
+	assert.Nil(t, cacher.GetIds(tableName, "sql"))
+	assert.Nil(t, cacher.GetBean(tableName, "1"))
+
+	if engine.dialect.DBType() != core.POSTGRES {
+		_, err := engine.ListenCacheInvalidation("xorm_test_cache")
+		assert.EqualValues(t, ErrNotifyNotSupported, err)
+		return
+	}
+
+	listener, err := engine.ListenCacheInvalidation("xorm_test_cache")
+	assert.NoError(t, err)
+	defer listener.Close()
+	fill()
+	assert.NoError(t, engine.Notify("xorm_test_cache", tableName))
+	for i := 0; i < 50 && cacher.GetBean(tableName, "1") != nil; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.Nil(t, cacher.GetBean(tableName, "1"))
+}
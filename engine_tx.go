@@ -0,0 +1,152 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"database/sql"
+	"time"
+)
+
+// retryableDialect is implemented by the dialects which could tell whether
+// a failed transaction, e.g. a deadlock or a serialization failure, could be retried
+type retryableDialect interface {
+	IsRetryableError(err error) bool
+}
+
+type txConfig struct {
+	txOptions  *sql.TxOptions
+	maxRetries int
+	backoff    func(attempt int) time.Duration
+}
+
+// TxOption defines an option of Transaction
+type TxOption func(*txConfig)
+
+// TxOptions sets the isolation level and read only of the transaction
+func TxOptions(opts *sql.TxOptions) TxOption {
+	return func(cfg *txConfig) {
+		cfg.txOptions = opts
+	}
+}
+
+// TxRetry sets the max retry times when the transaction failed because of
+// a deadlock or a serialization failure, default is no retry
+func TxRetry(maxRetries int) TxOption {
+	return func(cfg *txConfig) {
+		cfg.maxRetries = maxRetries
+	}
+}
+
+// TxBackoff sets the function which returns the duration to wait before
+// the attempt'th retry, the attempt begins from 1
+func TxBackoff(backoff func(attempt int) time.Duration) TxOption {
+	return func(cfg *txConfig) {
+		cfg.backoff = backoff
+	}
+}
+
+// ExponentialBackoff returns a backoff which doubles the duration from base
+// on every retry but never exceeds max
+func ExponentialBackoff(base, max time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		d := base
+		for i := 1; i < attempt && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		return d
+	}
+}
+
+// Transaction executes fn in a transaction on a new session, the transaction will
+// be committed if fn returns nil, otherwise it will be rollbacked.
+func (engine *Engine) Transaction(fn func(*Session) error, opts ...TxOption) error {
+	session := engine.NewSession()
+	defer session.Close()
+	return session.Transaction(fn, opts...)
+}
+
+// Transaction executes fn in a transaction on the master
+func (eg *EngineGroup) Transaction(fn func(*Session) error, opts ...TxOption) error {
+	return eg.Master().Transaction(fn, opts...)
+}
+
+// Transaction executes fn in a transaction, the transaction will be committed if
+// fn returns nil, and rollbacked if fn returns an error or panics. If the error is
+// a deadlock or a serialization failure, the whole transaction will be retried as
+// the TxRetry option. If the session is already in a transaction, fn will be
+// executed in a savepoint and never be retried.
+func (session *Session) Transaction(fn func(*Session) error, opts ...TxOption) error {
+	if session.isAutoClose {
+		defer session.Close()
+		session.isAutoClose = false
+	}
+
+	var cfg txConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if !session.isAutoCommit {
+		return session.runTransaction(fn, nil)
+	}
+
+	dialect, retryable := session.engine.dialect.(retryableDialect)
+	for attempt := 0; ; attempt++ {
+		err := session.runTransaction(fn, cfg.txOptions)
+		if err == nil || !retryable || attempt >= cfg.maxRetries || !dialect.IsRetryableError(err) {
+			return err
+		}
+
+		session.engine.logger.Warnf("[SQL] transaction failed and will be retried(%d/%d): %v", attempt+1, cfg.maxRetries, err)
+		if cfg.backoff != nil {
+			if d := cfg.backoff(attempt + 1); d > 0 {
+				timer := time.NewTimer(d)
+				select {
+				case <-session.ctx.Done():
+					timer.Stop()
+					return session.ctx.Err()
+				case <-timer.C:
+				}
+			}
+		}
+	}
+}
+
+// txScope is a transaction or a savepoint
+type txScope interface {
+	Commit() error
+	Rollback() error
+}
+
+func (session *Session) runTransaction(fn func(*Session) error, opts *sql.TxOptions) (err error) {
+	var scope txScope = session
+	if session.isAutoCommit {
+		if err = session.BeginTx(opts); err != nil {
+			return err
+		}
+	} else if scope, err = session.SavePoint(); err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			if rbErr := scope.Rollback(); rbErr != nil {
+				session.engine.logger.Errorf("[SQL] rollback failed: %v", rbErr)
+			}
+			panic(p)
+		}
+	}()
+
+	if err = fn(session); err != nil {
+		if rbErr := scope.Rollback(); rbErr != nil {
+			session.engine.logger.Errorf("[SQL] rollback failed: %v", rbErr)
+		}
+		return err
+	}
+	return scope.Commit()
+}
@@ -0,0 +1,168 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-xorm/core"
+	"github.com/stretchr/testify/assert"
+)
+
+type TxHelperStruct struct {
+	Id   int64
+	Name string
+}
+
+func TestEngineTransaction(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+	assertSync(t, new(TxHelperStruct))
+
+	err := testEngine.Transaction(func(session *Session) error {
+		_, err := session.Insert(&TxHelperStruct{Name: "commit"})
+		return err
+	})
+	assert.NoError(t, err)
+
+	errRollback := errors.New("rollback")
+	err = testEngine.Transaction(func(session *Session) error {
+		if _, err := session.Insert(&TxHelperStruct{Name: "rollback"}); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	assert.EqualValues(t, errRollback, err)
+
+	assert.Panics(t, func() {
+		testEngine.Transaction(func(session *Session) error {
+			if _, err := session.Insert(&TxHelperStruct{Name: "panic"}); err != nil {
+				return err
+			}
+			panic("panic")
+		})
+	})
+
+	var records []TxHelperStruct
+	assert.NoError(t, testEngine.Find(&records))
+	assert.EqualValues(t, 1, len(records))
+	assert.EqualValues(t, "commit", records[0].Name)
+}
+
+type retryTestDialect struct {
+	core.Dialect
+	retryable error
+}
+
+func (db *retryTestDialect) IsRetryableError(err error) bool {
+	return err == db.retryable
+}
+
+type TxRetryStruct struct {
+	Id   int64
+	Name string
+}
+
+func TestEngineTransactionRetry(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+	assertSync(t, new(TxRetryStruct))
+
+	var engine *Engine
+	switch e := testEngine.(type) {
+	case *Engine:
+		engine = e
+	case *EngineGroup:
+		engine = e.Master()
+	}
+
+	errRetry := errors.New("retry")
+	dialect := engine.dialect
+	engine.dialect = &retryTestDialect{dialect, errRetry}
+	defer func() {
+		engine.dialect = dialect
+	}()
+
+	var times int
+	err := engine.Transaction(func(session *Session) error {
+		times++
+		if _, err := session.Insert(&TxRetryStruct{Name: "retry"}); err != nil {
+			return err
+		}
+		if times < 3 {
+			return errRetry
+		}
+		return nil
+	}, TxRetry(3), TxBackoff(ExponentialBackoff(time.Millisecond, 10*time.Millisecond)))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, times)
+
+	times = 0
+	err = engine.Transaction(func(session *Session) error {
+		times++
+		return errRetry
+	}, TxRetry(1))
+	assert.EqualValues(t, errRetry, err)
+	assert.EqualValues(t, 2, times)
+
+	cnt, err := testEngine.Count(new(TxRetryStruct))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+
+	// the processors queued by the attempt whose commit failed are not called
+	engine.dialect = &retryTestDialect{dialect, sql.ErrTxDone}
+	var called int
+	times = 0
+	err = engine.Transaction(func(session *Session) error {
+		times++
+		_, err := session.After(func(interface{}) {
+			called++
+		}).Insert(&TxRetryStruct{Name: "commit"})
+		if err == nil && times == 1 {
+			// the commit fails since the transaction is done
+			err = session.tx.Rollback()
+		}
+		return err
+	}, TxRetry(1))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, times)
+	assert.EqualValues(t, 1, called)
+}
+
+type TxNestedStruct struct {
+	Id   int64
+	Name string
+}
+
+func TestSessionTransactionNested(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+	assertSync(t, new(TxNestedStruct))
+
+	if _, ok := testEngine.Dialect().(savePointDialect); !ok {
+		t.Skip("savepoint is not supported")
+	}
+
+	errInner := errors.New("inner")
+	err := testEngine.Transaction(func(session *Session) error {
+		if _, err := session.Insert(&TxNestedStruct{Name: "outer"}); err != nil {
+			return err
+		}
+		err := session.Transaction(func(session *Session) error {
+			if _, err := session.Insert(&TxNestedStruct{Name: "inner"}); err != nil {
+				return err
+			}
+			return errInner
+		})
+		assert.EqualValues(t, errInner, err)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	var records []TxNestedStruct
+	assert.NoError(t, testEngine.Find(&records))
+	assert.EqualValues(t, 1, len(records))
+	assert.EqualValues(t, "outer", records[0].Name)
+}
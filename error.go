@@ -6,6 +6,9 @@ package xorm
 
 import (
 	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
 )
 
 var (
@@ -25,4 +28,135 @@ var (
 	ErrNotImplemented = errors.New("Not implemented")
 	// ErrConditionType condition type unsupported
 	ErrConditionType = errors.New("Unsupported conditon type")
+	// ErrInvalidCursor the cursor of pagination is malformed, not signed by the
+	// engine or made for another ordering
+	ErrInvalidCursor = errors.New("Invalid pagination cursor")
+	// ErrLockNotSupported the mode of the row locking is not supported by the dialect
+	ErrLockNotSupported = errors.New("Row locking mode not supported")
+	// ErrLockLost the advisory lock is not held anymore, e.g. the connection holding
+	// it is broken or its lease has been taken over
+	ErrLockLost = errors.New("Advisory lock lost")
+	// ErrNotifyNotSupported LISTEN and NOTIFY are only supported by postgres
+	ErrNotifyNotSupported = errors.New("Notification not supported")
 )
+
+// ErrorKind is the kind of a DBError
+type ErrorKind int
+
+// the kinds of DBError
+const (
+	UnknownError ErrorKind = iota
+	UniqueViolation
+	ForeignKeyViolation
+	NotNullViolation
+	Deadlock
+)
+
+var errorKindNames = map[ErrorKind]string{
+	UnknownError:        "unknown error",
+	UniqueViolation:     "unique violation",
+	ForeignKeyViolation: "foreign key violation",
+	NotNullViolation:    "not null violation",
+	Deadlock:            "deadlock",
+}
+
+func (kind ErrorKind) String() string {
+	if name, ok := errorKindNames[kind]; ok {
+		return name
+	}
+	return errorKindNames[UnknownError]
+}
+
+var (
+	// ErrUniqueViolation could be used with errors.Is to check if an error is a unique violation
+	ErrUniqueViolation = &DBError{Kind: UniqueViolation}
+	// ErrForeignKeyViolation could be used with errors.Is to check if an error is a foreign key violation
+	ErrForeignKeyViolation = &DBError{Kind: ForeignKeyViolation}
+	// ErrNotNullViolation could be used with errors.Is to check if an error is a not null violation
+	ErrNotNullViolation = &DBError{Kind: NotNullViolation}
+	// ErrDeadlock could be used with errors.Is to check if an error is a deadlock
+	ErrDeadlock = &DBError{Kind: Deadlock}
+)
+
+// DBError is the error translated from the driver's error by the dialect. The
+// Constraint, Table and Column will be empty if the driver doesn't report them.
+// The Table and Column of a foreign key violation are the referencing ones.
+type DBError struct {
+	Kind       ErrorKind
+	Constraint string
+	Table      string
+	Column     string
+	Err        error
+}
+
+func (e *DBError) Error() string {
+	if e.Err == nil {
+		return e.Kind.String()
+	}
+	return e.Err.Error()
+}
+
+// Unwrap returns the driver's error
+func (e *DBError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is a DBError with the same kind
+func (e *DBError) Is(target error) bool {
+	t, ok := target.(*DBError)
+	return ok && t.Kind == e.Kind
+}
+
+// errorTranslator is implemented by the dialects which could translate the
+// driver's errors, nil should be returned if the error is not recognized
+type errorTranslator interface {
+	TranslateError(err error) *DBError
+}
+
+func (engine *Engine) translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*DBError); ok {
+		return err
+	}
+	if translator, ok := engine.dialect.(errorTranslator); ok {
+		if dbErr := translator.TranslateError(err); dbErr != nil {
+			dbErr.Err = err
+			return dbErr
+		}
+	}
+	return err
+}
+
+// driverErrorField returns the value of the named field of a driver's error,
+// e.g. Number of *mysql.MySQLError or Code of *pq.Error, so that the dialects
+// could check them without importing the drivers. The wrapped errors will be
+// checked one by one until the field is found.
+func driverErrorField(err error, fieldName string) string {
+	for ; err != nil; err = errors.Unwrap(err) {
+		v := reflect.ValueOf(err)
+		if v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			continue
+		}
+		field := v.FieldByName(fieldName)
+		if !field.IsValid() {
+			continue
+		}
+		switch field.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return strconv.FormatInt(field.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return strconv.FormatUint(field.Uint(), 10)
+		case reflect.String:
+			return field.String()
+		}
+		if field.CanInterface() {
+			return fmt.Sprint(field.Interface())
+		}
+	}
+	return ""
+}
@@ -0,0 +1,128 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUniqueViolationError(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+
+	type UniqueErrorStruct struct {
+		Id   int64
+		Name string `xorm:"unique"`
+	}
+
+	assertSync(t, new(UniqueErrorStruct))
+
+	_, err := testEngine.Insert(&UniqueErrorStruct{Name: "1"})
+	assert.NoError(t, err)
+
+	_, err = testEngine.Insert(&UniqueErrorStruct{Name: "1"})
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, ErrUniqueViolation))
+	assert.False(t, errors.Is(err, ErrNotNullViolation))
+
+	var dbErr *DBError
+	assert.True(t, errors.As(err, &dbErr))
+	assert.EqualValues(t, UniqueViolation, dbErr.Kind)
+	assert.NotNil(t, errors.Unwrap(err))
+}
+
+type fakeMySQLError struct {
+	Number  uint16
+	Message string
+}
+
+func (e *fakeMySQLError) Error() string {
+	return fmt.Sprintf("Error %d: %s", e.Number, e.Message)
+}
+
+type fakePqError struct {
+	Code       string
+	Message    string
+	Table      string
+	Column     string
+	Constraint string
+}
+
+func (e *fakePqError) Error() string {
+	return "pq: " + e.Message
+}
+
+func TestTranslateError(t *testing.T) {
+	var kases = []struct {
+		dialect    errorTranslator
+		err        error
+		kind       ErrorKind
+		constraint string
+		table      string
+		column     string
+	}{
+		{
+			&mysql{},
+			&fakeMySQLError{1062, "Duplicate entry 'a' for key 'UQE_user_name'"},
+			UniqueViolation, "UQE_user_name", "", "",
+		},
+		{
+			&mysql{},
+			&fakeMySQLError{1452, "Cannot add or update a child row: a foreign key constraint fails (`db`.`order`, CONSTRAINT `fk_user` FOREIGN KEY (`user_id`) REFERENCES `user` (`id`))"},
+			ForeignKeyViolation, "fk_user", "order", "user_id",
+		},
+		{
+			&mysql{},
+			&fakeMySQLError{1048, "Column 'name' cannot be null"},
+			NotNullViolation, "", "", "name",
+		},
+		{
+			&mysql{},
+			&fakeMySQLError{1213, "Deadlock found when trying to get lock; try restarting transaction"},
+			Deadlock, "", "", "",
+		},
+		{
+			&postgres{},
+			&fakePqError{"23505", "duplicate key value violates unique constraint", "user", "", "UQE_user_name"},
+			UniqueViolation, "UQE_user_name", "user", "",
+		},
+		{
+			&postgres{},
+			&fakePqError{"23502", "null value in column \"name\" violates not-null constraint", "user", "name", ""},
+			NotNullViolation, "", "user", "name",
+		},
+		{
+			&mssql{},
+			&fakeMySQLError{547, `The INSERT statement conflicted with the FOREIGN KEY constraint "fk_user". The conflict occurred in database "db", table "dbo.user", column 'id'.`},
+			ForeignKeyViolation, "fk_user", "", "",
+		},
+		{
+			&mssql{},
+			&fakeMySQLError{547, `The DELETE statement conflicted with the REFERENCE constraint "fk_user". The conflict occurred in database "db", table "dbo.order", column 'user_id'.`},
+			ForeignKeyViolation, "fk_user", "order", "user_id",
+		},
+		{
+			&oracle{},
+			errors.New(`ORA-01400: cannot insert NULL into ("SCOTT"."USER"."NAME")`),
+			NotNullViolation, "", "USER", "NAME",
+		},
+	}
+
+	for _, kase := range kases {
+		dbErr := kase.dialect.TranslateError(kase.err)
+		if assert.NotNil(t, dbErr, kase.err.Error()) {
+			assert.EqualValues(t, kase.kind, dbErr.Kind)
+			assert.EqualValues(t, kase.constraint, dbErr.Constraint)
+			assert.EqualValues(t, kase.table, dbErr.Table)
+			assert.EqualValues(t, kase.column, dbErr.Column)
+		}
+	}
+
+	assert.Nil(t, (&mysql{}).TranslateError(&fakeMySQLError{1045, "Access denied"}))
+	assert.Nil(t, (&postgres{}).TranslateError(errors.New("unknown")))
+}
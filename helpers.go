@@ -449,6 +449,14 @@ func genCols(table *core.Table, session *Session, bean interface{}, useCol bool,
 	return colNames, args, nil
 }
 
+// tableNameNoSchema returns the table name without the schema
+func tableNameNoSchema(tableName string) string {
+	if idx := strings.LastIndex(tableName, "."); idx >= 0 {
+		return tableName[idx+1:]
+	}
+	return tableName
+}
+
 func indexName(tableName, idxName string) string {
 	return fmt.Sprintf("IDX_%v_%v", tableName, idxName)
 }
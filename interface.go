@@ -5,6 +5,7 @@
 package xorm
 
 import (
+	"context"
 	"database/sql"
 	"reflect"
 	"time"
@@ -16,10 +17,18 @@ import (
 type Interface interface {
 	AllCols() *Session
 	Alias(alias string) *Session
+	AfterCursor(cursor string) *Session
+	Aggregate(rowsSlicePtr interface{}) error
 	Asc(colNames ...string) *Session
+	Avg(bean interface{}, colName string) (float64, error)
+	BeforeCursor(cursor string) *Session
 	BufferSize(size int) *Session
+	BulkCopy(rowsSlicePtr interface{}) (int64, error)
+	CascadeRelations(trueOrFalse ...bool) *Session
 	Cols(columns ...string) *Session
+	Context(ctx context.Context) *Session
 	Count(...interface{}) (int64, error)
+	CountDistinct(bean interface{}, colNames ...string) (int64, error)
 	CreateIndexes(bean interface{}) error
 	CreateUniques(bean interface{}) error
 	Decr(column string, arg ...interface{}) *Session
@@ -29,7 +38,10 @@ type Interface interface {
 	DropIndexes(bean interface{}) error
 	Exec(string, ...interface{}) (sql.Result, error)
 	Exist(bean ...interface{}) (bool, error)
+	Exists(sub interface{}) *Session
 	Find(interface{}, ...interface{}) error
+	FindAndCount(interface{}, ...interface{}) (int64, error)
+	From(sub interface{}, alias string) *Session
 	Get(interface{}) (bool, error)
 	GroupBy(keys string) *Session
 	ID(interface{}) *Session
@@ -41,16 +53,25 @@ type Interface interface {
 	IsTableExist(beanOrTableName interface{}) (bool, error)
 	Iterate(interface{}, IterFunc) error
 	Limit(int, ...int) *Session
+	Max(bean interface{}, colName string, res interface{}) (bool, error)
+	Min(bean interface{}, colName string, res interface{}) (bool, error)
 	NoAutoCondition(...bool) *Session
+	NotExists(sub interface{}) *Session
 	NotIn(string, ...interface{}) *Session
+	Notify(channel, payload string) error
 	Join(joinOperator string, tablename interface{}, condition string, args ...interface{}) *Session
 	Omit(columns ...string) *Session
+	OnConflict(columns ...string) *Session
 	OrderBy(order string) *Session
+	Paginate(size int) *Session
 	Ping() error
+	Preload(fieldNames ...string) *Session
 	Query(sqlOrAgrs ...interface{}) (resultsSlice []map[string][]byte, err error)
 	QueryInterface(sqlorArgs ...interface{}) ([]map[string]interface{}, error)
 	QueryString(sqlorArgs ...interface{}) ([]map[string]string, error)
+	Returning(columns ...string) *Session
 	Rows(bean interface{}) (*Rows, error)
+	Schema(name string) *Session
 	SetExpr(string, string) *Session
 	SQL(interface{}, ...interface{}) *Session
 	Sum(bean interface{}, colName string) (float64, error)
@@ -58,16 +79,22 @@ type Interface interface {
 	Sums(bean interface{}, colNames ...string) ([]float64, error)
 	SumsInt(bean interface{}, colNames ...string) ([]int64, error)
 	Table(tableNameOrBean interface{}) *Session
+	Transaction(fn func(*Session) error, opts ...TxOption) error
 	Unscoped() *Session
 	Update(bean interface{}, condiBeans ...interface{}) (int64, error)
 	UseBool(...string) *Session
+	UseMaster() *Session
+	UseSlave(slave *Engine) *Session
 	Where(interface{}, ...interface{}) *Session
+	With(name string, sub interface{}) *Session
+	WithRecursive(name string, anchor, recursive interface{}) *Session
 }
 
 // EngineInterface defines the interface which Engine, EngineGroup will implementate.
 type EngineInterface interface {
 	Interface
 
+	AdvisoryLock(ctx context.Context, key string) (Unlocker, error)
 	Before(func(interface{})) *Session
 	Charset(charset string) *Session
 	CreateTables(...interface{}) error
@@ -80,12 +107,18 @@ type EngineInterface interface {
 	GetTableMapper() core.IMapper
 	GetTZDatabase() *time.Location
 	GetTZLocation() *time.Location
+	Listen(channels ...string) (*Listener, error)
+	ListenCacheInvalidation(channel string) (*Listener, error)
+	NewLeaderElector(key string, interval time.Duration) *LeaderElector
 	NewSession() *Session
 	NoAutoTime() *Session
+	PingContext(context.Context) error
 	Quote(string) string
+	SetCursorKey(key []byte)
 	SetDefaultCacher(core.Cacher)
 	SetLogLevel(core.LogLevel)
 	SetMapper(core.IMapper)
+	SetSchema(string)
 	SetTZDatabase(tz *time.Location)
 	SetTZLocation(tz *time.Location)
 	ShowSQL(show ...bool)
@@ -93,6 +126,7 @@ type EngineInterface interface {
 	Sync2(...interface{}) error
 	StoreEngine(storeEngine string) *Session
 	TableInfo(bean interface{}) *Table
+	TryAdvisoryLock(ctx context.Context, key string) (Unlocker, bool, error)
 	UnMapType(reflect.Type)
 }
 
@@ -5,6 +5,7 @@
 package xorm
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -28,6 +29,9 @@ type Session struct {
 	isCommitedOrRollbacked bool
 	isAutoClose            bool
 
+	// the savepoints of the transaction which are not released or rollbacked
+	savePoints []*SavePoint
+
 	// Automatically reset the statement after operations that execute a SQL
 	// query such as Count(), Find(), Get(), ...
 	autoResetStatement bool
@@ -44,13 +48,33 @@ type Session struct {
 	afterProcessors []executedProcessor
 
 	prepareStmt bool
-	stmtCache   map[uint32]*core.Stmt //key: hash.Hash32 of (queryStr, len(queryStr))
+	stmtCache   map[stmtKey]*core.Stmt
+
+	// the engine of the group chosen by UseMaster or UseSlave
+	route *Engine
+
+	// the last write of the session for the read-your-writes consistency, and
+	// whether the current transaction has written
+	consistency *ConsistencyToken
+	txWritten   bool
+
+	// the fields to be preloaded by the running Find or Iterate
+	preloading *preloadState
+
+	// the cursors of the last paginated find
+	nextCursor string
+	prevCursor string
+
+	// the count of all the rows found by the window function of FindAndCount
+	overTotal *int64
 
 	// !evalphobia! stored the last executed query on this session
 	//beforeSQLExec func(string, ...interface{})
 	lastSQL     string
 	lastSQLArgs []interface{}
 
+	ctx context.Context
+
 	err error
 }
 
@@ -64,11 +88,20 @@ func (session *Session) Clone() *Session {
 func (session *Session) Init() {
 	session.statement.Init()
 	session.statement.Engine = session.engine
+	session.statement.schema = ""
 	session.isAutoCommit = true
 	session.isCommitedOrRollbacked = false
 	session.isAutoClose = false
+	session.savePoints = nil
 	session.autoResetStatement = true
 	session.prepareStmt = false
+	session.route = nil
+	session.consistency = nil
+	session.txWritten = false
+	session.preloading = nil
+	session.nextCursor = ""
+	session.prevCursor = ""
+	session.overTotal = nil
 
 	// !nashtsai! is lazy init better?
 	session.afterInsertBeans = make(map[interface{}]*[]func(interface{}), 0)
@@ -76,12 +109,14 @@ func (session *Session) Init() {
 	session.afterDeleteBeans = make(map[interface{}]*[]func(interface{}), 0)
 	session.beforeClosures = make([]func(interface{}), 0)
 	session.afterClosures = make([]func(interface{}), 0)
-	session.stmtCache = make(map[uint32]*core.Stmt)
+	session.stmtCache = make(map[stmtKey]*core.Stmt)
 
 	session.afterProcessors = make([]executedProcessor, 0)
 
 	session.lastSQL = ""
 	session.lastSQLArgs = []interface{}{}
+
+	session.ctx = context.Background()
 }
 
 // Close release the connection from pool
@@ -119,6 +154,26 @@ func (session *Session) Prepare() *Session {
 	return session
 }
 
+// UseMaster routes all the autocommit statements of the session to the master of
+// the engine group, it does nothing if the engine is not in a group
+func (session *Session) UseMaster() *Session {
+	if session.engine.engineGroup != nil {
+		session.route = session.engine.engineGroup.Master()
+	}
+	return session
+}
+
+// UseSlave routes all the autocommit statements of the session to the slave, a
+// slave will be chosen by the policy of the group if it's nil. The writes of the
+// session will be rejected.
+func (session *Session) UseSlave(slave *Engine) *Session {
+	if slave == nil && session.engine.engineGroup != nil {
+		slave = session.engine.engineGroup.Slave()
+	}
+	session.route = slave
+	return session
+}
+
 // Before Apply before Processor, affected bean is passed to closure arg
 func (session *Session) Before(closures func(interface{})) *Session {
 	if closures != nil {
@@ -141,12 +196,68 @@ func (session *Session) Table(tableNameOrBean interface{}) *Session {
 	return session
 }
 
+// Schema qualifies all the tables of the session by the schema, it's kept across
+// the statements until the session is closed. The table metadata is still shared
+// by all the schemas.
+func (session *Session) Schema(name string) *Session {
+	session.statement.schema = name
+	return session
+}
+
 // Alias set the table alias
 func (session *Session) Alias(alias string) *Session {
 	session.statement.Alias(alias)
 	return session
 }
 
+// From selects from the subquery with the alias instead of the table, the
+// subquery could be a *Session, a *Statement or a *builder.Builder
+func (session *Session) From(sub interface{}, alias string) *Session {
+	session.statement.From(sub, alias)
+	return session
+}
+
+// With prepends the subquery as a common table expression named name to the
+// select sql, the conditions of the bean are still applied to the outer query
+func (session *Session) With(name string, sub interface{}) *Session {
+	session.statement.With(name, sub)
+	return session
+}
+
+// WithRecursive prepends a recursive common table expression named name, which
+// is the anchor subquery UNION ALL the recursive subquery referencing name
+func (session *Session) WithRecursive(name string, anchor, recursive interface{}) *Session {
+	session.statement.WithRecursive(name, anchor, recursive)
+	return session
+}
+
+// Union combines the select of the session with the select of the other session
+// by UNION, the ordering and the pagination of the session are applied to the
+// combined result. The selects should have the same columns in the same order,
+// the columns of Cols are selected in the order of the fields of the struct.
+func (session *Session) Union(other *Session) *Session {
+	session.statement.Union(other)
+	return session
+}
+
+// UnionAll combines the select of the session with the other by UNION ALL
+func (session *Session) UnionAll(other *Session) *Session {
+	session.statement.UnionAll(other)
+	return session
+}
+
+// Intersect combines the select of the session with the other by INTERSECT
+func (session *Session) Intersect(other *Session) *Session {
+	session.statement.Intersect(other)
+	return session
+}
+
+// Except combines the select of the session with the other by EXCEPT
+func (session *Session) Except(other *Session) *Session {
+	session.statement.Except(other)
+	return session
+}
+
 // NoCascade indicate that no cascade load child object
 func (session *Session) NoCascade() *Session {
 	session.statement.UseCascade = false
@@ -159,6 +270,33 @@ func (session *Session) ForUpdate() *Session {
 	return session
 }
 
+// ForShare locks the selected rows by FOR SHARE, which is LOCK IN SHARE MODE on
+// mysql. It fails if the dialect has no shared row lock.
+func (session *Session) ForShare() *Session {
+	session.statement.ForShare()
+	return session
+}
+
+// ForUpdateOf locks the selected rows of the tables by FOR UPDATE OF
+func (session *Session) ForUpdateOf(tables ...string) *Session {
+	session.statement.ForUpdateOf(tables...)
+	return session
+}
+
+// NoWait makes the row locking fail instead of waiting for the rows locked by
+// others, the rows are locked for update if no locking is set
+func (session *Session) NoWait() *Session {
+	session.statement.NoWait()
+	return session
+}
+
+// SkipLocked makes the row locking skip the rows locked by others, which is used
+// to take the jobs of a queue. The rows are locked for update if no locking is set.
+func (session *Session) SkipLocked() *Session {
+	session.statement.SkipLocked()
+	return session
+}
+
 // NoAutoCondition disable generate SQL condition from beans
 func (session *Session) NoAutoCondition(no ...bool) *Session {
 	session.statement.NoAutoCondition(no...)
@@ -239,7 +377,7 @@ func (session *Session) Having(conditions string) *Session {
 func (session *Session) DB() *core.DB {
 	if session.db == nil {
 		session.db = session.engine.db
-		session.stmtCache = make(map[uint32]*core.Stmt, 0)
+		session.stmtCache = make(map[stmtKey]*core.Stmt, 0)
 	}
 	return session.db
 }
@@ -256,6 +394,7 @@ func (session *Session) canCache() bool {
 		session.statement.RawSQL != "" ||
 		!session.statement.UseCache ||
 		session.statement.IsForUpdate ||
+		session.statement.useSubQuery ||
 		session.tx != nil ||
 		len(session.statement.selectStr) > 0 {
 		return false
@@ -263,17 +402,24 @@ func (session *Session) canCache() bool {
 	return true
 }
 
+// stmtKey is the key of a prepared statement cached by the session, the same SQL
+// is prepared again on another database of the engine group
+type stmtKey struct {
+	db  *core.DB
+	crc uint32
+}
+
 func (session *Session) doPrepare(db *core.DB, sqlStr string) (stmt *core.Stmt, err error) {
-	crc := crc32.ChecksumIEEE([]byte(sqlStr))
+	key := stmtKey{db, crc32.ChecksumIEEE([]byte(sqlStr))}
 	// TODO try hash(sqlStr+len(sqlStr))
 	var has bool
-	stmt, has = session.stmtCache[crc]
+	stmt, has = session.stmtCache[key]
 	if !has {
-		stmt, err = db.Prepare(sqlStr)
+		stmt, err = db.PrepareContext(session.ctx, sqlStr)
 		if err != nil {
 			return nil, err
 		}
-		session.stmtCache[crc] = stmt
+		session.stmtCache[key] = stmt
 	}
 	return
 }
@@ -304,6 +450,16 @@ type Cell *interface{}
 func (session *Session) rows2Beans(rows *core.Rows, fields []string,
 	table *core.Table, newElemFunc func([]string) reflect.Value,
 	sliceValueSetFunc func(*reflect.Value, core.PK) error) error {
+	var overIdx = -1
+	if session.overTotal != nil {
+		for i, field := range fields {
+			if strings.EqualFold(field, countOverColumn) {
+				overIdx = i
+				break
+			}
+		}
+	}
+
 	for rows.Next() {
 		var newValue = newElemFunc(fields)
 		bean := newValue.Interface()
@@ -314,10 +470,18 @@ func (session *Session) rows2Beans(rows *core.Rows, fields []string,
 		if err != nil {
 			return err
 		}
+		if overIdx >= 0 {
+			if err = convertAssign(session.overTotal, *scanResults[overIdx].(*interface{})); err != nil {
+				return err
+			}
+		}
 		pk, err := session.slice2Bean(scanResults, fields, bean, &dataStruct, table)
 		if err != nil {
 			return err
 		}
+		if session.preloading != nil {
+			session.preloading.beans = append(session.preloading.beans, newValue)
+		}
 		session.afterProcessors = append(session.afterProcessors, executedProcessor{
 			fun: func(*Session, interface{}) error {
 				return sliceValueSetFunc(&newValue, pk)
@@ -343,12 +507,16 @@ func (session *Session) row2Slice(rows *core.Rows, fields []string, bean interfa
 		return nil, err
 	}
 
+	beforeSetBean(bean, fields, scanResults)
+	return scanResults, nil
+}
+
+func beforeSetBean(bean interface{}, fields []string, scanResults []interface{}) {
 	if b, hasBeforeSet := bean.(BeforeSetProcessor); hasBeforeSet {
 		for ii, key := range fields {
 			b.BeforeSet(key, Cell(scanResults[ii].(*interface{})))
 		}
 	}
-	return scanResults, nil
 }
 
 func (session *Session) slice2Bean(scanResults []interface{}, fields []string, bean interface{}, dataStruct *reflect.Value, table *core.Table) (core.PK, error) {
@@ -667,12 +835,16 @@ func (session *Session) slice2Bean(scanResults []interface{}, fields []string, b
 						return nil, err
 					}
 
-					if !isPKZero(pk) {
+					preloaded, err := session.preloadPlaceholder(col, fieldValue, table, pk)
+					if err != nil {
+						return nil, err
+					}
+					if !preloaded && !isPKZero(pk) {
 						// !nashtsai! TODO for hasOne relationship, it's preferred to use join query for eager fetch
 						// however, also need to consider adding a 'lazy' attribute to xorm tag which allow hasOne
 						// property to be fetched lazily
 						structInter := reflect.New(fieldValue.Type())
-						has, err := session.ID(pk).NoCascade().get(structInter.Interface())
+						has, err := session.cascadeGet(structInter.Interface(), pk)
 						if err != nil {
 							return nil, err
 						}
@@ -831,7 +1003,7 @@ func (session *Session) LastSQL() (string, []interface{}) {
 // tbName get some table's table name
 func (session *Session) tbNameNoSchema(table *core.Table) string {
 	if len(session.statement.AltTableName) > 0 {
-		return session.statement.AltTableName
+		return tableNameNoSchema(session.statement.AltTableName)
 	}
 
 	return table.Name
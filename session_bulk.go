@@ -0,0 +1,334 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-xorm/core"
+)
+
+var (
+	// RegisterReaderHandler should be set to RegisterReaderHandler of
+	// github.com/go-sql-driver/mysql so that BulkCopy could use LOAD DATA LOCAL
+	// INFILE on mysql. xorm does not import the driver itself, the records will be
+	// inserted by multi-row INSERT statements if it is not set.
+	RegisterReaderHandler func(name string, handler func() io.Reader)
+	// DeregisterReaderHandler should be set to DeregisterReaderHandler of
+	// github.com/go-sql-driver/mysql
+	DeregisterReaderHandler func(name string)
+
+	bulkReaderSeq uint64
+)
+
+// BulkCopy inserts the records of the slice by the bulk loading of the database,
+// COPY FROM STDIN on postgres and LOAD DATA LOCAL INFILE on mysql, which is much
+// faster than INSERT for a large number of records. The records are inserted by
+// chunked multi-row INSERT statements on other databases. Since the bulk loading
+// returns nothing, the autoincrement ids will not be filled back to the records.
+// The records are inserted by INSERT statements on every database if OnConflict
+// or Returning is set.
+func (session *Session) BulkCopy(rowsSlicePtr interface{}) (int64, error) {
+	if session.isAutoClose {
+		defer session.Close()
+	}
+
+	sliceValue := reflect.Indirect(reflect.ValueOf(rowsSlicePtr))
+	if sliceValue.Kind() != reflect.Slice {
+		return 0, ErrParamsType
+	}
+	if sliceValue.Len() <= 0 {
+		return 0, nil
+	}
+
+	if session.statement.conflict != nil || session.statement.returning != nil {
+		// the bulk loading could neither handle the conflicts nor return the records
+		return session.innerInsertMulti(rowsSlicePtr)
+	}
+
+	switch session.engine.dialect.DBType() {
+	case core.POSTGRES:
+	case core.MYSQL:
+		if RegisterReaderHandler == nil || DeregisterReaderHandler == nil {
+			return session.innerInsertMulti(rowsSlicePtr)
+		}
+	default:
+		return session.innerInsertMulti(rowsSlicePtr)
+	}
+
+	defer session.resetStatement()
+
+	if err := session.statement.setRefValue(reflect.ValueOf(sliceValue.Index(0).Interface())); err != nil {
+		return 0, err
+	}
+	var tableName = session.statement.TableName()
+	if len(tableName) <= 0 {
+		return 0, ErrTableNotFound
+	}
+
+	var beans = make([]interface{}, sliceValue.Len())
+	for i := range beans {
+		beans[i] = reflect.Indirect(sliceValue.Index(i)).Addr().Interface()
+	}
+
+	for _, bean := range beans {
+		for _, closure := range session.beforeClosures {
+			closure(bean)
+		}
+		if processor, ok := interface{}(bean).(BeforeInsertProcessor); ok {
+			processor.BeforeInsert()
+		}
+	}
+	cleanupProcessorsClosures(&session.beforeClosures)
+
+	cols, err := session.bulkColumns(beans[0])
+	if err != nil {
+		return 0, err
+	}
+	rows, times, err := session.bulkRows(cols, beans)
+	if err != nil {
+		return 0, err
+	}
+
+	// the statement will be reset by the execution
+	var (
+		table        = session.statement.RefTable
+		checkVersion = session.statement.checkVersion
+		useCache     = session.statement.UseCache
+		affected     int64
+	)
+	if session.engine.dialect.DBType() == core.POSTGRES {
+		affected, err = session.copyIn(tableName, cols, rows)
+	} else {
+		affected, err = session.loadData(tableName, cols, rows)
+	}
+	if err != nil {
+		return affected, err
+	}
+
+	for _, bean := range beans {
+		for _, col := range cols {
+			if t, ok := times[col]; ok {
+				setColumnTime(bean, col, t)
+			} else if col.IsVersion && checkVersion {
+				setColumnInt(bean, col, 1)
+			}
+		}
+	}
+
+	if cacher := session.engine.getCacher2(table); cacher != nil && useCache {
+		session.cacheInsert(table, false, tableName)
+	}
+
+	session.afterInsertMulti(beans)
+	return affected, nil
+}
+
+// bulkColumns returns the columns to be copied, they are chosen by the first record
+// like InsertMulti
+func (session *Session) bulkColumns(bean interface{}) ([]*core.Column, error) {
+	var cols []*core.Column
+	for _, col := range session.statement.RefTable.Columns() {
+		fieldValue, err := col.ValueOf(bean)
+		if err != nil {
+			return nil, err
+		}
+		if col.IsAutoIncrement && isZero(fieldValue.Interface()) {
+			continue
+		}
+		if col.MapType == core.ONLYFROMDB {
+			continue
+		}
+		if col.IsDeleted {
+			continue
+		}
+		if session.statement.ColumnStr != "" {
+			if _, ok := getFlagForColumn(session.statement.columnMap, col); !ok {
+				continue
+			}
+		}
+		if session.statement.OmitStr != "" {
+			if _, ok := getFlagForColumn(session.statement.columnMap, col); ok {
+				continue
+			}
+		}
+		cols = append(cols, col)
+	}
+	if len(cols) == 0 {
+		return nil, errors.New("no column to be copied")
+	}
+	return cols, nil
+}
+
+// bulkRows converts the records to the values of the columns, all the records share
+// the same created and updated time which are returned to be set back
+func (session *Session) bulkRows(cols []*core.Column, beans []interface{}) ([][]interface{}, map[*core.Column]time.Time, error) {
+	var (
+		timeValues = make(map[*core.Column]interface{})
+		times      = make(map[*core.Column]time.Time)
+		rows       = make([][]interface{}, len(beans))
+	)
+	for _, col := range cols {
+		if (col.IsCreated || col.IsUpdated) && session.statement.UseAutoTime {
+			timeValues[col], times[col] = session.engine.nowTime(col)
+		}
+	}
+
+	for i, bean := range beans {
+		var row = make([]interface{}, len(cols))
+		for j, col := range cols {
+			if val, ok := timeValues[col]; ok {
+				row[j] = val
+				continue
+			}
+			if col.IsVersion && session.statement.checkVersion {
+				row[j] = 1
+				continue
+			}
+
+			fieldValue, err := col.ValueOf(bean)
+			if err != nil {
+				return nil, nil, err
+			}
+			if row[j], err = session.value2Interface(col, *fieldValue); err != nil {
+				return nil, nil, err
+			}
+		}
+		rows[i] = row
+	}
+	return rows, times, nil
+}
+
+// quoteColumns returns the quoted names of the columns separated by commas
+func (session *Session) quoteColumns(cols []*core.Column) string {
+	var quoted = make([]string, len(cols))
+	for i, col := range cols {
+		quoted[i] = session.engine.Quote(col.Name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// copyIn copies the rows by COPY FROM STDIN of postgres. The driver lib/pq sends
+// the arguments of every execution of the prepared COPY statement as a row and
+// finishes the copy when it is executed without arguments, which should be in a
+// transaction.
+func (session *Session) copyIn(tableName string, cols []*core.Column, rows [][]interface{}) (int64, error) {
+	sqlStr := fmt.Sprintf("COPY %s (%s) FROM STDIN",
+		session.engine.Quote(tableName), session.quoteColumns(cols))
+	session.saveLastSQL(sqlStr)
+
+	var ownTx bool
+	if session.isAutoCommit {
+		if err := session.Begin(); err != nil {
+			return 0, err
+		}
+		ownTx = true
+		defer session.Rollback()
+	}
+
+	stmt, err := session.tx.PrepareContext(session.ctx, sqlStr)
+	if err != nil {
+		return 0, err
+	}
+	for _, row := range rows {
+		if _, err = stmt.ExecContext(session.ctx, row...); err != nil {
+			stmt.Close()
+			return 0, session.engine.translateError(err)
+		}
+	}
+	if _, err = stmt.ExecContext(session.ctx); err != nil {
+		stmt.Close()
+		return 0, session.engine.translateError(err)
+	}
+	if err = stmt.Close(); err != nil {
+		return 0, err
+	}
+
+	if ownTx {
+		if err = session.Commit(); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(rows)), nil
+}
+
+// loadData loads the rows by LOAD DATA LOCAL INFILE of mysql, the rows are written
+// in the default format of LOAD DATA and read by the driver from a reader handler
+func (session *Session) loadData(tableName string, cols []*core.Column, rows [][]interface{}) (int64, error) {
+	var buf bytes.Buffer
+	for _, row := range rows {
+		for i, val := range row {
+			if i > 0 {
+				buf.WriteByte('\t')
+			}
+			writeLoadDataValue(&buf, val)
+		}
+		buf.WriteByte('\n')
+	}
+
+	name := fmt.Sprintf("xorm_bulk_%d", atomic.AddUint64(&bulkReaderSeq, 1))
+	RegisterReaderHandler(name, func() io.Reader {
+		return &buf
+	})
+	defer DeregisterReaderHandler(name)
+
+	res, err := session.exec(fmt.Sprintf("LOAD DATA LOCAL INFILE 'Reader::%s' INTO TABLE %s CHARACTER SET utf8mb4 (%s)",
+		name, session.engine.Quote(tableName), session.quoteColumns(cols)))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// writeLoadDataValue writes the value escaped by backslashes, NULL is written as \N
+func writeLoadDataValue(buf *bytes.Buffer, val interface{}) {
+	var s string
+	switch v := val.(type) {
+	case nil:
+		buf.WriteString("\\N")
+		return
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case bool:
+		if v {
+			s = "1"
+		} else {
+			s = "0"
+		}
+	case time.Time:
+		s = v.Format("2006-01-02 15:04:05.999999")
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			buf.WriteString("\\\\")
+		case '\t':
+			buf.WriteString("\\t")
+		case '\n':
+			buf.WriteString("\\n")
+		case '\r':
+			buf.WriteString("\\r")
+		case 0:
+			buf.WriteString("\\0")
+		default:
+			buf.WriteByte(c)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type BulkCopyStruct struct {
+	Id      int64
+	Name    string
+	Score   *int
+	Created time.Time `xorm:"created"`
+	Version int       `xorm:"version"`
+}
+
+func TestBulkCopy(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+	assertSync(t, new(BulkCopyStruct))
+
+	var score = 1
+	var records = []BulkCopyStruct{
+		{Name: "a", Score: &score},
+		{Name: "b\tc\\d"},
+	}
+	cnt, err := testEngine.BulkCopy(&records)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, cnt)
+	assert.False(t, records[0].Created.IsZero())
+	assert.EqualValues(t, 1, records[1].Version)
+
+	var results []BulkCopyStruct
+	assert.NoError(t, testEngine.Asc("name").Find(&results))
+	assert.EqualValues(t, 2, len(results))
+	assert.EqualValues(t, "a", results[0].Name)
+	assert.EqualValues(t, 1, *results[0].Score)
+	assert.EqualValues(t, "b\tc\\d", results[1].Name)
+	assert.Nil(t, results[1].Score)
+	assert.EqualValues(t, 1, results[1].Version)
+	assert.False(t, results[1].Created.IsZero())
+
+	cnt, err = testEngine.BulkCopy([]BulkCopyStruct{})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, cnt)
+
+	// the records are inserted by INSERT statements with Returning
+	records = []BulkCopyStruct{{Name: "e"}}
+	cnt, err = testEngine.Returning().BulkCopy(&records)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+	assert.True(t, records[0].Id > 0)
+	assert.EqualValues(t, 1, records[0].Version)
+}
+
+func TestWriteLoadDataValue(t *testing.T) {
+	var buf bytes.Buffer
+	for _, val := range []interface{}{nil, "a\tb\nc\\d", true, int64(-3), []byte("e\rf")} {
+		writeLoadDataValue(&buf, val)
+		buf.WriteByte('|')
+	}
+	assert.EqualValues(t, `\N|a\tb\nc\\d|1|-3|e\rf|`, buf.String())
+}
@@ -8,8 +8,10 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/go-xorm/builder"
+	"github.com/go-xorm/core"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -296,4 +298,190 @@ func TestFindAndCount(t *testing.T) {
 	total, err := testEngine.Where(conds).Count(new(FindAndCount))
 	assert.NoError(t, err)
 	assert.EqualValues(t, 1, total)
+
+	_, err = testEngine.Insert([]FindAndCount{{Name: "test2"}, {Name: "test3"}})
+	assert.NoError(t, err)
+
+	var checkFindAndCount = func() {
+		results = nil
+		total, err = testEngine.Where("name <> ?", "test1").Desc("id").Limit(2, 1).FindAndCount(&results)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 3, total)
+		assert.EqualValues(t, 2, len(results))
+		assert.EqualValues(t, "test2", results[0].Name)
+
+		// the count of a page after the last one
+		results = nil
+		total, err = testEngine.Where("name <> ?", "test1").Limit(2, 10).FindAndCount(&results)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 3, total)
+		assert.EqualValues(t, 0, len(results))
+
+		results = nil
+		total, err = testEngine.Where("name = ?", "none").FindAndCount(&results)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 0, total)
+
+		results = nil
+		total, err = testEngine.GroupBy("name").Asc("name").Limit(1).FindAndCount(&results, &FindAndCount{Name: "test2"})
+		assert.NoError(t, err)
+		assert.EqualValues(t, 1, total)
+		assert.EqualValues(t, 1, len(results))
+		assert.EqualValues(t, "test2", results[0].Name)
+
+		results = nil
+		total, err = testEngine.GroupBy("name").Asc("name").Limit(2).FindAndCount(&results)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 3, total)
+		assert.EqualValues(t, 2, len(results))
+	}
+	checkFindAndCount()
+
+	var names []string
+	total, err = testEngine.Table(new(FindAndCount)).Distinct("name").Limit(1).FindAndCount(&names)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, total)
+	assert.EqualValues(t, 1, len(names))
+
+	results = nil
+	total, err = testEngine.SQL("SELECT * FROM "+testEngine.Quote(testEngine.TableInfo(new(FindAndCount)).Name)+" WHERE name = ?", "test2").
+		FindAndCount(&results)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, total)
+	assert.EqualValues(t, 2, len(results))
+
+	// the rows and the count are queried by one query if the window functions are supported
+	var engine *Engine
+	switch e := testEngine.(type) {
+	case *Engine:
+		engine = e
+	case *EngineGroup:
+		engine = e.Master()
+	}
+	if engine.dialect.DBType() == core.SQLITE {
+		dialect := engine.dialect
+		engine.dialect = &windowFuncTestDialect{dialect}
+		defer func() {
+			engine.dialect = dialect
+		}()
+	}
+	if _, ok := engine.dialect.(windowFuncDialect); ok {
+		checkFindAndCount()
+	}
+
+	// the count is computed once by the innermost select of the pagination of oracle
+	dialect := &oracle{}
+	assert.NoError(t, dialect.Init(nil, &core.Uri{DbType: core.ORACLE}, "oci8", ""))
+	statement := &Statement{Engine: &Engine{dialect: dialect}}
+	statement.Init()
+	statement.Table("job").Limit(2, 1)
+	statement.countOver = true
+	sqlStr, err := statement.genSelectSQL(statement.genCountOverColumnStr("*"), "")
+	assert.NoError(t, err)
+	assert.EqualValues(t, `SELECT * FROM (SELECT at.*,ROWNUM RN FROM (SELECT "job".*, count(*) OVER() AS "xorm_count_over" FROM "job") at WHERE ROWNUM <= 3) aat WHERE RN > 1`, sqlStr)
+}
+
+type windowFuncTestDialect struct {
+	core.Dialect
+}
+
+func (db *windowFuncTestDialect) SupportWindowFunc() bool {
+	return true
+}
+
+func TestSubQuery(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+
+	type SubQueryUser struct {
+		Id      int64
+		Name    string
+		Deleted time.Time `xorm:"deleted"`
+	}
+
+	type SubQueryOrder struct {
+		Id     int64
+		UserId int64
+		Amount int
+	}
+
+	assertSync(t, new(SubQueryUser), new(SubQueryOrder))
+
+	var users = []SubQueryUser{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}}
+	for i := range users {
+		_, err := testEngine.Insert(&users[i])
+		assert.NoError(t, err)
+	}
+	_, err := testEngine.Insert([]SubQueryOrder{
+		{UserId: users[0].Id, Amount: 10},
+		{UserId: users[0].Id, Amount: 20},
+		{UserId: users[1].Id, Amount: 5},
+		{UserId: users[3].Id, Amount: 50},
+	})
+	assert.NoError(t, err)
+	_, err = testEngine.ID(users[3].Id).Delete(new(SubQueryUser))
+	assert.NoError(t, err)
+
+	var result []SubQueryUser
+	err = testEngine.In("id", testEngine.Table(new(SubQueryOrder)).Select("user_id").Where("amount > ?", 8)).
+		Asc("id").Find(&result)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, len(result))
+	assert.EqualValues(t, "a", result[0].Name)
+
+	result = nil
+	err = testEngine.NotIn("id", builder.Select("user_id").From("sub_query_order")).Find(&result)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, len(result))
+	assert.EqualValues(t, "c", result[0].Name)
+
+	cnt, err := testEngine.Where("id IN (?) AND name <> ?",
+		testEngine.Table("sub_query_order").Select("user_id").Where("amount < ?", 30), "b").
+		Count(new(SubQueryUser))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+
+	// the deleted users are filtered from the subquery
+	var orders []SubQueryOrder
+	err = testEngine.In("user_id", testEngine.Table(new(SubQueryUser)).Select("id")).Find(&orders)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, len(orders))
+
+	result = nil
+	err = testEngine.Exists(testEngine.Table("sub_query_order").Select("1").
+		Where("sub_query_order.user_id = sub_query_user.id")).Asc("id").Find(&result)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, len(result))
+
+	result = nil
+	err = testEngine.NotExists(testEngine.Table("sub_query_order").Select("1").
+		Where("sub_query_order.user_id = sub_query_user.id")).Find(&result)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, len(result))
+	assert.EqualValues(t, "c", result[0].Name)
+
+	type SubQueryTotal struct {
+		UserId int64
+		Total  int
+	}
+	var totals []SubQueryTotal
+	err = testEngine.From(testEngine.Table("sub_query_order").Select("user_id, sum(amount) AS total").
+		Where("amount > ?", 1).GroupBy("user_id"), "t").Where("total > ?", 10).Asc("user_id").Find(&totals)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, len(totals))
+	assert.EqualValues(t, 30, totals[0].Total)
+	assert.EqualValues(t, 50, totals[1].Total)
+
+	var names []string
+	err = testEngine.Table("sub_query_user").Alias("u").
+		Join("INNER", []interface{}{testEngine.Table("sub_query_order").Select("user_id, max(amount) AS amount").
+			Where("amount > ? AND amount < ?", 6, 40).GroupBy("user_id"), "o"}, "o.user_id = u.id").
+		Where("u.name <> ?", "z").Cols("u.name").Find(&names)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"a"}, names)
+
+	// the subquery without table fails
+	sub := testEngine.NewSession()
+	defer sub.Close()
+	err = testEngine.In("id", sub.Select("id")).Find(&result)
+	assert.Error(t, err)
 }
@@ -221,12 +221,16 @@ func (session *Session) bytes2Value(col *core.Column, fieldValue *reflect.Value,
 					return err
 				}
 
-				if !isPKZero(pk) {
+				preloaded, err := session.preloadPlaceholder(col, fieldValue, table, pk)
+				if err != nil {
+					return err
+				}
+				if !preloaded && !isPKZero(pk) {
 					// !nashtsai! TODO for hasOne relationship, it's preferred to use join query for eager fetch
 					// however, also need to consider adding a 'lazy' attribute to xorm tag which allow hasOne
 					// property to be fetched lazily
 					structInter := reflect.New(fieldValue.Type())
-					has, err := session.ID(pk).NoCascade().get(structInter.Interface())
+					has, err := session.cascadeGet(structInter.Interface(), pk)
 					if err != nil {
 						return err
 					}
@@ -503,11 +507,15 @@ func (session *Session) bytes2Value(col *core.Column, fieldValue *reflect.Value,
 						return err
 					}
 
-					if !isPKZero(pk) {
+					preloaded, err := session.preloadPlaceholder(col, fieldValue, table, pk)
+					if err != nil {
+						return err
+					}
+					if !preloaded && !isPKZero(pk) {
 						// !nashtsai! TODO for hasOne relationship, it's preferred to use join query for eager fetch
 						// however, also need to consider adding a 'lazy' attribute to xorm tag which allow hasOne
 						// property to be fetched lazily
-						has, err := session.ID(pk).NoCascade().get(structInter.Interface())
+						has, err := session.cascadeGet(structInter.Interface(), pk)
 						if err != nil {
 							return err
 						}
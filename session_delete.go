@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/go-xorm/core"
 )
@@ -79,6 +80,23 @@ func (session *Session) Delete(bean interface{}) (int64, error) {
 		defer session.Close()
 	}
 
+	if !session.statement.cascadeRels || !session.isAutoCommit {
+		return session.delete(bean)
+	}
+
+	if err := session.Begin(); err != nil {
+		return 0, err
+	}
+	defer session.Rollback()
+
+	affected, err := session.delete(bean)
+	if err != nil {
+		return affected, err
+	}
+	return affected, session.Commit()
+}
+
+func (session *Session) delete(bean interface{}) (int64, error) {
 	if err := session.statement.setRefValue(rValue(bean)); err != nil {
 		return 0, err
 	}
@@ -143,6 +161,16 @@ func (session *Session) Delete(bean interface{}) (int64, error) {
 		}
 	}
 
+	var returning = session.statement.returning
+	var returningMode = session.engine.returningMode()
+	if returning != nil {
+		if err = returningBean(bean); err != nil {
+			return 0, err
+		}
+	}
+	// condArgs will be changed for the deleted column
+	var selectArgs = append([]interface{}{}, condArgs...)
+
 	var realSQL string
 	argsForCache := make([]interface{}, 0, len(condArgs)*2)
 	if session.statement.unscoped || table.DeletedColumn() == nil { // tag "deleted" is disabled
@@ -203,10 +231,58 @@ func (session *Session) Delete(bean interface{}) (int64, error) {
 		session.cacheDelete(table, tableNameNoQuote, deleteSQL, argsForCache...)
 	}
 
+	if session.statement.cascadeRels {
+		err = session.deleteRelations(table, tableName, condSQL, orderSQL, selectArgs, session.statement.unscoped)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if returning != nil && returningMode == returningReselect {
+		// select the records before they are deleted
+		selectSQL := fmt.Sprintf("SELECT %s FROM %s",
+			session.returningColumns(table, returning, ""), tableName)
+		if len(condSQL) > 0 {
+			selectSQL += " WHERE " + condSQL
+		}
+		selectSQL += orderSQL
+
+		session.statement.RefTable = table
+		rows, err := session.queryMasterRows(selectSQL, selectArgs...)
+		if err != nil {
+			return 0, err
+		}
+		if _, err = session.scanReturning(rows, table, []interface{}{bean}); err != nil {
+			return 0, err
+		}
+	}
+
 	session.statement.RefTable = table
-	res, err := session.exec(realSQL, condArgs...)
-	if err != nil {
-		return 0, err
+	var affected int64
+	if returning != nil && returningMode != returningReselect {
+		if returningMode == returningClause {
+			realSQL = session.genReturningSQL(realSQL, table, returning)
+		} else if realSQL == deleteSQL {
+			realSQL = session.genOutputSQL(realSQL, strings.Index(realSQL, " WHERE "), table, returning, "DELETED.")
+		} else {
+			realSQL = session.genOutputSQL(realSQL, strings.Index(realSQL, " WHERE "), table, returning, "INSERTED.")
+		}
+
+		rows, err := session.queryRows(realSQL, condArgs...)
+		if err != nil {
+			return 0, err
+		}
+		if affected, err = session.scanReturning(rows, table, []interface{}{bean}); err != nil {
+			return affected, err
+		}
+	} else {
+		res, err := session.exec(realSQL, condArgs...)
+		if err != nil {
+			return 0, err
+		}
+		if affected, err = res.RowsAffected(); err != nil {
+			return 0, err
+		}
 	}
 
 	// handle after delete processors
@@ -236,5 +312,5 @@ func (session *Session) Delete(bean interface{}) (int64, error) {
 	cleanupProcessorsClosures(&session.afterClosures)
 	// --
 
-	return res.RowsAffected()
+	return affected, nil
 }
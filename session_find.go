@@ -5,10 +5,10 @@
 package xorm
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"reflect"
-	"strings"
 
 	"github.com/go-xorm/builder"
 	"github.com/go-xorm/core"
@@ -26,9 +26,107 @@ func (session *Session) Find(rowsSlicePtr interface{}, condiBean ...interface{})
 	if session.isAutoClose {
 		defer session.Close()
 	}
+	if session.statement.pageSize != 0 {
+		return session.findPage(rowsSlicePtr, condiBean...)
+	}
 	return session.find(rowsSlicePtr, condiBean...)
 }
 
+// windowFuncDialect is implemented by the dialects which support the window
+// functions, FindAndCount finds the records and counts them by one query on them
+type windowFuncDialect interface {
+	SupportWindowFunc() bool
+}
+
+// FindAndCount finds the records like Find and returns the count of all the
+// records matching the conditions, the ordering and the pagination are not
+// applied to the count. The groups of GroupBy and the rows of Distinct are
+// counted. If the dialect supports the window functions, the records and the
+// count are queried in one round trip by COUNT(*) OVER().
+func (session *Session) FindAndCount(rowsSlicePtr interface{}, condiBean ...interface{}) (int64, error) {
+	if session.isAutoClose {
+		defer session.Close()
+	}
+
+	sliceValue := reflect.Indirect(reflect.ValueOf(rowsSlicePtr))
+	if sliceValue.Kind() != reflect.Slice && sliceValue.Kind() != reflect.Map {
+		return 0, errors.New("needs a pointer to a slice or a map")
+	}
+	elemType := sliceValue.Type().Elem()
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+
+	// the statement is reset after the records are found
+	var statement = session.statement
+	var total int64
+	var err error
+	if session.canCountOver(elemType) {
+		session.statement.countOver = true
+		session.overTotal = &total
+		err = session.find(rowsSlicePtr, condiBean...)
+		session.overTotal = nil
+		if err != nil {
+			return 0, err
+		}
+		if sliceValue.Len() > 0 {
+			// the rows skipped by the pagination of mssql are excluded by the
+			// conditions, so they are not counted by the window function
+			if session.engine.dialect.DBType() == core.MSSQL {
+				total += int64(statement.Start)
+			}
+			return total, nil
+		}
+		if statement.Start == 0 {
+			return 0, nil
+		}
+	} else if statement.pageSize != 0 {
+		err = session.findPage(rowsSlicePtr, condiBean...)
+	} else {
+		err = session.find(rowsSlicePtr, condiBean...)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	session.statement = statement
+	session.statement.pageSize = 0
+	session.statement.pageCursor = ""
+	session.statement.pageBefore = false
+
+	var bean interface{}
+	if len(condiBean) > 0 {
+		bean = condiBean[0]
+	} else if elemType.Kind() == reflect.Struct {
+		bean = reflect.New(elemType).Interface()
+	}
+	sqlStr, args, err := session.statement.genFindCountSQL(bean)
+	if err != nil {
+		return 0, err
+	}
+
+	err = session.queryRow(sqlStr, args...).Scan(&total)
+	if err == sql.ErrNoRows || err == nil {
+		return total, nil
+	}
+	return 0, err
+}
+
+// canCountOver returns true if the records found by FindAndCount could be
+// counted by the window function
+func (session *Session) canCountOver(elemType reflect.Type) bool {
+	dialect, ok := session.engine.dialect.(windowFuncDialect)
+	if !ok || !dialect.SupportWindowFunc() {
+		return false
+	}
+	// the window function is computed before the rows are distinct
+	return elemType.Kind() == reflect.Struct &&
+		session.statement.RawSQL == "" &&
+		!session.statement.IsDistinct &&
+		len(session.statement.setOps) == 0 &&
+		session.statement.pageSize == 0
+}
+
 func (session *Session) find(rowsSlicePtr interface{}, condiBean ...interface{}) error {
 	sliceValue := reflect.Indirect(reflect.ValueOf(rowsSlicePtr))
 	if sliceValue.Kind() != reflect.Slice && sliceValue.Kind() != reflect.Map {
@@ -37,6 +135,12 @@ func (session *Session) find(rowsSlicePtr interface{}, condiBean ...interface{})
 
 	sliceElementType := sliceValue.Type().Elem()
 
+	if session.beginPreload() {
+		defer func() {
+			session.preloading = nil
+		}()
+	}
+
 	var tp = tpStruct
 	if session.statement.RefTable == nil {
 		if sliceElementType.Kind() == reflect.Ptr {
@@ -95,30 +199,9 @@ func (session *Session) find(rowsSlicePtr interface{}, condiBean ...interface{})
 			return ErrTableNotFound
 		}
 
-		var columnStr = session.statement.ColumnStr
-		if len(session.statement.selectStr) > 0 {
-			columnStr = session.statement.selectStr
-		} else {
-			if session.statement.JoinStr == "" {
-				if columnStr == "" {
-					if session.statement.GroupByStr != "" {
-						columnStr = session.statement.Engine.Quote(strings.Replace(session.statement.GroupByStr, ",", session.engine.Quote(","), -1))
-					} else {
-						columnStr = session.statement.genColumnStr()
-					}
-				}
-			} else {
-				if columnStr == "" {
-					if session.statement.GroupByStr != "" {
-						columnStr = session.statement.Engine.Quote(strings.Replace(session.statement.GroupByStr, ",", session.engine.Quote(","), -1))
-					} else {
-						columnStr = "*"
-					}
-				}
-			}
-			if columnStr == "" {
-				columnStr = "*"
-			}
+		var columnStr = session.statement.genFindColumnStr()
+		if session.statement.countOver {
+			columnStr = session.statement.genCountOverColumnStr(columnStr)
 		}
 
 		session.statement.cond = session.statement.cond.And(autoCond)
@@ -127,22 +210,17 @@ func (session *Session) find(rowsSlicePtr interface{}, condiBean ...interface{})
 			return err
 		}
 
-		args = append(session.statement.joinArgs, condArgs...)
+		args = session.statement.selectArgs(condArgs)
 		sqlStr, err = session.statement.genSelectSQL(columnStr, condSQL)
 		if err != nil {
 			return err
 		}
-		// for mssql and use limit
-		qs := strings.Count(sqlStr, "?")
-		if len(args)*2 == qs {
-			args = append(args, args...)
-		}
 	} else {
 		sqlStr = session.statement.RawSQL
 		args = session.statement.RawParams
 	}
 
-	if session.canCache() {
+	if session.canCache() && session.preloading == nil && !session.statement.countOver {
 		if cacher := session.engine.getCacher2(table); cacher != nil &&
 			!session.statement.IsDistinct &&
 			!session.statement.unscoped {
@@ -244,6 +322,9 @@ func (session *Session) noCacheFind(table *core.Table, containerValue reflect.Va
 		if err != nil {
 			return err
 		}
+		if err = session.preload(); err != nil {
+			return err
+		}
 		return session.executeProcessors()
 	}
 
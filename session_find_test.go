@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/go-xorm/core"
 	"github.com/stretchr/testify/assert"
@@ -488,3 +489,225 @@ func TestFindBit(t *testing.T) {
 	assert.NoError(t, err)
 	assert.EqualValues(t, 2, len(results))
 }
+
+func TestFindWithCTE(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+
+	type CteCategory struct {
+		Id       int64
+		ParentId int64
+		Name     string
+		Deleted  time.Time `xorm:"deleted"`
+	}
+
+	assertSync(t, new(CteCategory))
+
+	// 1 -> 2 -> 3 -> 4, 1 -> 5, 6
+	var parents = []int64{0, 1, 2, 3, 1, 0}
+	for i, parent := range parents {
+		_, err := testEngine.Insert(&CteCategory{ParentId: parent, Name: fmt.Sprintf("c%d", i+1)})
+		assert.NoError(t, err)
+	}
+	_, err := testEngine.ID(5).Delete(new(CteCategory))
+	assert.NoError(t, err)
+
+	var tree = func(root int64) (interface{}, interface{}) {
+		return testEngine.Table("cte_category").Select("id, parent_id, name, deleted").Where("id = ?", root),
+			testEngine.Table("cte_category").Alias("c").Join("INNER", "tree", "c.parent_id = tree.id").
+				Select("c.id, c.parent_id, c.name, c.deleted")
+	}
+
+	var categories []CteCategory
+	anchor, recursive := tree(2)
+	err = testEngine.WithRecursive("tree", anchor, recursive).Table("tree").Asc("id").Find(&categories)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, len(categories))
+	assert.EqualValues(t, "c2", categories[0].Name)
+	assert.EqualValues(t, "c4", categories[2].Name)
+
+	// the deleted category is filtered by the outer query
+	anchor, recursive = tree(1)
+	cnt, err := testEngine.WithRecursive("tree", anchor, recursive).Table("tree").Count(new(CteCategory))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 4, cnt)
+
+	anchor, recursive = tree(1)
+	var names []string
+	err = testEngine.WithRecursive("tree", anchor, recursive).Table("tree").
+		Where("id > ?", 2).Asc("id").Iterate(new(CteCategory), func(i int, bean interface{}) error {
+		names = append(names, bean.(*CteCategory).Name)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"c3", "c4"}, names)
+
+	categories = nil
+	err = testEngine.With("roots", testEngine.Table(new(CteCategory)).Select("id").Where("parent_id = ?", 0)).
+		Where("parent_id IN (SELECT id FROM roots)").Asc("id").Find(&categories)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, len(categories))
+	assert.EqualValues(t, "c2", categories[0].Name)
+}
+
+func TestFindUnion(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+
+	type UnionUser struct {
+		Id   int64
+		Name string
+		Age  int
+	}
+
+	assertSync(t, new(UnionUser))
+	assert.NoError(t, testEngine.DropTables("union_user_archive"))
+	assert.NoError(t, testEngine.Table("union_user_archive").CreateTable(new(UnionUser)))
+
+	_, err := testEngine.Insert([]UnionUser{{Name: "a", Age: 10}, {Name: "b", Age: 20}, {Name: "c", Age: 30}})
+	assert.NoError(t, err)
+	_, err = testEngine.Table("union_user_archive").Insert([]UnionUser{{Id: 10, Name: "c", Age: 30}, {Id: 11, Name: "d", Age: 40}})
+	assert.NoError(t, err)
+
+	var users []UnionUser
+	err = testEngine.Cols("age", "name").
+		Union(testEngine.Table("union_user_archive").Select("name, age")).
+		Desc("age").Find(&users)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 4, len(users))
+	assert.EqualValues(t, "d", users[0].Name)
+	assert.EqualValues(t, "a", users[3].Name)
+
+	// the order of the columns of Cols is unknown without the struct of the table
+	users = nil
+	err = testEngine.Cols("name", "age").
+		Union(testEngine.Table("union_user_archive").Cols("name", "age")).Find(&users)
+	assert.Error(t, err)
+
+	users = nil
+	err = testEngine.Where("age > ?", 10).
+		UnionAll(testEngine.Table("union_user_archive").Where("age < ?", 40)).
+		Asc("age", "id").Limit(2, 1).Find(&users)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, len(users))
+	assert.EqualValues(t, "c", users[0].Name)
+	assert.EqualValues(t, 3, users[0].Id)
+	assert.EqualValues(t, "c", users[1].Name)
+	assert.EqualValues(t, 10, users[1].Id)
+
+	cnt, err := testEngine.Table("union_user").
+		Union(testEngine.Table("union_user_archive")).Count(new(UnionUser))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, cnt)
+
+	var names []string
+	err = testEngine.Cols("name").Intersect(testEngine.Table("union_user_archive").Cols("name")).
+		Iterate(new(UnionUser), func(i int, bean interface{}) error {
+			names = append(names, bean.(*UnionUser).Name)
+			return nil
+		})
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"c"}, names)
+
+	rows, err := testEngine.Cols("name").Except(testEngine.Table("union_user_archive").Cols("name")).
+		Asc("name").Rows(new(UnionUser))
+	assert.NoError(t, err)
+	defer rows.Close()
+	names = nil
+	for rows.Next() {
+		var user UnionUser
+		assert.NoError(t, rows.Scan(&user))
+		names = append(names, user.Name)
+	}
+	assert.EqualValues(t, []string{"a", "b"}, names)
+}
+
+func TestFindPaginate(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+
+	type PageItem struct {
+		Id    int64
+		Score *int
+		Name  string
+	}
+
+	assertSync(t, new(PageItem))
+
+	var score = func(v int) *int {
+		return &v
+	}
+	// ordered by score DESC, name ASC, id ASC
+	var items = []PageItem{
+		{Score: score(3), Name: "a"},
+		{Score: nil, Name: "b"},
+		{Score: score(5), Name: "c"},
+		{Score: score(3), Name: "a"},
+		{Score: nil, Name: "a"},
+		{Score: score(1), Name: "d"},
+		{Score: score(3), Name: "b"},
+	}
+	for i := range items {
+		_, err := testEngine.Insert(&items[i])
+		assert.NoError(t, err)
+	}
+
+	var all []PageItem
+	assert.NoError(t, testEngine.Desc("score").Asc("name", "id").Find(&all))
+	assert.EqualValues(t, 7, len(all))
+
+	var ids = func(items []PageItem) []int64 {
+		var res []int64
+		for _, item := range items {
+			res = append(res, item.Id)
+		}
+		return res
+	}
+
+	session := testEngine.NewSession()
+	defer session.Close()
+
+	var pages [][]PageItem
+	var cursor string
+	for {
+		var page []PageItem
+		err := session.Desc("score").Asc("name").AfterCursor(cursor).Paginate(3).Find(&page)
+		assert.NoError(t, err)
+		pages = append(pages, page)
+		next, prev := session.Cursors()
+		if len(pages) == 1 {
+			assert.EqualValues(t, "", prev)
+		} else {
+			assert.NotEqual(t, "", prev)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	assert.EqualValues(t, 3, len(pages))
+	assert.EqualValues(t, ids(all[:3]), ids(pages[0]))
+	assert.EqualValues(t, ids(all[3:6]), ids(pages[1]))
+	assert.EqualValues(t, ids(all[6:]), ids(pages[2]))
+
+	// go back from the last page
+	_, prev := session.Cursors()
+	var page []PageItem
+	assert.NoError(t, session.Desc("score").Asc("name").BeforeCursor(prev).Paginate(3).Find(&page))
+	assert.EqualValues(t, ids(all[3:6]), ids(page))
+	next, prev := session.Cursors()
+	assert.NotEqual(t, "", next)
+	assert.NotEqual(t, "", prev)
+
+	page = nil
+	assert.NoError(t, session.Desc("score").Asc("name").BeforeCursor(prev).Paginate(3).Find(&page))
+	assert.EqualValues(t, ids(all[:3]), ids(page))
+	_, prev = session.Cursors()
+	assert.EqualValues(t, "", prev)
+
+	// the cursor is made for another ordering
+	page = nil
+	err := session.Asc("name").AfterCursor(next).Paginate(3).Find(&page)
+	assert.EqualValues(t, ErrInvalidCursor, err)
+
+	// the cursor is tampered
+	err = session.Desc("score").Asc("name").AfterCursor(next[1:]).Paginate(3).Find(&page)
+	assert.EqualValues(t, ErrInvalidCursor, err)
+}
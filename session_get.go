@@ -56,7 +56,14 @@ func (session *Session) get(bean interface{}) (bool, error) {
 
 	table := session.statement.RefTable
 
-	if session.canCache() && beanValue.Elem().Kind() == reflect.Struct {
+	var preloading = beanValue.Elem().Kind() == reflect.Struct && session.beginPreload()
+	if preloading {
+		defer func() {
+			session.preloading = nil
+		}()
+	}
+
+	if session.canCache() && !preloading && beanValue.Elem().Kind() == reflect.Struct {
 		if cacher := session.engine.getCacher2(table); cacher != nil &&
 			!session.statement.unscoped {
 			has, err := session.cacheGet(bean, sqlStr, args...)
@@ -66,7 +73,13 @@ func (session *Session) get(bean interface{}) (bool, error) {
 		}
 	}
 
-	return session.nocacheGet(beanValue.Elem().Kind(), table, bean, sqlStr, args...)
+	has, err := session.nocacheGet(beanValue.Elem().Kind(), table, bean, sqlStr, args...)
+	if !has || err != nil || !preloading {
+		return has, err
+	}
+
+	session.preloading.beans = append(session.preloading.beans, beanValue)
+	return true, session.preload()
 }
 
 func (session *Session) nocacheGet(beanKind reflect.Kind, table *core.Table, bean interface{}, sqlStr string, args ...interface{}) (bool, error) {
@@ -5,6 +5,7 @@
 package xorm
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"reflect"
@@ -17,43 +18,66 @@ import (
 // Insert insert one or more beans
 func (session *Session) Insert(beans ...interface{}) (int64, error) {
 	var affected int64
-	var err error
 
 	if session.isAutoClose {
 		defer session.Close()
 	}
 
+	// the statement will be reset after the first bean is inserted
+	var cascade = session.statement.cascadeRels
+	var ownTx bool
+	if cascade && session.isAutoCommit {
+		if err := session.Begin(); err != nil {
+			return 0, err
+		}
+		ownTx = true
+		defer session.Rollback()
+	}
+
 	for _, bean := range beans {
-		sliceValue := reflect.Indirect(reflect.ValueOf(bean))
-		if sliceValue.Kind() == reflect.Slice {
-			size := sliceValue.Len()
-			if size > 0 {
-				if session.engine.SupportInsertMany() {
-					cnt, err := session.innerInsertMulti(bean)
-					if err != nil {
-						return affected, err
-					}
-					affected += cnt
-				} else {
-					for i := 0; i < size; i++ {
-						cnt, err := session.innerInsert(sliceValue.Index(i).Interface())
-						if err != nil {
-							return affected, err
-						}
-						affected += cnt
-					}
-				}
-			}
-		} else {
-			cnt, err := session.innerInsert(bean)
-			if err != nil {
+		cnt, err := session.insertBean(bean)
+		if err != nil {
+			return affected, err
+		}
+		affected += cnt
+
+		if cascade {
+			if err = session.insertRelations(bean); err != nil {
 				return affected, err
 			}
-			affected += cnt
 		}
 	}
 
-	return affected, err
+	if ownTx {
+		return affected, session.Commit()
+	}
+	return affected, nil
+}
+
+// insertBean inserts a bean or a slice of beans
+func (session *Session) insertBean(bean interface{}) (int64, error) {
+	sliceValue := reflect.Indirect(reflect.ValueOf(bean))
+	if sliceValue.Kind() != reflect.Slice {
+		return session.innerInsert(bean)
+	}
+
+	size := sliceValue.Len()
+	if size <= 0 {
+		return 0, nil
+	}
+	if session.engine.SupportInsertMany() {
+		return session.innerInsertMulti(bean)
+	}
+
+	var affected int64
+	for i := 0; i < size; i++ {
+		cnt, err := session.innerInsert(sliceValue.Index(i).Interface())
+		if err != nil {
+			return affected, err
+		}
+		affected += cnt
+	}
+	return affected, nil
 }
 
 func (session *Session) innerInsertMulti(rowsSlicePtr interface{}) (int64, error) {
@@ -79,7 +103,9 @@ func (session *Session) innerInsertMulti(rowsSlicePtr interface{}) (int64, error
 
 	var colNames []string
 	var colMultiPlaces []string
+	var rowsPlaces [][]string
 	var args []interface{}
+	var rowsArgsEnd []int
 	var cols []*core.Column
 
 	for i := 0; i < size; i++ {
@@ -136,11 +162,14 @@ func (session *Session) innerInsertMulti(rowsSlicePtr interface{}) (int64, error
 					})
 				} else if col.IsVersion && session.statement.checkVersion {
 					args = append(args, 1)
-					var colName = col.Name
-					session.afterClosures = append(session.afterClosures, func(bean interface{}) {
-						col := table.GetColumn(colName)
-						setColumnInt(bean, col, 1)
-					})
+					// the version of the record updated by upsert is unknown
+					if session.statement.conflict == nil {
+						var colName = col.Name
+						session.afterClosures = append(session.afterClosures, func(bean interface{}) {
+							col := table.GetColumn(colName)
+							setColumnInt(bean, col, 1)
+						})
+					}
 				} else {
 					arg, err := session.value2Interface(col, fieldValue)
 					if err != nil {
@@ -191,11 +220,14 @@ func (session *Session) innerInsertMulti(rowsSlicePtr interface{}) (int64, error
 					})
 				} else if col.IsVersion && session.statement.checkVersion {
 					args = append(args, 1)
-					var colName = col.Name
-					session.afterClosures = append(session.afterClosures, func(bean interface{}) {
-						col := table.GetColumn(colName)
-						setColumnInt(bean, col, 1)
-					})
+					// the version of the record updated by upsert is unknown
+					if session.statement.conflict == nil {
+						var colName = col.Name
+						session.afterClosures = append(session.afterClosures, func(bean interface{}) {
+							col := table.GetColumn(colName)
+							setColumnInt(bean, col, 1)
+						})
+					}
 				} else {
 					arg, err := session.value2Interface(col, fieldValue)
 					if err != nil {
@@ -208,46 +240,290 @@ func (session *Session) innerInsertMulti(rowsSlicePtr interface{}) (int64, error
 			}
 		}
 		colMultiPlaces = append(colMultiPlaces, strings.Join(colPlaces, ", "))
+		rowsPlaces = append(rowsPlaces, colPlaces)
+		rowsArgsEnd = append(rowsArgsEnd, len(args))
 	}
 	cleanupProcessorsClosures(&session.beforeClosures)
 
-	var sql = "INSERT INTO %s (%v%v%v) VALUES (%v)"
-	var statement string
 	var tableName = session.statement.TableName()
-	if session.engine.dialect.DBType() == core.ORACLE {
-		sql = "INSERT ALL INTO %s (%v%v%v) VALUES (%v) SELECT 1 FROM DUAL"
-		temp := fmt.Sprintf(") INTO %s (%v%v%v) VALUES (",
-			session.engine.Quote(tableName),
-			session.engine.QuoteStr(),
-			strings.Join(colNames, session.engine.QuoteStr()+", "+session.engine.QuoteStr()),
-			session.engine.QuoteStr())
-		statement = fmt.Sprintf(sql,
-			session.engine.Quote(tableName),
-			session.engine.QuoteStr(),
-			strings.Join(colNames, session.engine.QuoteStr()+", "+session.engine.QuoteStr()),
-			session.engine.QuoteStr(),
-			strings.Join(colMultiPlaces, temp))
-	} else {
-		statement = fmt.Sprintf(sql,
-			session.engine.Quote(tableName),
-			session.engine.QuoteStr(),
-			strings.Join(colNames, session.engine.QuoteStr()+", "+session.engine.QuoteStr()),
-			session.engine.QuoteStr(),
-			strings.Join(colMultiPlaces, "),("))
+	var isUpsert = session.statement.conflict != nil
+	var returning = session.statement.returning
+	var returningMode = session.engine.returningMode()
+
+	// the autoincrement ids will be filled back if they are not inserted, they are
+	// needed to select the records again for Returning
+	var aiCol *core.Column
+	if table.AutoIncrement != "" && !isUpsert && (returning == nil || returningMode == returningReselect) {
+		aiCol = table.AutoIncrColumn()
+		for _, col := range cols {
+			if col == aiCol {
+				aiCol = nil
+				break
+			}
+		}
 	}
-	res, err := session.exec(statement, args...)
-	if err != nil {
-		return 0, err
+
+	// the returned records are matched to the beans by the keys if some of the
+	// records may be ignored by upsert, or the order of OUTPUT of mssql is unknown
+	var returningKeys []*core.Column
+	if returning != nil && returningMode != returningReselect &&
+		(isUpsert || (returningMode == returningOutput && size > 1)) {
+		var err error
+		if returningKeys, err = session.returningKeys(table, cols); err != nil {
+			return 0, err
+		}
+		if len(returning) > 0 {
+			returning = append([]string{}, returning...)
+			for _, key := range returningKeys {
+				var found bool
+				for _, name := range returning {
+					if strings.EqualFold(name, key.Name) {
+						found = true
+						break
+					}
+				}
+				if !found {
+					returning = append(returning, key.Name)
+				}
+			}
+		}
+	}
+
+	var beans = make([]interface{}, size)
+	for i := 0; i < size; i++ {
+		beans[i] = reflect.Indirect(sliceValue.Index(i)).Addr().Interface()
+	}
+
+	var chunks = session.insertMultiChunks(len(colNames), args, rowsArgsEnd)
+	var ownTx bool
+	if len(chunks) > 1 {
+		// all the chunks should be inserted in one transaction
+		if session.isAutoCommit {
+			if err := session.Begin(); err != nil {
+				return 0, err
+			}
+			ownTx = true
+			defer session.Rollback()
+		}
+		// the statement is shared by all the chunks
+		if session.autoResetStatement {
+			session.autoResetStatement = false
+			defer func() {
+				session.autoResetStatement = true
+				session.resetStatement()
+			}()
+		}
+	}
+
+	var affected int64
+	var start int
+	for _, end := range chunks {
+		var argsStart int
+		if start > 0 {
+			argsStart = rowsArgsEnd[start-1]
+		}
+		var chunkArgs = args[argsStart:rowsArgsEnd[end-1]]
+
+		var sql = "INSERT INTO %s (%v%v%v) VALUES (%v)"
+		var statement string
+		if isUpsert {
+			var err error
+			statement, err = session.genUpsertSQL(tableName, colNames, rowsPlaces[start:end])
+			if err != nil {
+				return 0, err
+			}
+		} else if session.engine.dialect.DBType() == core.ORACLE {
+			sql = "INSERT ALL INTO %s (%v%v%v) VALUES (%v) SELECT 1 FROM DUAL"
+			temp := fmt.Sprintf(") INTO %s (%v%v%v) VALUES (",
+				session.engine.Quote(tableName),
+				session.engine.QuoteStr(),
+				strings.Join(colNames, session.engine.QuoteStr()+", "+session.engine.QuoteStr()),
+				session.engine.QuoteStr())
+			statement = fmt.Sprintf(sql,
+				session.engine.Quote(tableName),
+				session.engine.QuoteStr(),
+				strings.Join(colNames, session.engine.QuoteStr()+", "+session.engine.QuoteStr()),
+				session.engine.QuoteStr(),
+				strings.Join(colMultiPlaces[start:end], temp))
+		} else {
+			statement = fmt.Sprintf(sql,
+				session.engine.Quote(tableName),
+				session.engine.QuoteStr(),
+				strings.Join(colNames, session.engine.QuoteStr()+", "+session.engine.QuoteStr()),
+				session.engine.QuoteStr(),
+				strings.Join(colMultiPlaces[start:end], "),("))
+		}
+
+		// the autoincrement ids could be returned with the records
+		var chunkReturning = returning
+		if aiCol != nil && returningMode != returningReselect {
+			chunkReturning = []string{aiCol.Name}
+		}
+		if chunkReturning != nil {
+			switch returningMode {
+			case returningClause:
+				statement = session.genReturningSQL(statement, table, chunkReturning)
+			case returningOutput:
+				var idx int
+				if isUpsert {
+					idx = strings.LastIndex(statement, ";")
+				} else {
+					idx = strings.Index(statement, " VALUES (")
+				}
+				statement = session.genOutputSQL(statement, idx, table, chunkReturning, "INSERTED.")
+			}
+		}
+
+		var cnt int64
+		if chunkReturning != nil && returningMode != returningReselect {
+			rows, err := session.queryRows(statement, chunkArgs...)
+			if err != nil {
+				return 0, err
+			}
+			if returningKeys != nil {
+				cnt, err = session.scanReturningByKeys(rows, table, beans[start:end], returningKeys)
+			} else {
+				cnt, err = session.scanReturning(rows, table, beans[start:end])
+			}
+			if err != nil {
+				return affected + cnt, err
+			}
+		} else {
+			res, err := session.exec(statement, chunkArgs...)
+			if err != nil {
+				return 0, err
+			}
+			if cnt, err = res.RowsAffected(); err != nil {
+				return 0, err
+			}
+
+			if aiCol != nil && cnt == int64(end-start) {
+				if err = session.fillInsertMultiIDs(aiCol, res, beans[start:end]); err != nil {
+					return affected + cnt, err
+				}
+			}
+		}
+		affected += cnt
+		start = end
 	}
 
 	if cacher := session.engine.getCacher2(table); cacher != nil && session.statement.UseCache {
-		session.cacheInsert(table, tableName)
+		session.cacheInsert(table, isUpsert, tableName)
 	}
 
-	lenAfterClosures := len(session.afterClosures)
-	for i := 0; i < size; i++ {
-		elemValue := reflect.Indirect(sliceValue.Index(i)).Addr().Interface()
+	session.afterInsertMulti(beans)
 
+	if returning != nil && returningMode == returningReselect {
+		for _, bean := range beans {
+			// the record is not known if its id is not returned by the driver
+			if err := session.reselect(table, tableName, returning, bean, nil); err != nil && err != errReselectUnknown {
+				return affected, err
+			}
+		}
+	}
+
+	if ownTx {
+		if err := session.Commit(); err != nil {
+			return 0, err
+		}
+	}
+	return affected, nil
+}
+
+// batchLimitDialect is implemented by the dialects which limit the number of the
+// rows, the parameters or the bytes of one statement, 0 means no limit
+type batchLimitDialect interface {
+	BatchLimits() (maxRows, maxParams, maxBytes int)
+}
+
+// insertMultiChunks splits the rows into chunks by the limits of the dialect and
+// the batch size, which could only make the chunks smaller, the end indexes of
+// the chunks will be returned
+func (session *Session) insertMultiChunks(colNum int, args []interface{}, rowsArgsEnd []int) []int {
+	var maxRows, maxParams, maxBytes int
+	if dialect, ok := session.engine.dialect.(batchLimitDialect); ok {
+		maxRows, maxParams, maxBytes = dialect.BatchLimits()
+		if maxParams > 0 && colNum > 0 && (maxRows == 0 || maxParams/colNum < maxRows) {
+			maxRows = maxParams / colNum
+		}
+		// reserve some bytes for the other parts of the statement
+		maxBytes -= 1024
+	}
+	if batchSize := session.statement.batchSize; batchSize > 0 && (maxRows == 0 || batchSize < maxRows) {
+		maxRows = batchSize
+	}
+
+	var ends []int
+	var rows, bytes, argsStart int
+	for i, argsEnd := range rowsArgsEnd {
+		var rowBytes int
+		if maxBytes > 0 {
+			// the placeholders and the values
+			rowBytes = 3 * colNum
+			for _, arg := range args[argsStart:argsEnd] {
+				rowBytes += argSize(arg)
+			}
+		}
+		if rows > 0 && ((maxRows > 0 && rows >= maxRows) || (maxBytes > 0 && bytes+rowBytes > maxBytes)) {
+			ends = append(ends, i)
+			rows, bytes = 0, 0
+		}
+		rows++
+		bytes += rowBytes
+		argsStart = argsEnd
+	}
+	return append(ends, len(rowsArgsEnd))
+}
+
+// argSize estimates the size of the argument when it's sent to the database
+func argSize(arg interface{}) int {
+	switch v := arg.(type) {
+	case string:
+		return len(v)
+	case []byte:
+		return len(v)
+	case nil:
+		return 1
+	}
+	return 8
+}
+
+// fillInsertMultiIDs fills back the autoincrement ids of the records inserted by
+// one statement. The ids of the records are continuous in one statement if the
+// auto_increment_increment of mysql is 1, mysql returns the first id and sqlite
+// returns the last one.
+func (session *Session) fillInsertMultiIDs(aiCol *core.Column, res sql.Result, beans []interface{}) error {
+	var dbType = session.engine.dialect.DBType()
+	if dbType != core.MYSQL && dbType != core.SQLITE {
+		return nil
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil || id <= 0 {
+		return nil
+	}
+	if dbType == core.SQLITE {
+		id = id - int64(len(beans)) + 1
+	}
+
+	for i, bean := range beans {
+		aiValue, err := aiCol.ValueOf(bean)
+		if err != nil {
+			return err
+		}
+		if aiValue == nil || !aiValue.IsValid() || !aiValue.CanSet() {
+			continue
+		}
+		aiValue.Set(int64ToIntValue(id+int64(i), aiValue.Type()))
+	}
+	return nil
+}
+
+// afterInsertMulti runs the after closures and AfterInsertProcessor of the inserted
+// beans, they will be delayed to the commit if the session is in a transaction
+func (session *Session) afterInsertMulti(beans []interface{}) {
+	lenAfterClosures := len(session.afterClosures)
+	for _, elemValue := range beans {
 		// handle AfterInsertProcessor
 		if session.isAutoCommit {
 			// !nashtsai! does user expect it's same slice to passed closure when using Before()/After() when insert multi??
@@ -275,7 +551,13 @@ func (session *Session) innerInsertMulti(rowsSlicePtr interface{}) (int64, error
 	}
 
 	cleanupProcessorsClosures(&session.afterClosures)
-	return res.RowsAffected()
+}
+
+// BatchSize sets the max number of the records inserted by one statement of
+// InsertMulti, the records will be split by the limits of the database by default.
+func (session *Session) BatchSize(size int) *Session {
+	session.statement.batchSize = size
+	return session
 }
 
 // InsertMulti insert multiple records
@@ -297,7 +579,7 @@ func (session *Session) InsertMulti(rowsSlicePtr interface{}) (int64, error) {
 	return session.innerInsertMulti(rowsSlicePtr)
 }
 
-func (session *Session) innerInsert(bean interface{}) (int64, error) {
+func (session *Session) innerInsert(bean interface{}) (affected int64, err error) {
 	if err := session.statement.setRefValue(rValue(bean)); err != nil {
 		return 0, err
 	}
@@ -364,6 +646,57 @@ func (session *Session) innerInsert(bean interface{}) (int64, error) {
 		}
 	}
 
+	// the conflicting record may be updated by upsert, so its id is unknown
+	var isUpsert = session.statement.conflict != nil
+	if isUpsert && len(colNames) == 0 {
+		return 0, errors.New("upsert needs at least one inserted column")
+	}
+	// the version of the conflicting record is read back on postgres
+	var readVersion = isUpsert && table.Version != "" && session.statement.checkVersion
+	if isUpsert {
+		var places = make([]string, 0, len(colNames))
+		for i := 0; i < len(colNames)-len(exprColumns); i++ {
+			places = append(places, "?")
+		}
+		places = append(places, exprColVals...)
+		sqlStr, err = session.genUpsertSQL(tableName, colNames, [][]string{places})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var returning = session.statement.returning
+	var returningMode = session.engine.returningMode()
+	if returning != nil {
+		if err = returningBean(bean); err != nil {
+			return 0, err
+		}
+
+		switch returningMode {
+		case returningClause:
+			sqlStr = session.genReturningSQL(sqlStr, table, returning)
+		case returningOutput:
+			var idx int
+			if isUpsert {
+				idx = strings.LastIndex(sqlStr, ";")
+			} else if len(colPlaces) > 0 {
+				idx = strings.Index(sqlStr, " VALUES (")
+			} else {
+				idx = strings.Index(sqlStr, " DEFAULT VALUES")
+			}
+			sqlStr = session.genOutputSQL(sqlStr, idx, table, returning, "INSERTED.")
+		case returningReselect:
+			defer func() {
+				if err == nil && affected > 0 {
+					// the record is not known if its id is not returned by the driver
+					if err = session.reselect(table, tableName, returning, bean, nil); err == errReselectUnknown {
+						err = nil
+					}
+				}
+			}()
+		}
+	}
+
 	handleAfterInsertProcessorFunc := func(bean interface{}) {
 		if session.isAutoCommit {
 			for _, closure := range session.afterClosures {
@@ -392,6 +725,21 @@ func (session *Session) innerInsert(bean interface{}) (int64, error) {
 		cleanupProcessorsClosures(&session.afterClosures) // cleanup after used
 	}
 
+	if returning != nil && returningMode != returningReselect {
+		rows, err := session.queryRows(sqlStr, args...)
+		if err != nil {
+			return 0, err
+		}
+
+		defer handleAfterInsertProcessorFunc(bean)
+
+		if cacher := session.engine.getCacher2(table); cacher != nil && session.statement.UseCache {
+			session.cacheInsert(table, isUpsert, tableName)
+		}
+
+		return session.scanReturning(rows, table, []interface{}{bean})
+	}
+
 	// for postgres, many of them didn't implement lastInsertId, so we should
 	// implemented it ourself.
 	if session.engine.dialect.DBType() == core.ORACLE && len(table.AutoIncrement) > 0 {
@@ -403,7 +751,7 @@ func (session *Session) innerInsert(bean interface{}) (int64, error) {
 		defer handleAfterInsertProcessorFunc(bean)
 
 		if cacher := session.engine.getCacher2(table); cacher != nil && session.statement.UseCache {
-			session.cacheInsert(table, tableName)
+			session.cacheInsert(table, isUpsert, tableName)
 		}
 
 		if table.Version != "" && session.statement.checkVersion {
@@ -437,9 +785,16 @@ func (session *Session) innerInsert(bean interface{}) (int64, error) {
 		aiValue.Set(int64ToIntValue(id, aiValue.Type()))
 
 		return 1, nil
-	} else if session.engine.dialect.DBType() == core.POSTGRES && len(table.AutoIncrement) > 0 {
-		//assert table.AutoIncrement != ""
-		sqlStr = sqlStr + " RETURNING " + session.engine.Quote(table.AutoIncrement)
+	} else if session.engine.dialect.DBType() == core.POSTGRES && (len(table.AutoIncrement) > 0 || readVersion) {
+		var returnCols = make([]string, 0, 2)
+		if len(table.AutoIncrement) > 0 {
+			returnCols = append(returnCols, session.engine.Quote(table.AutoIncrement))
+		}
+		if readVersion {
+			// the version of the conflicting record is increased by the upsert
+			returnCols = append(returnCols, session.engine.Quote(table.Version))
+		}
+		sqlStr = sqlStr + " RETURNING " + strings.Join(returnCols, ", ")
 		res, err := session.queryBytes(sqlStr, args...)
 
 		if err != nil {
@@ -448,20 +803,35 @@ func (session *Session) innerInsert(bean interface{}) (int64, error) {
 		defer handleAfterInsertProcessorFunc(bean)
 
 		if cacher := session.engine.getCacher2(table); cacher != nil && session.statement.UseCache {
-			session.cacheInsert(table, tableName)
+			session.cacheInsert(table, isUpsert, tableName)
+		}
+
+		if len(res) < 1 {
+			if isUpsert {
+				// nothing is returned when the conflicting record is ignored
+				return 0, nil
+			}
+			return 0, errors.New("insert no error but not returned id")
 		}
 
 		if table.Version != "" && session.statement.checkVersion {
+			var version int64 = 1
+			if readVersion {
+				version, err = strconv.ParseInt(string(res[0][table.Version]), 10, 64)
+				if err != nil {
+					return 1, err
+				}
+			}
 			verValue, err := table.VersionColumn().ValueOf(bean)
 			if err != nil {
 				session.engine.logger.Error(err)
 			} else if verValue.IsValid() && verValue.CanSet() {
-				verValue.SetInt(1)
+				verValue.SetInt(version)
 			}
 		}
 
-		if len(res) < 1 {
-			return 0, errors.New("insert no error but not returned id")
+		if len(table.AutoIncrement) == 0 {
+			return 1, nil
 		}
 
 		idByte := res[0][table.AutoIncrement]
@@ -491,10 +861,12 @@ func (session *Session) innerInsert(bean interface{}) (int64, error) {
 		defer handleAfterInsertProcessorFunc(bean)
 
 		if cacher := session.engine.getCacher2(table); cacher != nil && session.statement.UseCache {
-			session.cacheInsert(table, tableName)
+			session.cacheInsert(table, isUpsert, tableName)
 		}
 
-		if table.Version != "" && session.statement.checkVersion {
+		// the version of the record updated by upsert is unknown, it's only known
+		// to be 1 if mysql reports the record is inserted
+		if table.Version != "" && session.statement.checkVersion && (!isUpsert || isUpsertInserted(session.engine.dialect, res)) {
 			verValue, err := table.VersionColumn().ValueOf(bean)
 			if err != nil {
 				session.engine.logger.Error(err)
@@ -507,6 +879,11 @@ func (session *Session) innerInsert(bean interface{}) (int64, error) {
 			return res.RowsAffected()
 		}
 
+		// only mysql returns the id of the updated record by LAST_INSERT_ID
+		if isUpsert && session.engine.dialect.DBType() != core.MYSQL {
+			return res.RowsAffected()
+		}
+
 		var id int64
 		id, err = res.LastInsertId()
 		if err != nil || id <= 0 {
@@ -528,6 +905,16 @@ func (session *Session) innerInsert(bean interface{}) (int64, error) {
 	}
 }
 
+// isUpsertInserted returns true if the record is inserted but not updated by the
+// upsert, mysql reports 1 affected row for an inserted record and 2 for an updated one
+func isUpsertInserted(dialect core.Dialect, res sql.Result) bool {
+	if dialect.DBType() != core.MYSQL {
+		return false
+	}
+	affected, err := res.RowsAffected()
+	return err == nil && affected == 1
+}
+
 // InsertOne insert only one struct into database as a record.
 // The in parameter bean must a struct or a point to struct. The return
 // parameter is inserted and error
@@ -539,7 +926,7 @@ func (session *Session) InsertOne(bean interface{}) (int64, error) {
 	return session.innerInsert(bean)
 }
 
-func (session *Session) cacheInsert(table *core.Table, tables ...string) error {
+func (session *Session) cacheInsert(table *core.Table, clearBeans bool, tables ...string) error {
 	if table == nil {
 		return ErrCacheFailed
 	}
@@ -548,6 +935,11 @@ func (session *Session) cacheInsert(table *core.Table, tables ...string) error {
 	for _, t := range tables {
 		session.engine.logger.Debug("[cache] clear sql:", t)
 		cacher.ClearIds(t)
+		if clearBeans {
+			// the existing records may be updated by upsert
+			session.engine.logger.Debug("[cache] clear beans:", t)
+			cacher.ClearBeans(t)
+		}
 	}
 
 	return nil
@@ -11,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-xorm/core"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -740,3 +741,87 @@ func TestInsertMulti4(t *testing.T) {
 	assert.NoError(t, err)
 	assert.EqualValues(t, len(users), cnt)
 }
+
+func TestInsertMultiChunks(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+
+	type InsertMultiChunk struct {
+		Id    int64
+		Name  string
+		Score int
+	}
+
+	assertSync(t, new(InsertMultiChunk))
+
+	var records = make([]InsertMultiChunk, 2500)
+	for i := range records {
+		records[i].Name = fmt.Sprintf("name%d", i)
+		records[i].Score = i
+	}
+
+	cnt, err := testEngine.Insert(&records)
+	assert.NoError(t, err)
+	assert.EqualValues(t, len(records), cnt)
+
+	total, err := testEngine.Count(new(InsertMultiChunk))
+	assert.NoError(t, err)
+	assert.EqualValues(t, len(records), total)
+
+	if testEngine.Dialect().DBType() == core.MYSQL || testEngine.Dialect().DBType() == core.SQLITE ||
+		testEngine.Dialect().DBType() == core.POSTGRES {
+		for _, record := range records {
+			var found InsertMultiChunk
+			has, err := testEngine.ID(record.Id).Get(&found)
+			assert.NoError(t, err)
+			assert.True(t, has)
+			assert.EqualValues(t, record.Name, found.Name)
+			if record.Id > 3 {
+				break
+			}
+		}
+		assert.EqualValues(t, records[0].Id+int64(len(records)-1), records[len(records)-1].Id)
+	}
+
+	records = make([]InsertMultiChunk, 25)
+	session := testEngine.NewSession()
+	defer session.Close()
+	assert.NoError(t, session.Begin())
+	cnt, err = session.BatchSize(10).InsertMulti(&records)
+	assert.NoError(t, err)
+	assert.EqualValues(t, len(records), cnt)
+	assert.NoError(t, session.Rollback())
+
+	total, err = testEngine.Count(new(InsertMultiChunk))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2500, total)
+
+	// the limits of the dialect are kept with a larger batch size
+	records = make([]InsertMultiChunk, 1500)
+	cnt, err = session.BatchSize(1000).Insert(&records)
+	assert.NoError(t, err)
+	assert.EqualValues(t, len(records), cnt)
+
+	total, err = testEngine.Count(new(InsertMultiChunk))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 4000, total)
+
+	// the batch size only makes the chunks smaller than the limits of the dialect
+	var args = make([]interface{}, 3*1500)
+	var rowsArgsEnd = make([]int, 1500)
+	for i := range rowsArgsEnd {
+		rowsArgsEnd[i] = 3 * (i + 1)
+	}
+	if dialect, ok := testEngine.Dialect().(batchLimitDialect); ok {
+		_, maxParams, _ := dialect.BatchLimits()
+		session.BatchSize(1000)
+		var start int
+		for _, end := range session.insertMultiChunks(3, args, rowsArgsEnd) {
+			assert.True(t, end-start <= 1000)
+			if maxParams > 0 {
+				assert.True(t, 3*(end-start) <= maxParams)
+			}
+			start = end
+		}
+		session.BatchSize(0)
+	}
+}
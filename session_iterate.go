@@ -26,6 +26,9 @@ func (session *Session) Iterate(bean interface{}, fun IterFunc) error {
 	if session.statement.bufferSize > 0 {
 		return session.bufferIterate(bean, fun)
 	}
+	if session.statement.preload && session.statement.UseCascade {
+		return session.preloadIterate(bean, fun)
+	}
 
 	rows, err := session.Rows(bean)
 	if err != nil {
@@ -66,11 +69,16 @@ func (session *Session) bufferIterate(bean interface{}, fun IterFunc) error {
 		bufferSize = limit
 	}
 	var start = session.statement.Start
+	var preload, preloadFields = session.statement.preload, session.statement.preloadFields
 	v := rValue(bean)
 	sliceType := reflect.SliceOf(v.Type())
 	var idx = 0
 	for {
 		slice := reflect.New(sliceType)
+		if preload && !session.statement.preload {
+			// the statement is reset by the find of the last buffer
+			session.Preload(preloadFields...)
+		}
 		if err := session.Limit(bufferSize, start).find(slice.Interface(), bean); err != nil {
 			return err
 		}
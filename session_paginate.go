@@ -0,0 +1,417 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-xorm/builder"
+	"github.com/go-xorm/core"
+)
+
+// newCursorKey returns a random key for signing the cursors
+func newCursorKey() []byte {
+	var key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// SetCursorKey sets the key signing the cursors of pagination. The key is random
+// by default, so the same key should be set for all the processes sharing the
+// cursors.
+func (engine *Engine) SetCursorKey(key []byte) {
+	engine.cursorKey = key
+}
+
+// Paginate makes Find return at most size records with the keyset pagination,
+// the records are seeked by the values of the ordering columns instead of
+// OFFSET. The primary key is appended to the ordering as the tie-breaker, and
+// the cursors of the next and previous pages are returned by Cursors.
+func (session *Session) Paginate(size int) *Session {
+	session.statement.pageSize = size
+	return session
+}
+
+// AfterCursor makes the paginated Find return the page after the cursor
+func (session *Session) AfterCursor(cursor string) *Session {
+	session.statement.pageCursor = cursor
+	session.statement.pageBefore = false
+	return session
+}
+
+// BeforeCursor makes the paginated Find return the page before the cursor
+func (session *Session) BeforeCursor(cursor string) *Session {
+	session.statement.pageCursor = cursor
+	session.statement.pageBefore = true
+	return session
+}
+
+// Cursors returns the cursors of the next and previous pages of the last paginated
+// Find, the cursor is empty if there is no such page
+func (session *Session) Cursors() (next, prev string) {
+	return session.nextCursor, session.prevCursor
+}
+
+// pageOrder is a column of the ordering of pagination
+type pageOrder struct {
+	expr     string // the column in the sql
+	name     string // the name of the column in the table
+	desc     bool
+	nullable bool
+}
+
+// pageOrders parses the ordering of the statement and appends the primary keys
+func (statement *Statement) pageOrders(table *core.Table) ([]pageOrder, error) {
+	var orders []pageOrder
+	var names = make(map[string]bool)
+	if len(strings.TrimSpace(statement.OrderStr)) > 0 {
+		for _, item := range strings.Split(statement.OrderStr, ",") {
+			fields := strings.Fields(item)
+			if len(fields) == 0 || len(fields) > 2 {
+				return nil, fmt.Errorf("unsupported ordering %q of pagination", item)
+			}
+			var order = pageOrder{expr: fields[0]}
+			if len(fields) == 2 {
+				switch strings.ToUpper(fields[1]) {
+				case "ASC":
+				case "DESC":
+					order.desc = true
+				default:
+					return nil, fmt.Errorf("unsupported ordering %q of pagination", item)
+				}
+			}
+			parts := strings.Split(fields[0], ".")
+			order.name = strings.Trim(parts[len(parts)-1], "`\"[]")
+			col := table.GetColumn(order.name)
+			if col == nil {
+				return nil, fmt.Errorf("the ordering column %s of pagination is not in table %s", order.name, table.Name)
+			}
+			order.nullable = col.Nullable
+			names[strings.ToLower(order.name)] = true
+			orders = append(orders, order)
+		}
+	}
+
+	if len(table.PrimaryKeys) == 0 {
+		return nil, errors.New("pagination needs the primary key as the tie-breaker")
+	}
+	for _, col := range table.PKColumns() {
+		if !names[strings.ToLower(col.Name)] {
+			orders = append(orders, pageOrder{
+				expr: statement.colName(col, statement.TableName()),
+				name: col.Name,
+			})
+		}
+	}
+	return orders, nil
+}
+
+// nullsLargest returns true if NULL is ordered as the largest value by the database
+func nullsLargest(dbType core.DbType) bool {
+	return dbType == core.POSTGRES || dbType == core.ORACLE
+}
+
+// seekCond returns the condition of the records after the values in the ordering
+func (statement *Statement) seekCond(orders []pageOrder, values []interface{}) builder.Cond {
+	var largest = nullsLargest(statement.Engine.dialect.DBType())
+	var conds []builder.Cond
+	for i, order := range orders {
+		var greater = !order.desc
+		var cmp builder.Cond
+		if values[i] == nil {
+			// the records after NULL are the ones not NULL if NULL is the first
+			if greater != largest {
+				cmp = builder.NotNull{order.expr}
+			}
+		} else {
+			var op = "<"
+			if greater {
+				op = ">"
+			}
+			cmp = builder.Expr(fmt.Sprintf("%s %s ?", order.expr, op), values[i])
+			if greater == largest && order.nullable {
+				// NULL is after any value
+				cmp = builder.Or(cmp, builder.IsNull{order.expr})
+			}
+		}
+
+		if cmp != nil {
+			var cond = builder.NewCond()
+			for j := 0; j < i; j++ {
+				if values[j] == nil {
+					cond = cond.And(builder.IsNull{orders[j].expr})
+				} else {
+					cond = cond.And(builder.Expr(orders[j].expr+" = ?", values[j]))
+				}
+			}
+			conds = append(conds, cond.And(cmp))
+		}
+	}
+
+	if len(conds) == 0 {
+		return builder.Expr("1=0")
+	}
+	return builder.Or(conds...)
+}
+
+// cursorValue is a typed value of a cursor
+type cursorValue struct {
+	Kind  string `json:"k"`
+	Value string `json:"v,omitempty"`
+}
+
+// cursorPayload is the content of a cursor, the columns are kept to check if the
+// cursor is made for the ordering
+type cursorPayload struct {
+	Columns []string      `json:"c"`
+	Values  []cursorValue `json:"v"`
+}
+
+func orderColumns(orders []pageOrder) []string {
+	var cols = make([]string, 0, len(orders))
+	for _, order := range orders {
+		if order.desc {
+			cols = append(cols, order.name+" DESC")
+		} else {
+			cols = append(cols, order.name)
+		}
+	}
+	return cols
+}
+
+func encodeCursorValue(v interface{}) (cursorValue, error) {
+	if v == nil {
+		return cursorValue{Kind: "n"}, nil
+	}
+	switch t := v.(type) {
+	case []byte:
+		return cursorValue{Kind: "x", Value: base64.RawURLEncoding.EncodeToString(t)}, nil
+	case time.Time:
+		return cursorValue{Kind: "t", Value: t.Format(time.RFC3339Nano)}, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return cursorValue{Kind: "b", Value: strconv.FormatBool(rv.Bool())}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cursorValue{Kind: "i", Value: strconv.FormatInt(rv.Int(), 10)}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cursorValue{Kind: "u", Value: strconv.FormatUint(rv.Uint(), 10)}, nil
+	case reflect.Float32, reflect.Float64:
+		return cursorValue{Kind: "f", Value: strconv.FormatFloat(rv.Float(), 'g', -1, 64)}, nil
+	case reflect.String:
+		return cursorValue{Kind: "s", Value: rv.String()}, nil
+	}
+	return cursorValue{}, fmt.Errorf("unsupported cursor value type %T", v)
+}
+
+func decodeCursorValue(v cursorValue) (interface{}, error) {
+	switch v.Kind {
+	case "n":
+		return nil, nil
+	case "x":
+		return base64.RawURLEncoding.DecodeString(v.Value)
+	case "t":
+		return time.Parse(time.RFC3339Nano, v.Value)
+	case "b":
+		return strconv.ParseBool(v.Value)
+	case "i":
+		return strconv.ParseInt(v.Value, 10, 64)
+	case "u":
+		return strconv.ParseUint(v.Value, 10, 64)
+	case "f":
+		return strconv.ParseFloat(v.Value, 64)
+	case "s":
+		return v.Value, nil
+	}
+	return nil, ErrInvalidCursor
+}
+
+func (engine *Engine) signCursor(data []byte) []byte {
+	mac := hmac.New(sha256.New, engine.cursorKey)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// encodeCursor returns the signed cursor of the values of the ordering
+func (engine *Engine) encodeCursor(orders []pageOrder, values []interface{}) (string, error) {
+	var payload = cursorPayload{Columns: orderColumns(orders)}
+	for _, v := range values {
+		cv, err := encodeCursorValue(v)
+		if err != nil {
+			return "", err
+		}
+		payload.Values = append(payload.Values, cv)
+	}
+	data, err := json.Marshal(&payload)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data) + "." +
+		base64.RawURLEncoding.EncodeToString(engine.signCursor(data)), nil
+}
+
+// decodeCursor verifies the cursor and returns the values of the ordering
+func (engine *Engine) decodeCursor(orders []pageOrder, cursor string) ([]interface{}, error) {
+	parts := strings.Split(cursor, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sig, engine.signCursor(data)) {
+		return nil, ErrInvalidCursor
+	}
+
+	var payload cursorPayload
+	if err = json.Unmarshal(data, &payload); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if strings.Join(payload.Columns, ",") != strings.Join(orderColumns(orders), ",") ||
+		len(payload.Values) != len(orders) {
+		return nil, ErrInvalidCursor
+	}
+
+	var values = make([]interface{}, 0, len(payload.Values))
+	for _, cv := range payload.Values {
+		v, err := decodeCursorValue(cv)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// rowCursor returns the cursor of the values of the ordering of the record
+func (session *Session) rowCursor(table *core.Table, orders []pageOrder, record reflect.Value) (string, error) {
+	var elem = reflect.Indirect(record)
+	var values = make([]interface{}, 0, len(orders))
+	for _, order := range orders {
+		col := table.GetColumn(order.name)
+		fieldValue, err := col.ValueOfV(&elem)
+		if err != nil {
+			return "", err
+		}
+		v, err := session.value2Interface(col, *fieldValue)
+		if err != nil {
+			return "", err
+		}
+		values = append(values, v)
+	}
+	return session.engine.encodeCursor(orders, values)
+}
+
+// findPage finds a page of the records by the keyset pagination
+func (session *Session) findPage(rowsSlicePtr interface{}, condiBean ...interface{}) error {
+	session.nextCursor, session.prevCursor = "", ""
+	if session.statement.pageSize <= 0 {
+		return errors.New("the page size should be positive")
+	}
+
+	sliceValue := reflect.Indirect(reflect.ValueOf(rowsSlicePtr))
+	if sliceValue.Kind() != reflect.Slice {
+		return errors.New("pagination needs a pointer to a slice")
+	}
+	elemType := sliceValue.Type().Elem()
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return errors.New("pagination needs a slice of structs")
+	}
+	if session.statement.RefTable == nil {
+		if err := session.statement.setRefValue(reflect.New(elemType).Elem()); err != nil {
+			return err
+		}
+	}
+
+	// the statement will be reset after the query
+	var table = session.statement.RefTable
+	var size = session.statement.pageSize
+	var cursor = session.statement.pageCursor
+	var before = session.statement.pageBefore
+
+	orders, err := session.statement.pageOrders(table)
+	if err != nil {
+		return err
+	}
+	var seekOrders = orders
+	if before {
+		// the page before the cursor is seeked in the reversed ordering
+		seekOrders = make([]pageOrder, len(orders))
+		for i, order := range orders {
+			order.desc = !order.desc
+			seekOrders[i] = order
+		}
+	}
+
+	if cursor != "" {
+		values, err := session.engine.decodeCursor(orders, cursor)
+		if err != nil {
+			return err
+		}
+		session.statement.cond = session.statement.cond.And(session.statement.seekCond(seekOrders, values))
+	}
+
+	var orderStrs = make([]string, 0, len(seekOrders))
+	for _, order := range seekOrders {
+		if order.desc {
+			orderStrs = append(orderStrs, order.expr+" DESC")
+		} else {
+			orderStrs = append(orderStrs, order.expr+" ASC")
+		}
+	}
+	session.statement.OrderStr = strings.Join(orderStrs, ", ")
+	session.statement.Limit(size + 1)
+
+	var start = sliceValue.Len()
+	if err = session.find(rowsSlicePtr, condiBean...); err != nil {
+		return err
+	}
+
+	var hasMore = sliceValue.Len()-start > size
+	if hasMore {
+		sliceValue.Set(sliceValue.Slice(0, start+size))
+	}
+	var records = sliceValue.Slice(start, sliceValue.Len())
+	if before {
+		swap := reflect.Swapper(records.Interface())
+		for i, j := 0, records.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+	if records.Len() == 0 {
+		return nil
+	}
+
+	if (hasMore && !before) || (before && cursor != "") {
+		if session.nextCursor, err = session.rowCursor(table, orders, records.Index(records.Len()-1)); err != nil {
+			return err
+		}
+	}
+	if (hasMore && before) || (!before && cursor != "") {
+		if session.prevCursor, err = session.rowCursor(table, orders, records.Index(0)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/go-xorm/core"
+)
+
+// the default number of the primary keys in one IN query of preloading
+const defaultPreloadChunkSize = 500
+
+// preloadState records the fields to be preloaded while the rows of a Find or
+// Iterate are scanned, since the statement is reset after the query is executed
+type preloadState struct {
+	fields map[string]bool // nil means all the fields
+	cols   []*core.Column  // the columns which have been set to placeholders
+	beans  []reflect.Value // the pointers to the scanned beans
+}
+
+// Preload makes Find and Iterate load the struct fields which reference other
+// tables in batches instead of one query per row when cascade is on. The primary
+// keys of the whole result are collected and every referenced table is queried
+// with IN in chunks. Only the given fields are preloaded, or all of them if no
+// field name is given.
+func (session *Session) Preload(fieldNames ...string) *Session {
+	session.statement.preload = true
+	session.statement.preloadFields = append(session.statement.preloadFields, fieldNames...)
+	return session
+}
+
+// beginPreload moves the preload settings from the statement to the session, it
+// returns false if preloading is not required
+func (session *Session) beginPreload() bool {
+	if !session.statement.preload || !session.statement.UseCascade {
+		return false
+	}
+
+	var state preloadState
+	if len(session.statement.preloadFields) > 0 {
+		state.fields = make(map[string]bool, len(session.statement.preloadFields))
+		for _, name := range session.statement.preloadFields {
+			state.fields[name] = true
+		}
+	}
+	session.preloading = &state
+	return true
+}
+
+// preloadPlaceholder sets the field to a struct only with the primary key instead
+// of loading the referenced record if the field should be preloaded, the record
+// will be loaded after all the rows are scanned
+func (session *Session) preloadPlaceholder(col *core.Column, fieldValue *reflect.Value, refTable *core.Table, pk core.PK) (bool, error) {
+	var state = session.preloading
+	if state == nil || col == nil || isPKZero(pk) ||
+		(state.fields != nil && !state.fields[col.FieldName]) {
+		return false, nil
+	}
+
+	var structValue reflect.Value
+	if fieldValue.Kind() == reflect.Ptr {
+		structValue = reflect.New(fieldValue.Type().Elem())
+	} else {
+		structValue = reflect.New(fieldValue.Type())
+	}
+	var elem = structValue.Elem()
+	pkValue, err := refTable.PKColumns()[0].ValueOfV(&elem)
+	if err != nil {
+		return false, err
+	}
+	if err = convertAssign(pkValue.Addr().Interface(), pk[0]); err != nil {
+		return false, err
+	}
+
+	if fieldValue.Kind() == reflect.Ptr {
+		fieldValue.Set(structValue)
+	} else {
+		fieldValue.Set(elem)
+	}
+
+	for _, c := range state.cols {
+		if c == col {
+			return true, nil
+		}
+	}
+	state.cols = append(state.cols, col)
+	return true, nil
+}
+
+// cascadeGet loads the record referenced by a field which is not preloaded. The
+// cacher is skipped while preloading, since a get hitting the cache doesn't reset
+// the statement and its conditions would be left to the next query of the rows.
+func (session *Session) cascadeGet(bean interface{}, pk core.PK) (bool, error) {
+	if session.preloading != nil {
+		session.NoCache()
+	}
+	return session.ID(pk).NoCascade().get(bean)
+}
+
+// preloadIterate scans the rows in batches, the fields of the beans of a batch are
+// preloaded before the beans are passed to the function
+func (session *Session) preloadIterate(bean interface{}, fun IterFunc) error {
+	session.beginPreload()
+	defer func() {
+		session.preloading = nil
+	}()
+
+	rows, err := session.Rows(bean)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var batchSize = session.preloadChunkSize()
+	var batch = make([]interface{}, 0, batchSize)
+	var idx int
+	var flush = func() error {
+		if err := session.preload(); err != nil {
+			return err
+		}
+		for _, b := range batch {
+			if err := fun(idx, b); err != nil {
+				return err
+			}
+			idx++
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for rows.Next() {
+		b := reflect.New(rows.beanType)
+		if err = rows.Scan(b.Interface()); err != nil {
+			return err
+		}
+		session.preloading.beans = append(session.preloading.beans, b)
+		batch = append(batch, b.Interface())
+		if len(batch) >= batchSize {
+			if err = flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// preloadChunkSize returns the max number of the primary keys of one IN query
+func (session *Session) preloadChunkSize() int {
+	if dialect, ok := session.engine.dialect.(batchLimitDialect); ok {
+		if _, maxParams, _ := dialect.BatchLimits(); maxParams > 0 && maxParams < defaultPreloadChunkSize {
+			return maxParams
+		}
+	}
+	return defaultPreloadChunkSize
+}
+
+// preload loads the records referenced by the placeholders of the scanned beans
+func (session *Session) preload() error {
+	var state = session.preloading
+	if state == nil {
+		return nil
+	}
+
+	// the queries of preloading should not be preloaded, and the beans are
+	// collected again by the next batch of Iterate
+	session.preloading = nil
+	defer func() {
+		state.cols = nil
+		state.beans = nil
+		session.preloading = state
+	}()
+
+	// the processors of the scanned beans, which append them to the result, should
+	// not be executed by the queries of preloading
+	var processors = session.afterProcessors
+	session.afterProcessors = nil
+	defer func() {
+		session.afterProcessors = append(processors, session.afterProcessors...)
+	}()
+
+	for _, col := range state.cols {
+		if err := session.preloadColumn(state.beans, col); err != nil {
+			return err
+		}
+	}
+	return session.preloadRelations(state.beans, state.fields)
+}
+
+// preloadColumn loads the records referenced by the field of the column
+func (session *Session) preloadColumn(beans []reflect.Value, col *core.Column) error {
+	var refType reflect.Type
+	var refTable *core.Table
+	var pks []interface{}
+	var seen = make(map[interface{}]bool)
+
+	for _, bean := range beans {
+		var elem = bean.Elem()
+		fieldValue, err := col.ValueOfV(&elem)
+		if err != nil {
+			return err
+		}
+		var ref = reflect.Indirect(*fieldValue)
+		if !ref.IsValid() {
+			continue
+		}
+		if refTable == nil {
+			refType = ref.Type()
+			if refTable, err = session.engine.autoMapType(ref); err != nil {
+				return err
+			}
+		}
+		pkValue, err := refTable.PKColumns()[0].ValueOfV(&ref)
+		if err != nil {
+			return err
+		}
+		if pk := pkValue.Interface(); !isPKZero(core.PK{pk}) && !seen[pk] {
+			seen[pk] = true
+			pks = append(pks, pk)
+		}
+	}
+	if len(pks) == 0 {
+		return nil
+	}
+
+	var pkCol = refTable.PKColumns()[0]
+	var records = make(map[interface{}]reflect.Value, len(pks))
+	var chunkSize = session.preloadChunkSize()
+	for start := 0; start < len(pks); start += chunkSize {
+		end := start + chunkSize
+		if end > len(pks) {
+			end = len(pks)
+		}
+
+		// the table is set explicitly since Iterate keeps the table of the rows, and
+		// the cacher is skipped as cascadeGet does
+		slice := reflect.New(reflect.SliceOf(reflect.PtrTo(refType)))
+		err := session.Table(reflect.New(refType).Interface()).NoCascade().NoCache().
+			In(session.engine.Quote(pkCol.Name), pks[start:end]...).find(slice.Interface())
+		if err != nil {
+			return err
+		}
+		for i := 0; i < slice.Elem().Len(); i++ {
+			record := slice.Elem().Index(i)
+			elem := record.Elem()
+			pkValue, err := pkCol.ValueOfV(&elem)
+			if err != nil {
+				return err
+			}
+			records[pkValue.Interface()] = record
+		}
+	}
+
+	for _, bean := range beans {
+		var elem = bean.Elem()
+		fieldValue, err := col.ValueOfV(&elem)
+		if err != nil {
+			return err
+		}
+		var ref = reflect.Indirect(*fieldValue)
+		if !ref.IsValid() {
+			continue
+		}
+		pkValue, err := pkCol.ValueOfV(&ref)
+		if err != nil {
+			return err
+		}
+		if isPKZero(core.PK{pkValue.Interface()}) {
+			continue
+		}
+		record, ok := records[pkValue.Interface()]
+		if !ok {
+			return errors.New("cascade obj is not exist")
+		}
+		if fieldValue.Kind() == reflect.Ptr {
+			fieldValue.Set(record)
+		} else {
+			fieldValue.Set(record.Elem())
+		}
+	}
+	return nil
+}
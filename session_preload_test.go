@@ -0,0 +1,91 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type PreloadAuthor struct {
+	Id   int64
+	Name string
+}
+
+type PreloadBook struct {
+	Id     int64
+	Title  string
+	Author *PreloadAuthor `xorm:"author_id int(11)"`
+	Editor PreloadAuthor  `xorm:"editor_id int(11)"`
+}
+
+func TestPreload(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+	assertSync(t, new(PreloadAuthor), new(PreloadBook))
+
+	var authors = []*PreloadAuthor{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	for _, author := range authors {
+		_, err := testEngine.Insert(author)
+		assert.NoError(t, err)
+	}
+	for i := 0; i < 5; i++ {
+		_, err := testEngine.Insert(&PreloadBook{
+			Title:  "book",
+			Author: authors[i%2],
+			Editor: *authors[2],
+		})
+		assert.NoError(t, err)
+	}
+	_, err := testEngine.Insert(&PreloadBook{Title: "anonymous"})
+	assert.NoError(t, err)
+
+	session := testEngine.NewSession()
+	defer session.Close()
+
+	var books []PreloadBook
+	assert.NoError(t, session.Preload().Asc("id").Find(&books))
+	assert.EqualValues(t, 6, len(books))
+	for i, book := range books[:5] {
+		assert.EqualValues(t, authors[i%2].Name, book.Author.Name)
+		assert.EqualValues(t, "c", book.Editor.Name)
+	}
+	assert.Nil(t, books[5].Author)
+	assert.EqualValues(t, 0, books[5].Editor.Id)
+	sql, _ := session.LastSQL()
+	assert.True(t, strings.Contains(sql, " IN "), sql)
+
+	var bookPtrs []*PreloadBook
+	assert.NoError(t, session.Preload("Author").Where("author_id = ?", authors[1].Id).Find(&bookPtrs))
+	assert.EqualValues(t, 2, len(bookPtrs))
+	for _, book := range bookPtrs {
+		assert.EqualValues(t, "b", book.Author.Name)
+		assert.EqualValues(t, "c", book.Editor.Name)
+	}
+
+	var bookMap = make(map[int64]PreloadBook)
+	assert.NoError(t, session.Preload().Find(&bookMap))
+	assert.EqualValues(t, 6, len(bookMap))
+	assert.EqualValues(t, "a", bookMap[1].Author.Name)
+	assert.EqualValues(t, "c", bookMap[1].Editor.Name)
+
+	var cnt int
+	err = session.Preload().Asc("id").Iterate(new(PreloadBook), func(i int, bean interface{}) error {
+		book := bean.(*PreloadBook)
+		if book.Author != nil {
+			assert.EqualValues(t, authors[i%2].Name, book.Author.Name)
+			cnt++
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, cnt)
+
+	_, err = testEngine.ID(authors[0].Id).Delete(new(PreloadAuthor))
+	assert.NoError(t, err)
+	books = nil
+	assert.Error(t, session.Preload().Find(&books))
+}
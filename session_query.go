@@ -59,16 +59,11 @@ func (session *Session) genQuerySQL(sqlorArgs ...interface{}) (string, []interfa
 		return "", nil, err
 	}
 
-	args := append(session.statement.joinArgs, condArgs...)
+	args := session.statement.selectArgs(condArgs)
 	sqlStr, err := session.statement.genSelectSQL(columnStr, condSQL)
 	if err != nil {
 		return "", nil, err
 	}
-	// for mssql and use limit
-	qs := strings.Count(sqlStr, "?")
-	if len(args)*2 == qs {
-		args = append(args, args...)
-	}
 
 	return sqlStr, args, nil
 }
@@ -21,10 +21,17 @@ func (session *Session) queryPreprocess(sqlStr *string, paramStr ...interface{})
 	session.lastSQLArgs = paramStr
 }
 
-func (session *Session) queryRows(sqlStr string, args ...interface{}) (*core.Rows, error) {
+func (session *Session) queryRows(sqlStr string, args ...interface{}) (_ *core.Rows, err error) {
 	defer session.resetStatement()
 
 	session.queryPreprocess(&sqlStr, args...)
+	var kind = sqlKind(sqlStr)
+	defer session.markWrittenIfSucceeded(kind, &err)
+
+	db, sqlTag, err := session.routeDB(sqlStr, args, kind)
+	if err != nil {
+		return nil, err
+	}
 
 	if session.engine.showSQL {
 		if session.engine.showExecTime {
@@ -32,28 +39,21 @@ func (session *Session) queryRows(sqlStr string, args ...interface{}) (*core.Row
 			defer func() {
 				execDuration := time.Since(b4ExecTime)
 				if len(args) > 0 {
-					session.engine.logger.Infof("[SQL] %s %#v - took: %v", sqlStr, args, execDuration)
+					session.engine.logger.Infof("%s %s %#v - took: %v", sqlTag, sqlStr, args, execDuration)
 				} else {
-					session.engine.logger.Infof("[SQL] %s - took: %v", sqlStr, execDuration)
+					session.engine.logger.Infof("%s %s - took: %v", sqlTag, sqlStr, execDuration)
 				}
 			}()
 		} else {
 			if len(args) > 0 {
-				session.engine.logger.Infof("[SQL] %v %#v", sqlStr, args)
+				session.engine.logger.Infof("%s %v %#v", sqlTag, sqlStr, args)
 			} else {
-				session.engine.logger.Infof("[SQL] %v", sqlStr)
+				session.engine.logger.Infof("%s %v", sqlTag, sqlStr)
 			}
 		}
 	}
 
 	if session.isAutoCommit {
-		var db *core.DB
-		if session.engine.engineGroup != nil {
-			db = session.engine.engineGroup.Slave().DB()
-		} else {
-			db = session.DB()
-		}
-
 		if session.prepareStmt {
 			// don't clear stmt since session will cache them
 			stmt, err := session.doPrepare(db, sqlStr)
@@ -61,27 +61,95 @@ func (session *Session) queryRows(sqlStr string, args ...interface{}) (*core.Row
 				return nil, err
 			}
 
-			rows, err := stmt.Query(args...)
+			start := time.Now()
+			rows, err := stmt.QueryContext(session.ctx, args...)
+			session.observeLatency(db, time.Since(start), err)
 			if err != nil {
-				return nil, err
+				return nil, session.engine.translateError(err)
 			}
 			return rows, nil
 		}
 
-		rows, err := db.Query(sqlStr, args...)
+		start := time.Now()
+		rows, err := db.QueryContext(session.ctx, sqlStr, args...)
+		session.observeLatency(db, time.Since(start), err)
 		if err != nil {
-			return nil, err
+			return nil, session.engine.translateError(err)
 		}
 		return rows, nil
 	}
 
-	rows, err := session.tx.Query(sqlStr, args...)
+	rows, err := session.tx.QueryContext(session.ctx, sqlStr, args...)
 	if err != nil {
-		return nil, err
+		return nil, session.engine.translateError(err)
 	}
 	return rows, nil
 }
 
+// routeDB returns the database which the statement of the kind should go to and
+// the tag of its SQL log line. The statements of a transaction always go to the
+// database of the transaction, the autocommit statements of an engine group are
+// routed by the group, and the writes routed to another slave are rejected.
+func (session *Session) routeDB(sqlStr string, args []interface{}, kind SQLKind) (*core.DB, string, error) {
+	group := session.engine.engineGroup
+	if group == nil {
+		return session.DB(), "[SQL]", nil
+	}
+	if !session.isAutoCommit {
+		return session.DB(), "[SQL][" + group.engineName(session.engine) + "]", nil
+	}
+
+	var info = RouteInfo{
+		Context: session.ctx,
+		SQL:     sqlStr,
+		Args:    args,
+		Kind:    kind,
+	}
+	if info.Kind == ReadSQL && session.statement.IsForUpdate {
+		info.Kind = LockingReadSQL
+	}
+
+	engine := group.route(session, &info)
+	if info.Kind == WriteSQL && engine != session.engine && engine != group.Master() {
+		return nil, "", ErrWriteOnSlave
+	}
+
+	var db *core.DB
+	if engine == session.engine {
+		db = session.DB()
+	} else {
+		db = engine.DB()
+	}
+	return db, "[SQL][" + group.engineName(engine) + "]", nil
+}
+
+// observeLatency reports the latency of a query to the policy of the engine
+// group if the policy chooses the slaves by the latencies
+func (session *Session) observeLatency(db *core.DB, latency time.Duration, err error) {
+	group := session.engine.engineGroup
+	if group == nil || db == group.Master().DB() {
+		return
+	}
+	group.mutex.RLock()
+	observer, ok := group.policy.(latencyObserver)
+	group.mutex.RUnlock()
+	if ok {
+		observer.observe(db, latency, err)
+	}
+}
+
+// queryMasterRows queries the master of the engine group, it's used to read the
+// records just written which may not have been replicated to the slaves yet
+func (session *Session) queryMasterRows(sqlStr string, args ...interface{}) (*core.Rows, error) {
+	if group := session.engine.engineGroup; group != nil && session.route == nil {
+		session.route = group.Master()
+		defer func() {
+			session.route = nil
+		}()
+	}
+	return session.queryRows(sqlStr, args...)
+}
+
 func (session *Session) queryRow(sqlStr string, args ...interface{}) *core.Row {
 	return core.NewRow(session.queryRows(sqlStr, args...))
 }
@@ -145,13 +213,29 @@ func (session *Session) queryBytes(sqlStr string, args ...interface{}) ([]map[st
 	}
 	defer rows.Close()
 
-	return rows2maps(rows)
+	resultsSlice, err := rows2maps(rows)
+	if err != nil {
+		return nil, session.engine.translateError(err)
+	}
+	return resultsSlice, nil
 }
 
-func (session *Session) exec(sqlStr string, args ...interface{}) (sql.Result, error) {
+func (session *Session) exec(sqlStr string, args ...interface{}) (_ sql.Result, err error) {
 	defer session.resetStatement()
 
 	session.queryPreprocess(&sqlStr, args...)
+	// all the statements executed are treated as writes, except the reads
+	// sent to the slave chosen by UseSlave explicitly
+	var kind = WriteSQL
+	if group := session.engine.engineGroup; group != nil && session.route != nil && session.route != group.Master() {
+		kind = sqlKind(sqlStr)
+	}
+	defer session.markWrittenIfSucceeded(kind, &err)
+
+	db, sqlTag, err := session.routeDB(sqlStr, args, kind)
+	if err != nil {
+		return nil, err
+	}
 
 	if session.engine.showSQL {
 		if session.engine.showExecTime {
@@ -159,38 +243,46 @@ func (session *Session) exec(sqlStr string, args ...interface{}) (sql.Result, er
 			defer func() {
 				execDuration := time.Since(b4ExecTime)
 				if len(args) > 0 {
-					session.engine.logger.Infof("[SQL] %s %#v - took: %v", sqlStr, args, execDuration)
+					session.engine.logger.Infof("%s %s %#v - took: %v", sqlTag, sqlStr, args, execDuration)
 				} else {
-					session.engine.logger.Infof("[SQL] %s - took: %v", sqlStr, execDuration)
+					session.engine.logger.Infof("%s %s - took: %v", sqlTag, sqlStr, execDuration)
 				}
 			}()
 		} else {
 			if len(args) > 0 {
-				session.engine.logger.Infof("[SQL] %v %#v", sqlStr, args)
+				session.engine.logger.Infof("%s %v %#v", sqlTag, sqlStr, args)
 			} else {
-				session.engine.logger.Infof("[SQL] %v", sqlStr)
+				session.engine.logger.Infof("%s %v", sqlTag, sqlStr)
 			}
 		}
 	}
 
 	if !session.isAutoCommit {
-		return session.tx.Exec(sqlStr, args...)
+		res, err := session.tx.ExecContext(session.ctx, sqlStr, args...)
+		if err != nil {
+			return nil, session.engine.translateError(err)
+		}
+		return res, nil
 	}
 
 	if session.prepareStmt {
-		stmt, err := session.doPrepare(session.DB(), sqlStr)
+		stmt, err := session.doPrepare(db, sqlStr)
 		if err != nil {
 			return nil, err
 		}
 
-		res, err := stmt.Exec(args...)
+		res, err := stmt.ExecContext(session.ctx, args...)
 		if err != nil {
-			return nil, err
+			return nil, session.engine.translateError(err)
 		}
 		return res, nil
 	}
 
-	return session.DB().Exec(sqlStr, args...)
+	res, err := db.ExecContext(session.ctx, sqlStr, args...)
+	if err != nil {
+		return nil, session.engine.translateError(err)
+	}
+	return res, nil
 }
 
 // Exec raw sql
@@ -201,3 +293,17 @@ func (session *Session) Exec(sqlStr string, args ...interface{}) (sql.Result, er
 
 	return session.exec(sqlStr, args...)
 }
+
+// Notify sends the notification with the payload to the channel by pg_notify on
+// the master, it's delivered when the transaction of the session is committed
+func (session *Session) Notify(channel, payload string) error {
+	if session.isAutoClose {
+		defer session.Close()
+	}
+
+	if session.engine.dialect.DBType() != core.POSTGRES {
+		return ErrNotifyNotSupported
+	}
+	_, err := session.exec("SELECT pg_notify(?, ?)", channel, payload)
+	return err
+}
@@ -0,0 +1,529 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-xorm/builder"
+	"github.com/go-xorm/core"
+)
+
+type relationKind int
+
+const (
+	hasManyRelation relationKind = iota + 1
+	manyToManyRelation
+)
+
+// relation describes a slice field tagged by has_many or many_to_many
+type relation struct {
+	kind      relationKind
+	fieldName string
+	elemType  reflect.Type // the struct type of the children
+	isPtrElem bool
+
+	// the column of the children referencing the primary key for has_many, or
+	// the column of the join table referencing the primary key for many_to_many
+	foreignKey string
+	// the join table and its column referencing the children for many_to_many
+	joinTable string
+	otherKey  string
+}
+
+func (engine *Engine) setRelations(t reflect.Type, relations []*relation) {
+	engine.relationMutex.Lock()
+	defer engine.relationMutex.Unlock()
+	if len(relations) == 0 {
+		delete(engine.relations, t)
+		return
+	}
+	if engine.relations == nil {
+		engine.relations = make(map[reflect.Type][]*relation)
+	}
+	engine.relations[t] = relations
+}
+
+// tableRelations returns the relations of the table
+func (engine *Engine) tableRelations(table *core.Table) []*relation {
+	engine.relationMutex.RLock()
+	defer engine.relationMutex.RUnlock()
+	return engine.relations[table.Type]
+}
+
+// CascadeRelations makes Insert and Delete cascade through the has_many and
+// many_to_many relations of the beans. Insert inserts the children whose primary
+// keys are zero and the rows of the join tables, Delete deletes the children of
+// has_many and the rows of the join tables of many_to_many. If the records are
+// soft deleted, only the children with a deleted column are soft deleted and the
+// others are kept until the records are deleted by Unscoped. The records and their
+// relations are written in a transaction if the session is not in one.
+func (session *Session) CascadeRelations(trueOrFalse ...bool) *Session {
+	if len(trueOrFalse) >= 1 {
+		session.statement.cascadeRels = trueOrFalse[0]
+	} else {
+		session.statement.cascadeRels = true
+	}
+	return session
+}
+
+// relationKey returns the key of a value of the primary key or the foreign key,
+// the values of the different types are compared by the keys
+func relationKey(v interface{}) string {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
+
+// pkValueOf returns the value of the single primary key of the bean
+func pkValueOf(table *core.Table, bean reflect.Value) (interface{}, error) {
+	if len(table.PrimaryKeys) != 1 {
+		return nil, errors.New("unsupported non or composited primary key relation")
+	}
+	pkValue, err := table.PKColumns()[0].ValueOfV(&bean)
+	if err != nil {
+		return nil, err
+	}
+	return pkValue.Interface(), nil
+}
+
+// chunks splits the values by the chunk size of preloading
+func (session *Session) chunks(values []interface{}) [][]interface{} {
+	var size = session.preloadChunkSize()
+	var res = make([][]interface{}, 0, (len(values)+size-1)/size)
+	for start := 0; start < len(values); start += size {
+		end := start + size
+		if end > len(values) {
+			end = len(values)
+		}
+		res = append(res, values[start:end])
+	}
+	return res
+}
+
+// preloadRelations loads the children of the relations of the beans
+func (session *Session) preloadRelations(beans []reflect.Value, fields map[string]bool) error {
+	if len(beans) == 0 {
+		return nil
+	}
+	table, err := session.engine.autoMapType(beans[0].Elem())
+	if err != nil {
+		return err
+	}
+
+	for _, rel := range session.engine.tableRelations(table) {
+		if fields != nil && !fields[rel.fieldName] {
+			continue
+		}
+
+		var pks = make([]interface{}, 0, len(beans))
+		var seen = make(map[string]bool, len(beans))
+		for _, bean := range beans {
+			pk, err := pkValueOf(table, bean.Elem())
+			if err != nil {
+				return err
+			}
+			if key := relationKey(pk); !isPKZero(core.PK{pk}) && !seen[key] {
+				seen[key] = true
+				pks = append(pks, pk)
+			}
+		}
+
+		var children map[string][]reflect.Value
+		if rel.kind == hasManyRelation {
+			children, err = session.loadHasMany(rel, pks)
+		} else {
+			children, err = session.loadManyToMany(rel, pks)
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, bean := range beans {
+			elem := bean.Elem()
+			pk, err := pkValueOf(table, elem)
+			if err != nil {
+				return err
+			}
+			field := elem.FieldByName(rel.fieldName)
+			records := children[relationKey(pk)]
+			slice := reflect.MakeSlice(field.Type(), 0, len(records))
+			for _, record := range records {
+				if rel.isPtrElem {
+					slice = reflect.Append(slice, record)
+				} else {
+					slice = reflect.Append(slice, record.Elem())
+				}
+			}
+			field.Set(slice)
+		}
+	}
+	return nil
+}
+
+// loadRecords loads the records of the type whose column is in the values, the
+// records are pointers to the structs
+func (session *Session) loadRecords(t reflect.Type, colName string, values []interface{}) ([]reflect.Value, error) {
+	var records []reflect.Value
+	for _, chunk := range session.chunks(values) {
+		slice := reflect.New(reflect.SliceOf(reflect.PtrTo(t)))
+		table, err := session.engine.autoMapType(reflect.New(t).Elem())
+		if err != nil {
+			return nil, err
+		}
+		err = session.Table(reflect.New(t).Interface()).NoCascade().
+			In(session.engine.Quote(colName), chunk...).
+			Asc(table.PrimaryKeys...).find(slice.Interface())
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < slice.Elem().Len(); i++ {
+			records = append(records, slice.Elem().Index(i))
+		}
+	}
+	return records, nil
+}
+
+// loadHasMany loads the children of has_many grouped by the keys of the parents
+func (session *Session) loadHasMany(rel *relation, pks []interface{}) (map[string][]reflect.Value, error) {
+	var children = make(map[string][]reflect.Value)
+	if len(pks) == 0 {
+		return children, nil
+	}
+
+	childTable, err := session.engine.autoMapType(reflect.New(rel.elemType).Elem())
+	if err != nil {
+		return nil, err
+	}
+	fkCol := childTable.GetColumn(rel.foreignKey)
+	if fkCol == nil {
+		return nil, fmt.Errorf("column %s of relation %s is not found in table %s", rel.foreignKey, rel.fieldName, childTable.Name)
+	}
+
+	records, err := session.loadRecords(rel.elemType, rel.foreignKey, pks)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		elem := record.Elem()
+		fkValue, err := fkCol.ValueOfV(&elem)
+		if err != nil {
+			return nil, err
+		}
+		key := relationKey(fkValue.Interface())
+		children[key] = append(children[key], record)
+	}
+	return children, nil
+}
+
+// loadManyToMany loads the children of many_to_many through the join table
+// grouped by the keys of the parents
+func (session *Session) loadManyToMany(rel *relation, pks []interface{}) (map[string][]reflect.Value, error) {
+	var children = make(map[string][]reflect.Value)
+	if len(pks) == 0 {
+		return children, nil
+	}
+
+	childTable, err := session.engine.autoMapType(reflect.New(rel.elemType).Elem())
+	if err != nil {
+		return nil, err
+	}
+	if len(childTable.PrimaryKeys) != 1 {
+		return nil, errors.New("unsupported non or composited primary key relation")
+	}
+
+	// the keys of the children of every parent in the order of the join table
+	var links = make(map[string][]string)
+	var childPKs []interface{}
+	var seen = make(map[string]bool)
+	var joinTable = session.engine.Quote(session.statement.tbNameWithSchema(rel.joinTable))
+	for _, chunk := range session.chunks(pks) {
+		sqlStr := fmt.Sprintf("SELECT %s, %s FROM %s WHERE %s IN (%s)",
+			session.engine.Quote(rel.foreignKey), session.engine.Quote(rel.otherKey), joinTable,
+			session.engine.Quote(rel.foreignKey), strings.TrimSuffix(strings.Repeat("?,", len(chunk)), ","))
+		rows, err := session.queryRows(sqlStr, chunk...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var parent, child interface{}
+			if err = rows.Scan(&parent, &child); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			parentKey, childKey := relationKey(parent), relationKey(child)
+			links[parentKey] = append(links[parentKey], childKey)
+			if !seen[childKey] {
+				seen[childKey] = true
+				childPKs = append(childPKs, child)
+			}
+		}
+		rows.Close()
+	}
+	if len(childPKs) == 0 {
+		return children, nil
+	}
+
+	records, err := session.loadRecords(rel.elemType, childTable.PrimaryKeys[0], childPKs)
+	if err != nil {
+		return nil, err
+	}
+	var recordMap = make(map[string]reflect.Value, len(records))
+	for _, record := range records {
+		pk, err := pkValueOf(childTable, record.Elem())
+		if err != nil {
+			return nil, err
+		}
+		recordMap[relationKey(pk)] = record
+	}
+	for parentKey, childKeys := range links {
+		for _, childKey := range childKeys {
+			if record, ok := recordMap[childKey]; ok {
+				children[parentKey] = append(children[parentKey], record)
+			}
+		}
+	}
+	return children, nil
+}
+
+// insertRelations inserts the children and the rows of the join tables of the
+// relations of the inserted bean, which could be a struct or a slice of structs
+func (session *Session) insertRelations(bean interface{}) error {
+	var beanValue = reflect.Indirect(reflect.ValueOf(bean))
+	if beanValue.Kind() == reflect.Slice {
+		for i := 0; i < beanValue.Len(); i++ {
+			if err := session.insertBeanRelations(reflect.Indirect(beanValue.Index(i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return session.insertBeanRelations(beanValue)
+}
+
+func (session *Session) insertBeanRelations(bean reflect.Value) error {
+	if bean.Kind() != reflect.Struct {
+		return nil
+	}
+	table, err := session.engine.autoMapType(bean)
+	if err != nil {
+		return err
+	}
+	var relations = session.engine.tableRelations(table)
+	if len(relations) == 0 {
+		return nil
+	}
+	pk, err := pkValueOf(table, bean)
+	if err != nil {
+		return err
+	}
+
+	for _, rel := range relations {
+		field := bean.FieldByName(rel.fieldName)
+		if field.Len() == 0 {
+			continue
+		}
+		childTable, err := session.engine.autoMapType(reflect.New(rel.elemType).Elem())
+		if err != nil {
+			return err
+		}
+
+		// the new children are inserted by one InsertMulti
+		var newChildren = reflect.MakeSlice(reflect.SliceOf(reflect.PtrTo(rel.elemType)), 0, field.Len())
+		for i := 0; i < field.Len(); i++ {
+			child := reflect.Indirect(field.Index(i))
+			if !child.IsValid() {
+				continue
+			}
+			if rel.kind == hasManyRelation {
+				fkCol := childTable.GetColumn(rel.foreignKey)
+				if fkCol == nil {
+					return fmt.Errorf("column %s of relation %s is not found in table %s", rel.foreignKey, rel.fieldName, childTable.Name)
+				}
+				fkValue, err := fkCol.ValueOfV(&child)
+				if err != nil {
+					return err
+				}
+				if err = convertAssign(fkValue.Addr().Interface(), pk); err != nil {
+					return err
+				}
+			}
+			childPK, err := pkValueOf(childTable, child)
+			if err != nil {
+				return err
+			}
+			if isPKZero(core.PK{childPK}) {
+				newChildren = reflect.Append(newChildren, child.Addr())
+			}
+		}
+		if newChildren.Len() > 0 {
+			ptr := reflect.New(newChildren.Type())
+			ptr.Elem().Set(newChildren)
+			if _, err = session.insertBean(ptr.Interface()); err != nil {
+				return err
+			}
+		}
+
+		if rel.kind == manyToManyRelation {
+			if err = session.insertJoinRows(rel, childTable, pk, field); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// insertJoinRows inserts the rows of the join table linking the bean to the children
+func (session *Session) insertJoinRows(rel *relation, childTable *core.Table, pk interface{}, children reflect.Value) error {
+	var args = make([]interface{}, 0, children.Len())
+	for i := 0; i < children.Len(); i++ {
+		child := reflect.Indirect(children.Index(i))
+		if !child.IsValid() {
+			continue
+		}
+		childPK, err := pkValueOf(childTable, child)
+		if err != nil {
+			return err
+		}
+		args = append(args, childPK)
+	}
+
+	var prefix = fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES ",
+		session.engine.Quote(session.statement.tbNameWithSchema(rel.joinTable)),
+		session.engine.Quote(rel.foreignKey), session.engine.Quote(rel.otherKey))
+	for _, chunk := range session.chunks(args) {
+		var values = make([]string, 0, len(chunk))
+		var chunkArgs = make([]interface{}, 0, len(chunk)*2)
+		for _, childPK := range chunk {
+			values = append(values, "(?, ?)")
+			chunkArgs = append(chunkArgs, pk, childPK)
+		}
+		if !session.engine.SupportInsertMany() {
+			for i := range values {
+				if _, err := session.exec(prefix+values[i], chunkArgs[i*2:i*2+2]...); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if _, err := session.exec(prefix+strings.Join(values, ", "), chunkArgs...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relationDeletion is a table of a relation whose rows are deleted with the records
+type relationDeletion struct {
+	rel           *relation
+	table         string
+	deletedColumn *core.Column // the rows are soft deleted if it's not nil
+}
+
+// deleteRelations deletes the children of has_many and the rows of the join
+// tables of many_to_many of the records to be deleted, the records are selected
+// by the conditions of the delete. The children with a deleted column are soft
+// deleted unless the delete is unscoped. If the records are soft deleted, only
+// the children with a deleted column are soft deleted, the others and the rows
+// of the join tables are kept so that the records could be restored.
+func (session *Session) deleteRelations(table *core.Table, tableName, condSQL, orderSQL string, args []interface{}, unscoped bool) error {
+	var relations = session.engine.tableRelations(table)
+	if len(relations) == 0 {
+		return nil
+	}
+	if len(table.PrimaryKeys) != 1 {
+		return errors.New("unsupported non or composited primary key relation")
+	}
+
+	var softDelete = !unscoped && table.DeletedColumn() != nil
+	var deletions = make([]relationDeletion, 0, len(relations))
+	for _, rel := range relations {
+		if rel.kind != hasManyRelation {
+			if !softDelete {
+				deletions = append(deletions, relationDeletion{rel: rel, table: rel.joinTable})
+			}
+			continue
+		}
+
+		childBean := reflect.New(rel.elemType).Interface()
+		childTable, err := session.engine.autoMapType(reflect.ValueOf(childBean).Elem())
+		if err != nil {
+			return err
+		}
+		var deletedColumn *core.Column
+		if !unscoped {
+			deletedColumn = childTable.DeletedColumn()
+		}
+		if softDelete && deletedColumn == nil {
+			continue
+		}
+		if err = session.engine.ClearCache(childBean); err != nil {
+			return err
+		}
+		deletions = append(deletions, relationDeletion{rel: rel, table: childTable.Name, deletedColumn: deletedColumn})
+	}
+	if len(deletions) == 0 {
+		return nil
+	}
+
+	selectSQL := fmt.Sprintf("SELECT %s FROM %s", session.engine.Quote(table.PrimaryKeys[0]), tableName)
+	if len(condSQL) > 0 {
+		selectSQL += " WHERE " + condSQL
+	}
+	selectSQL += orderSQL
+
+	rows, err := session.queryMasterRows(selectSQL, args...)
+	if err != nil {
+		return err
+	}
+	var pks []interface{}
+	for rows.Next() {
+		var pk interface{}
+		if err = rows.Scan(&pk); err != nil {
+			rows.Close()
+			return err
+		}
+		pks = append(pks, pk)
+	}
+	rows.Close()
+	if len(pks) == 0 {
+		return nil
+	}
+
+	for _, deletion := range deletions {
+		var deletedColumn = deletion.deletedColumn
+		var quotedTable = session.engine.Quote(session.statement.tbNameWithSchema(deletion.table))
+		for _, chunk := range session.chunks(pks) {
+			var cond = builder.In(session.engine.Quote(deletion.rel.foreignKey), chunk...)
+			if deletedColumn != nil {
+				// the children deleted before keep their deleted time
+				cond = cond.And(session.engine.CondDeleted(session.engine.Quote(deletedColumn.Name)))
+			}
+			condSQL, condArgs, err := builder.ToSQL(cond)
+			if err != nil {
+				return err
+			}
+
+			var sqlStr string
+			var sqlArgs = condArgs
+			if deletedColumn != nil {
+				val, _ := session.engine.nowTime(deletedColumn)
+				sqlStr = fmt.Sprintf("UPDATE %s SET %s = ? WHERE %s", quotedTable,
+					session.engine.Quote(deletedColumn.Name), condSQL)
+				sqlArgs = append([]interface{}{val}, condArgs...)
+			} else {
+				sqlStr = fmt.Sprintf("DELETE FROM %s WHERE %s", quotedTable, condSQL)
+			}
+			if _, err := session.exec(sqlStr, sqlArgs...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type RelationPost struct {
+	Id      int64
+	UserId  int64
+	Title   string
+	Deleted time.Time `xorm:"deleted"`
+}
+
+type RelationRole struct {
+	Id   int64
+	Name string
+}
+
+type RelationUserRole struct {
+	UserId int64 `xorm:"pk"`
+	RoleId int64 `xorm:"pk"`
+}
+
+type RelationUser struct {
+	Id    int64
+	Name  string
+	Posts []RelationPost  `xorm:"has_many(user_id)"`
+	Roles []*RelationRole `xorm:"many_to_many(relation_user_role,user_id,role_id)"`
+}
+
+func TestRelationTags(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+
+	session := testEngine.NewSession()
+	defer session.Close()
+
+	table := testEngine.TableInfo(new(RelationUser))
+	assert.Nil(t, table.GetColumn("posts"))
+	assert.Nil(t, table.GetColumn("roles"))
+
+	relations := session.engine.tableRelations(table.Table)
+	assert.EqualValues(t, 2, len(relations))
+	assert.EqualValues(t, hasManyRelation, relations[0].kind)
+	assert.EqualValues(t, "user_id", relations[0].foreignKey)
+	assert.False(t, relations[0].isPtrElem)
+	assert.EqualValues(t, manyToManyRelation, relations[1].kind)
+	assert.EqualValues(t, "relation_user_role", relations[1].joinTable)
+	assert.EqualValues(t, "user_id", relations[1].foreignKey)
+	assert.EqualValues(t, "role_id", relations[1].otherKey)
+	assert.True(t, relations[1].isPtrElem)
+
+	type RelationBadTag struct {
+		Id    int64
+		Posts []string `xorm:"has_many(user_id)"`
+	}
+	_, err := session.engine.autoMapType(rValue(new(RelationBadTag)))
+	assert.Error(t, err)
+}
+
+func TestRelationPreload(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+	assertSync(t, new(RelationUser), new(RelationPost), new(RelationRole), new(RelationUserRole))
+
+	var users = []RelationUser{
+		{
+			Name:  "a",
+			Posts: []RelationPost{{Title: "a1"}, {Title: "a2"}},
+			Roles: []*RelationRole{{Name: "admin"}, {Name: "editor"}},
+		},
+		{
+			Name:  "b",
+			Posts: []RelationPost{{Title: "b1"}},
+		},
+		{Name: "c"},
+	}
+	for i := range users {
+		_, err := testEngine.CascadeRelations().Insert(&users[i])
+		assert.NoError(t, err)
+	}
+	// an existing role is only linked
+	users[1].Roles = []*RelationRole{users[0].Roles[1]}
+	_, err := testEngine.CascadeRelations().Insert(&RelationUser{
+		Name:  "d",
+		Roles: users[1].Roles,
+	})
+	assert.NoError(t, err)
+
+	cnt, err := testEngine.Count(new(RelationRole))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, cnt)
+	cnt, err = testEngine.Count(new(RelationUserRole))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, cnt)
+
+	var result []RelationUser
+	assert.NoError(t, testEngine.Preload().Asc("id").Find(&result))
+	assert.EqualValues(t, 4, len(result))
+	assert.EqualValues(t, 2, len(result[0].Posts))
+	assert.EqualValues(t, "a1", result[0].Posts[0].Title)
+	assert.EqualValues(t, "a2", result[0].Posts[1].Title)
+	assert.EqualValues(t, 2, len(result[0].Roles))
+	assert.EqualValues(t, "admin", result[0].Roles[0].Name)
+	assert.EqualValues(t, "editor", result[0].Roles[1].Name)
+	assert.EqualValues(t, 1, len(result[1].Posts))
+	assert.EqualValues(t, 0, len(result[1].Roles))
+	assert.EqualValues(t, 0, len(result[2].Posts))
+	assert.EqualValues(t, 1, len(result[3].Roles))
+	assert.EqualValues(t, "editor", result[3].Roles[0].Name)
+
+	result = nil
+	assert.NoError(t, testEngine.Preload("Roles").Asc("id").Find(&result))
+	assert.EqualValues(t, 0, len(result[0].Posts))
+	assert.EqualValues(t, 2, len(result[0].Roles))
+
+	var user RelationUser
+	has, err := testEngine.Preload().ID(users[0].Id).Get(&user)
+	assert.NoError(t, err)
+	assert.True(t, has)
+	assert.EqualValues(t, 2, len(user.Posts))
+	assert.EqualValues(t, 2, len(user.Roles))
+
+	// the post deleted before keeps its deleted time
+	var deleted = time.Date(2017, 1, 1, 0, 0, 0, 0, time.Local)
+	_, err = testEngine.Table(new(RelationPost)).ID(users[0].Posts[0].Id).
+		Update(map[string]interface{}{"deleted": deleted})
+	assert.NoError(t, err)
+
+	// the posts are soft deleted and the links of the roles are deleted
+	_, err = testEngine.CascadeRelations().ID(users[0].Id).Delete(new(RelationUser))
+	assert.NoError(t, err)
+	var post RelationPost
+	has, err = testEngine.Unscoped().ID(users[0].Posts[0].Id).Get(&post)
+	assert.NoError(t, err)
+	assert.True(t, has)
+	assert.EqualValues(t, deleted.Unix(), post.Deleted.Unix())
+	cnt, err = testEngine.Count(new(RelationPost))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+	cnt, err = testEngine.Unscoped().Count(new(RelationPost))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, cnt)
+	cnt, err = testEngine.Count(new(RelationUserRole))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+	cnt, err = testEngine.Count(new(RelationRole))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, cnt)
+
+	_, err = testEngine.CascadeRelations().Unscoped().ID(users[1].Id).Delete(new(RelationUser))
+	assert.NoError(t, err)
+	cnt, err = testEngine.Unscoped().Count(new(RelationPost))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, cnt)
+}
+
+type RelationComment struct {
+	Id     int64
+	UserId int64
+	Body   string
+}
+
+type RelationSoftUser struct {
+	Id       int64
+	Name     string
+	Deleted  time.Time         `xorm:"deleted"`
+	Posts    []RelationPost    `xorm:"has_many(user_id)"`
+	Comments []RelationComment `xorm:"has_many(user_id)"`
+	Roles    []*RelationRole   `xorm:"many_to_many(relation_user_role,user_id,role_id)"`
+}
+
+func TestRelationSoftDelete(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+	assertSync(t, new(RelationSoftUser), new(RelationPost), new(RelationComment), new(RelationRole), new(RelationUserRole))
+
+	var user = RelationSoftUser{
+		Name:     "a",
+		Posts:    []RelationPost{{Title: "a1"}},
+		Comments: []RelationComment{{Body: "a2"}},
+		Roles:    []*RelationRole{{Name: "admin"}},
+	}
+	_, err := testEngine.CascadeRelations().Insert(&user)
+	assert.NoError(t, err)
+
+	// only the children with a deleted column are soft deleted with the user
+	_, err = testEngine.CascadeRelations().ID(user.Id).Delete(new(RelationSoftUser))
+	assert.NoError(t, err)
+	cnt, err := testEngine.Count(new(RelationPost))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, cnt)
+	cnt, err = testEngine.Unscoped().Count(new(RelationPost))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+	cnt, err = testEngine.Count(new(RelationComment))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+	cnt, err = testEngine.Count(new(RelationUserRole))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+
+	// all the children and the links are deleted with the unscoped delete
+	_, err = testEngine.CascadeRelations().Unscoped().ID(user.Id).Delete(new(RelationSoftUser))
+	assert.NoError(t, err)
+	cnt, err = testEngine.Unscoped().Count(new(RelationPost))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, cnt)
+	cnt, err = testEngine.Count(new(RelationComment))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, cnt)
+	cnt, err = testEngine.Count(new(RelationUserRole))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, cnt)
+}
@@ -0,0 +1,300 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-xorm/core"
+)
+
+const (
+	returningReselect = iota
+	returningClause
+	returningOutput
+)
+
+// errReselectUnknown is returned when the record to be selected again is not
+// known since the primary keys of the bean are empty
+var errReselectUnknown = errors.New("returning needs the primary keys of the bean or ID on this database")
+
+// Returning makes the following Insert, Update or Delete refresh the bean with the
+// values of the columns returned by the database, all the columns will be returned
+// if no column is given. RETURNING is used on postgres and sqlite 3.35+, OUTPUT
+// on mssql, and the records will be selected again by the primary keys on other
+// databases. Only the first returned record will be set to the bean of Update and Delete.
+func (session *Session) Returning(columns ...string) *Session {
+	session.statement.Returning(columns...)
+	return session
+}
+
+// returningMode returns how the database returns the affected records
+func (engine *Engine) returningMode() int {
+	switch engine.dialect.DBType() {
+	case core.POSTGRES:
+		return returningClause
+	case core.MSSQL:
+		return returningOutput
+	case core.SQLITE:
+		if dialect, ok := engine.dialect.(interface {
+			SupportReturning() bool
+		}); ok && dialect.SupportReturning() {
+			return returningClause
+		}
+	}
+	return returningReselect
+}
+
+// returningColumns returns the quoted columns to be returned, the prefix is
+// INSERTED. or DELETED. for the OUTPUT clause of mssql
+func (session *Session) returningColumns(table *core.Table, columns []string, prefix string) string {
+	if len(columns) == 0 {
+		for _, col := range table.Columns() {
+			if col.MapType != core.ONLYTODB {
+				columns = append(columns, col.Name)
+			}
+		}
+	}
+
+	var quoted = make([]string, len(columns))
+	for i, colName := range columns {
+		quoted[i] = prefix + session.engine.Quote(colName)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// genOutputSQL inserts the OUTPUT clause of mssql at the index of the sqlStr,
+// it should be placed before the VALUES or the WHERE
+func (session *Session) genOutputSQL(sqlStr string, idx int, table *core.Table, columns []string, prefix string) string {
+	if idx < 0 {
+		idx = len(sqlStr)
+	}
+	return sqlStr[:idx] + " OUTPUT " + session.returningColumns(table, columns, prefix) + sqlStr[idx:]
+}
+
+// genReturningSQL appends the RETURNING clause
+func (session *Session) genReturningSQL(sqlStr string, table *core.Table, columns []string) string {
+	return sqlStr + " RETURNING " + session.returningColumns(table, columns, "")
+}
+
+// returningKeys returns the inserted columns which match the records returned
+// by InsertMulti to the beans, they are the conflict columns of upsert or the
+// primary keys
+func (session *Session) returningKeys(table *core.Table, cols []*core.Column) ([]*core.Column, error) {
+	var names = table.PrimaryKeys
+	if conflict := session.statement.conflict; conflict != nil && len(conflict.columns) > 0 {
+		names = conflict.columns
+	}
+
+	var keys = make([]*core.Column, 0, len(names))
+	for _, name := range names {
+		var key *core.Column
+		for _, col := range cols {
+			if strings.EqualFold(col.Name, name) {
+				key = col
+				break
+			}
+		}
+		if key == nil {
+			return nil, errors.New("returning of upsert or of multiple records on mssql needs the primary keys or the conflict columns to be inserted")
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("returning of upsert or of multiple records on mssql needs the primary keys")
+	}
+	return keys, nil
+}
+
+// returningKeyString returns the string of the values of the keys to match a
+// returned record
+func returningKeyString(values []interface{}) string {
+	var strs = make([]string, len(values))
+	for i, v := range values {
+		if bs, ok := v.([]byte); ok {
+			v = string(bs)
+		}
+		strs[i] = fmt.Sprint(v)
+	}
+	return strings.Join(strs, "\x00")
+}
+
+// scanReturningByKeys refreshes the beans by the returned records which are matched
+// by the values of the keys, since the records ignored by upsert are not returned
+// and mssql doesn't keep the order of the records of OUTPUT
+func (session *Session) scanReturningByKeys(rows *core.Rows, table *core.Table, beans []interface{}, keys []*core.Column) (int64, error) {
+	defer rows.Close()
+
+	fields, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	var keyIdxes = make([]int, len(keys))
+	for i, key := range keys {
+		keyIdxes[i] = -1
+		for j, field := range fields {
+			if strings.EqualFold(field, key.Name) {
+				keyIdxes[i] = j
+				break
+			}
+		}
+		if keyIdxes[i] < 0 {
+			return 0, fmt.Errorf("the key %s is not returned", key.Name)
+		}
+	}
+
+	var beanIdxes = make(map[string]int, len(beans))
+	for i, bean := range beans {
+		var dataStruct = rValue(bean)
+		var values = make([]interface{}, len(keys))
+		for j, key := range keys {
+			fieldValue, err := key.ValueOfV(&dataStruct)
+			if err != nil {
+				return 0, err
+			}
+			if values[j], err = session.value2Interface(key, *fieldValue); err != nil {
+				return 0, err
+			}
+		}
+		beanIdxes[returningKeyString(values)] = i
+	}
+
+	afterClosures := session.afterClosures
+	session.afterClosures = nil
+	defer func() {
+		session.afterClosures = afterClosures
+	}()
+
+	var cnt int
+	for rows.Next() {
+		scanResults := make([]interface{}, len(fields))
+		for i := range scanResults {
+			var cell interface{}
+			scanResults[i] = &cell
+		}
+		if err = rows.Scan(scanResults...); err != nil {
+			return int64(cnt), err
+		}
+
+		var values = make([]interface{}, len(keys))
+		for i, idx := range keyIdxes {
+			values[i] = *scanResults[idx].(*interface{})
+		}
+		idx, ok := beanIdxes[returningKeyString(values)]
+		if !ok {
+			return int64(cnt), errors.New("the returned record doesn't match any inserted bean")
+		}
+
+		var bean = beans[idx]
+		for _, closure := range session.beforeClosures {
+			closure(bean)
+		}
+		beforeSetBean(bean, fields, scanResults)
+		dataStruct := rValue(bean)
+		if _, err = session.slice2Bean(scanResults, fields, bean, &dataStruct, table); err != nil {
+			return int64(cnt), err
+		}
+		cnt++
+	}
+	if err = rows.Err(); err != nil {
+		return int64(cnt), err
+	}
+	return int64(cnt), session.executeProcessors()
+}
+
+// scanReturning refreshes the beans in order by the returned records, the count
+// of the returned records will be returned
+func (session *Session) scanReturning(rows *core.Rows, table *core.Table, beans []interface{}) (int64, error) {
+	defer rows.Close()
+
+	fields, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	// the closures belong to the insert, update or delete but not the query
+	afterClosures := session.afterClosures
+	session.afterClosures = nil
+	defer func() {
+		session.afterClosures = afterClosures
+	}()
+
+	var cnt int
+	for rows.Next() {
+		if cnt < len(beans) {
+			scanResults, err := session.row2Slice(rows, fields, beans[cnt])
+			if err != nil {
+				return int64(cnt), err
+			}
+			dataStruct := rValue(beans[cnt])
+			if _, err = session.slice2Bean(scanResults, fields, beans[cnt], &dataStruct, table); err != nil {
+				return int64(cnt), err
+			}
+		}
+		cnt++
+	}
+	if err = rows.Err(); err != nil {
+		return int64(cnt), err
+	}
+	return int64(cnt), session.executeProcessors()
+}
+
+// reselect refreshes the bean by selecting the returning columns again, the
+// primary keys of the bean will be used if the pk is nil
+func (session *Session) reselect(table *core.Table, tableName string, columns []string, bean interface{}, pk core.PK) error {
+	if len(table.PrimaryKeys) == 0 {
+		return errors.New("returning needs primary keys on this database")
+	}
+
+	if pk == nil {
+		var err error
+		if pk, err = reselectPK(table, bean); err != nil {
+			return err
+		}
+	}
+
+	var conds = make([]string, len(table.PrimaryKeys))
+	for i, colName := range table.PrimaryKeys {
+		conds[i] = session.engine.Quote(colName) + " = ?"
+	}
+	sqlStr := fmt.Sprintf("SELECT %s FROM %s WHERE %s",
+		session.returningColumns(table, columns, ""),
+		session.engine.Quote(tableName),
+		strings.Join(conds, " AND "))
+
+	rows, err := session.queryMasterRows(sqlStr, pk...)
+	if err != nil {
+		return err
+	}
+	_, err = session.scanReturning(rows, table, []interface{}{bean})
+	return err
+}
+
+// reselectPK returns the primary keys of the bean to select the record again
+func reselectPK(table *core.Table, bean interface{}) (core.PK, error) {
+	var pk = make(core.PK, 0, len(table.PrimaryKeys))
+	for _, col := range table.PKColumns() {
+		fieldValue, err := col.ValueOf(bean)
+		if err != nil {
+			return nil, err
+		}
+		if isZero(fieldValue.Interface()) {
+			return nil, errReselectUnknown
+		}
+		pk = append(pk, fieldValue.Interface())
+	}
+	return pk, nil
+}
+
+// returningBean returns an error if the bean cannot be refreshed
+func returningBean(bean interface{}) error {
+	if v := reflect.ValueOf(bean); v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return errors.New("returning needs a pointer to struct")
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ReturningStruct struct {
+	Id      int64
+	Name    string
+	Score   int    `xorm:"default 10"`
+	Status  string `xorm:"default 'new'"`
+	Version int    `xorm:"version"`
+}
+
+func TestInsertReturning(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+	assertSync(t, new(ReturningStruct))
+
+	var record = ReturningStruct{Name: "a"}
+	cnt, err := testEngine.Omit("score", "status").Returning().Insert(&record)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+	assert.True(t, record.Id > 0)
+	assert.EqualValues(t, 10, record.Score)
+	assert.EqualValues(t, "new", record.Status)
+	assert.EqualValues(t, 1, record.Version)
+
+	_, err = testEngine.Returning().Insert(ReturningStruct{Name: "b"})
+	assert.Error(t, err)
+
+	var records = []ReturningStruct{{Name: "c"}, {Name: "d"}}
+	cnt, err = testEngine.Omit("score", "status").Returning().Insert(&records)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, cnt)
+	for _, record := range records {
+		assert.True(t, record.Id > 0)
+		assert.EqualValues(t, 10, record.Score)
+		assert.EqualValues(t, "new", record.Status)
+	}
+}
+
+func TestUpdateReturning(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+	assertSync(t, new(ReturningStruct))
+
+	var record = ReturningStruct{Name: "a", Score: 1, Status: "new"}
+	_, err := testEngine.Insert(&record)
+	assert.NoError(t, err)
+
+	var updated = ReturningStruct{Version: 1}
+	cnt, err := testEngine.ID(record.Id).Incr("score", 2).Returning("id", "score", "status").Update(&updated)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+	assert.EqualValues(t, record.Id, updated.Id)
+	assert.EqualValues(t, 3, updated.Score)
+	assert.EqualValues(t, "new", updated.Status)
+	assert.EqualValues(t, 2, updated.Version)
+
+	var engine *Engine
+	switch e := testEngine.(type) {
+	case *Engine:
+		engine = e
+	case *EngineGroup:
+		engine = e.Master()
+	}
+	if engine.returningMode() == returningReselect {
+		// the record could not be selected again without the primary keys
+		updated = ReturningStruct{Score: 4, Version: 2}
+		_, err = testEngine.Where("name = ?", "a").Returning().Update(&updated)
+		assert.Error(t, err)
+
+		var stored ReturningStruct
+		has, err := testEngine.ID(record.Id).Get(&stored)
+		assert.NoError(t, err)
+		assert.True(t, has)
+		assert.EqualValues(t, 3, stored.Score)
+	}
+}
+
+func TestDeleteReturning(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+	assertSync(t, new(ReturningStruct))
+
+	var record = ReturningStruct{Name: "a", Score: 5, Status: "old"}
+	_, err := testEngine.Insert(&record)
+	assert.NoError(t, err)
+
+	var deleted = ReturningStruct{Name: "a"}
+	cnt, err := testEngine.Returning().Delete(&deleted)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+	assert.EqualValues(t, record.Id, deleted.Id)
+	assert.EqualValues(t, 5, deleted.Score)
+	assert.EqualValues(t, "old", deleted.Status)
+
+	cnt, err = testEngine.Count(new(ReturningStruct))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, cnt)
+}
+
+func TestInsertMultiUpsertReturning(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+	assertSync(t, new(UpsertStruct))
+
+	var engine *Engine
+	switch e := testEngine.(type) {
+	case *Engine:
+		engine = e
+	case *EngineGroup:
+		engine = e.Master()
+	}
+	if engine.returningMode() == returningReselect {
+		return
+	}
+
+	_, err := testEngine.Insert(&UpsertStruct{Name: "a", Score: 1})
+	assert.NoError(t, err)
+
+	// the ignored record is not returned, the others should still be refreshed
+	var records = []*UpsertStruct{{Name: "a", Score: 2}, {Name: "b", Score: 3}}
+	cnt, err := testEngine.OnConflict("name").DoNothing().Returning("id", "score").Insert(&records)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+	assert.EqualValues(t, 0, records[0].Id)
+	assert.True(t, records[1].Id > 0)
+	assert.EqualValues(t, 3, records[1].Score)
+
+	var stored UpsertStruct
+	has, err := testEngine.ID(records[1].Id).Get(&stored)
+	assert.NoError(t, err)
+	assert.True(t, has)
+	assert.EqualValues(t, "b", stored.Name)
+}
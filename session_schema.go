@@ -5,6 +5,7 @@
 package xorm
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -20,8 +21,13 @@ func (session *Session) Ping() error {
 		defer session.Close()
 	}
 
+	return session.ping(session.ctx)
+}
+
+// ping pings the database of the session with the context
+func (session *Session) ping(ctx context.Context) error {
 	session.engine.logger.Infof("PING DATABASE %v", session.engine.DriverName())
-	return session.DB().Ping()
+	return session.DB().PingContext(ctx)
 }
 
 // CreateTable create a table according a bean
@@ -33,6 +39,33 @@ func (session *Session) CreateTable(bean interface{}) error {
 	return session.createTable(bean)
 }
 
+// CreateTables creates the tables according the beans in a transaction
+func (session *Session) CreateTables(beans ...interface{}) error {
+	if session.isAutoClose {
+		defer session.Close()
+	}
+
+	var ownTx bool
+	if session.isAutoCommit {
+		if err := session.Begin(); err != nil {
+			return err
+		}
+		ownTx = true
+		defer session.Rollback()
+	}
+
+	for _, bean := range beans {
+		if err := session.createTable(bean); err != nil {
+			return err
+		}
+	}
+
+	if ownTx {
+		return session.Commit()
+	}
+	return nil
+}
+
 func (session *Session) createTable(bean interface{}) error {
 	v := rValue(bean)
 	if err := session.statement.setRefValue(v); err != nil {
@@ -128,7 +161,7 @@ func (session *Session) DropTable(beanOrTableName interface{}) error {
 }
 
 func (session *Session) dropTable(beanOrTableName interface{}) error {
-	tableName, err := session.engine.tableName(beanOrTableName)
+	tableName, err := session.tableName(beanOrTableName)
 	if err != nil {
 		return err
 	}
@@ -157,7 +190,7 @@ func (session *Session) IsTableExist(beanOrTableName interface{}) (bool, error)
 		defer session.Close()
 	}
 
-	tableName, err := session.engine.tableName(beanOrTableName)
+	tableName, err := session.tableName(beanOrTableName)
 	if err != nil {
 		return false, err
 	}
@@ -165,6 +198,17 @@ func (session *Session) IsTableExist(beanOrTableName interface{}) (bool, error)
 	return session.isTableExist(tableName)
 }
 
+// tableName returns the name of the table qualified by the schema
+func (session *Session) tableName(beanOrTableName interface{}) (string, error) {
+	v := rValue(beanOrTableName)
+	if v.Type().Kind() == reflect.String {
+		return session.statement.tbNameWithSchema(beanOrTableName.(string)), nil
+	} else if v.Type().Kind() == reflect.Struct {
+		return session.statement.tbNameWithSchema(session.engine.tbName(v)), nil
+	}
+	return "", errors.New("bean should be a struct or struct's point")
+}
+
 func (session *Session) isTableExist(tableName string) (bool, error) {
 	sqlStr, args := session.engine.dialect.TableCheckSql(tableName)
 	results, err := session.queryBytes(sqlStr, args...)
@@ -190,7 +234,7 @@ func (session *Session) IsTableEmpty(bean interface{}) (bool, error) {
 
 func (session *Session) isTableEmpty(tableName string) (bool, error) {
 	var total int64
-	sqlStr := fmt.Sprintf("select count(*) from %s", session.engine.Quote(tableName))
+	sqlStr := fmt.Sprintf("select count(*) from %s", session.engine.Quote(session.statement.tbNameWithSchema(tableName)))
 	err := session.queryRow(sqlStr).Scan(&total)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -250,7 +294,7 @@ func (session *Session) Sync2(beans ...interface{}) error {
 		defer session.Close()
 	}
 
-	tables, err := engine.DBMetas()
+	tables, err := engine.dbMetas(session.statement.schema)
 	if err != nil {
 		return err
 	}
@@ -265,6 +309,7 @@ func (session *Session) Sync2(beans ...interface{}) error {
 		}
 		structTables = append(structTables, table)
 		var tbName = session.tbNameNoSchema(table)
+		var tbNameWithSchema = session.statement.tbNameWithSchema(tbName)
 
 		var oriTable *core.Table
 		for _, tb := range tables {
@@ -310,7 +355,7 @@ func (session *Session) Sync2(beans ...interface{}) error {
 								engine.dialect.DBType() == core.POSTGRES {
 								engine.logger.Infof("Table %s column %s change type from %s to %s\n",
 									tbName, col.Name, curType, expectedType)
-								_, err = session.exec(engine.dialect.ModifyColumnSql(table.Name, col))
+								_, err = session.exec(engine.dialect.ModifyColumnSql(tbNameWithSchema, col))
 							} else {
 								engine.logger.Warnf("Table %s column %s db type is %s, struct type is %s\n",
 									tbName, col.Name, curType, expectedType)
@@ -320,7 +365,7 @@ func (session *Session) Sync2(beans ...interface{}) error {
 								if oriCol.Length < col.Length {
 									engine.logger.Infof("Table %s column %s change type from varchar(%d) to varchar(%d)\n",
 										tbName, col.Name, oriCol.Length, col.Length)
-									_, err = session.exec(engine.dialect.ModifyColumnSql(table.Name, col))
+									_, err = session.exec(engine.dialect.ModifyColumnSql(tbNameWithSchema, col))
 								}
 							}
 						} else {
@@ -334,7 +379,7 @@ func (session *Session) Sync2(beans ...interface{}) error {
 							if oriCol.Length < col.Length {
 								engine.logger.Infof("Table %s column %s change type from varchar(%d) to varchar(%d)\n",
 									tbName, col.Name, oriCol.Length, col.Length)
-								_, err = session.exec(engine.dialect.ModifyColumnSql(table.Name, col))
+								_, err = session.exec(engine.dialect.ModifyColumnSql(tbNameWithSchema, col))
 							}
 						}
 					}
@@ -371,7 +416,7 @@ func (session *Session) Sync2(beans ...interface{}) error {
 
 				if oriIndex != nil {
 					if oriIndex.Type != index.Type {
-						sql := engine.dialect.DropIndexSql(tbName, oriIndex)
+						sql := engine.dialect.DropIndexSql(tbNameWithSchema, oriIndex)
 						_, err = session.exec(sql)
 						if err != nil {
 							return err
@@ -387,7 +432,7 @@ func (session *Session) Sync2(beans ...interface{}) error {
 
 			for name2, index2 := range oriTable.Indexes {
 				if _, ok := foundIndexNames[name2]; !ok {
-					sql := engine.dialect.DropIndexSql(tbName, index2)
+					sql := engine.dialect.DropIndexSql(tbNameWithSchema, index2)
 					_, err = session.exec(sql)
 					if err != nil {
 						return err
@@ -399,11 +444,11 @@ func (session *Session) Sync2(beans ...interface{}) error {
 				if index.Type == core.UniqueType {
 					session.statement.RefTable = table
 					session.statement.tableName = tbName
-					err = session.addUnique(tbName, name)
+					err = session.addUnique(tbNameWithSchema, name)
 				} else if index.Type == core.IndexType {
 					session.statement.RefTable = table
 					session.statement.tableName = tbName
-					err = session.addIndex(tbName, name)
+					err = session.addIndex(tbNameWithSchema, name)
 				}
 				if err != nil {
 					return err
@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-xorm/core"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -251,3 +252,55 @@ func TestUnique_1(t *testing.T) {
 	assert.NoError(t, testEngine.CreateTables(new(UserUnique)))
 	assert.NoError(t, testEngine.CreateUniques(new(UserUnique)))
 }
+
+type SchemaUser struct {
+	Id      int64
+	Name    string
+	GroupId int64
+}
+
+type SchemaGroup struct {
+	Id   int64
+	Name string
+}
+
+func TestSessionSchema(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+	assertSync(t, new(SchemaUser), new(SchemaGroup))
+
+	if testEngine.Dialect().DBType() != core.SQLITE {
+		t.Skip("the schema of the test database is only known on sqlite")
+	}
+
+	session := testEngine.NewSession()
+	defer session.Close()
+
+	// main is the schema of the opened database on sqlite
+	session.Schema("main")
+
+	group := SchemaGroup{Name: "g"}
+	_, err := session.Insert(&group)
+	assert.NoError(t, err)
+	sql, _ := session.LastSQL()
+	assert.Contains(t, sql, "`main`.`schema_group`")
+
+	_, err = session.Insert(&SchemaUser{Name: "u", GroupId: group.Id})
+	assert.NoError(t, err)
+
+	var users []SchemaUser
+	assert.NoError(t, session.Table(new(SchemaUser)).
+		Join("INNER", "schema_group", "schema_group.id = schema_user.group_id").
+		Where("schema_group.name = ?", "g").
+		Find(&users))
+	assert.EqualValues(t, 1, len(users))
+	sql, _ = session.LastSQL()
+	assert.Contains(t, sql, "FROM `main`.`schema_user`")
+	assert.Contains(t, sql, "JOIN `main`.`schema_group`")
+
+	// the schema is kept across the statements
+	cnt, err := session.Count(new(SchemaUser))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+	sql, _ = session.LastSQL()
+	assert.Contains(t, sql, "`main`.`schema_user`")
+}
@@ -7,7 +7,10 @@ package xorm
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"reflect"
+
+	"github.com/go-xorm/core"
 )
 
 // Count counts the records. bean's non-empty fields
@@ -96,3 +99,210 @@ func (session *Session) SumsInt(bean interface{}, columnNames ...string) ([]int6
 	var res = make([]int64, len(columnNames), len(columnNames))
 	return res, session.sum(&res, bean, columnNames...)
 }
+
+// aggregate is the aggregate function of a field of the result struct of
+// Aggregate, which is described by the tag agg(fn,arg)
+type aggregate struct {
+	fn     string
+	arg    string
+	column string
+}
+
+// the aggregate functions supported by the tag agg
+var aggFuncs = map[string]bool{
+	"sum":            true,
+	"count":          true,
+	"count_distinct": true,
+	"min":            true,
+	"max":            true,
+	"avg":            true,
+}
+
+// setAggregates sets the aggregates of the struct type
+func (engine *Engine) setAggregates(t reflect.Type, aggregates []*aggregate) {
+	engine.aggregateMutex.Lock()
+	defer engine.aggregateMutex.Unlock()
+	if len(aggregates) == 0 {
+		delete(engine.aggregates, t)
+		return
+	}
+	if engine.aggregates == nil {
+		engine.aggregates = make(map[reflect.Type][]*aggregate)
+	}
+	engine.aggregates[t] = aggregates
+}
+
+// tableAggregates returns the aggregates of the table
+func (engine *Engine) tableAggregates(table *core.Table) []*aggregate {
+	engine.aggregateMutex.RLock()
+	defer engine.aggregateMutex.RUnlock()
+	return engine.aggregates[table.Type]
+}
+
+// extremum finds the result of min or max of the column into res, the value is
+// converted like the field of the column so the time is in the timezone of the engine
+func (session *Session) extremum(fn string, bean interface{}, columnName string, res interface{}) (bool, error) {
+	if session.isAutoClose {
+		defer session.Close()
+	}
+
+	resValue := reflect.ValueOf(res)
+	if resValue.Kind() != reflect.Ptr {
+		return false, errors.New("need a pointer to a variable")
+	}
+
+	var beanValue = rValue(bean)
+	if beanValue.Kind() != reflect.Struct {
+		return false, errors.New("needs a struct pointer")
+	}
+	table, err := session.engine.autoMapType(beanValue)
+	if err != nil {
+		return false, err
+	}
+
+	var col = table.GetColumn(columnName)
+	var aggSelect = fmt.Sprintf("%s(%s)", fn, session.statement.quoteAggColumn(columnName))
+	if col != nil {
+		aggSelect += " AS " + session.engine.Quote(col.Name)
+	}
+	sqlStr, args, err := session.statement.genAggSQL(bean, aggSelect)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := session.queryRows(sqlStr, args...)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return false, rows.Err()
+	}
+	fields, err := rows.Columns()
+	if err != nil {
+		return false, err
+	}
+	var newValue = reflect.New(beanValue.Type())
+	scanResults, err := session.row2Slice(rows, fields, newValue.Interface())
+	if err != nil {
+		return false, err
+	}
+	var raw = *scanResults[0].(*interface{})
+	if raw == nil {
+		return false, nil
+	}
+	if col == nil {
+		// an expression is converted from the value of the driver
+		return true, convertAssign(res, raw)
+	}
+
+	// the processors of the bean are not executed since it only holds the result
+	var processors = session.afterProcessors
+	var dataStruct = newValue.Elem()
+	_, err = session.slice2Bean(scanResults, fields, newValue.Interface(), &dataStruct, table)
+	session.afterProcessors = processors
+	if err != nil {
+		return false, err
+	}
+
+	fieldValue, err := col.ValueOfV(&dataStruct)
+	if err != nil {
+		return false, err
+	}
+	if fieldValue.Type().AssignableTo(resValue.Elem().Type()) {
+		resValue.Elem().Set(*fieldValue)
+		return true, nil
+	}
+	return true, convertAssign(res, fieldValue.Interface())
+}
+
+// Min finds the minimum of the column into res, it returns false if there is no
+// value. bean's non-empty fields are conditions.
+func (session *Session) Min(bean interface{}, columnName string, res interface{}) (bool, error) {
+	return session.extremum("min", bean, columnName, res)
+}
+
+// Max finds the maximum of the column into res, it returns false if there is no
+// value. bean's non-empty fields are conditions.
+func (session *Session) Max(bean interface{}, columnName string, res interface{}) (bool, error) {
+	return session.extremum("max", bean, columnName, res)
+}
+
+// Avg call avg some column. bean's non-empty fields are conditions.
+func (session *Session) Avg(bean interface{}, columnName string) (float64, error) {
+	if session.isAutoClose {
+		defer session.Close()
+	}
+
+	sqlStr, args, err := session.statement.genAggSQL(bean,
+		fmt.Sprintf("COALESCE(avg(%s),0)", session.statement.quoteAggColumn(columnName)))
+	if err != nil {
+		return 0, err
+	}
+
+	var res float64
+	err = session.queryRow(sqlStr, args...).Scan(&res)
+	if err == sql.ErrNoRows || err == nil {
+		return res, nil
+	}
+	return 0, err
+}
+
+// CountDistinct counts the distinct values of the columns, the rows with NULL
+// are not counted. bean's non-empty fields are conditions.
+func (session *Session) CountDistinct(bean interface{}, columnNames ...string) (int64, error) {
+	if session.isAutoClose {
+		defer session.Close()
+	}
+	if len(columnNames) == 0 {
+		return 0, errors.New("need at least one column")
+	}
+
+	sqlStr, args, err := session.statement.genCountDistinctSQL(bean, columnNames...)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	err = session.queryRow(sqlStr, args...).Scan(&total)
+	if err == sql.ErrNoRows || err == nil {
+		return total, nil
+	}
+	return 0, err
+}
+
+// Aggregate finds the aggregates of the groups into the slice of the result
+// structs in one query. The fields tagged by agg(fn,column) are the aggregates,
+// fn is sum, count, count_distinct, min, max or avg. The other fields are
+// selected by their columns, which are usually the GroupBy columns. The table is
+// set by Table and its conditions such as the deleted column are used.
+func (session *Session) Aggregate(rowsSlicePtr interface{}) error {
+	if session.isAutoClose {
+		defer session.Close()
+	}
+
+	sliceValue := reflect.Indirect(reflect.ValueOf(rowsSlicePtr))
+	if sliceValue.Kind() != reflect.Slice {
+		return errors.New("needs a pointer to a slice")
+	}
+	elemType := sliceValue.Type().Elem()
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return errors.New("needs a slice of structs")
+	}
+
+	table, err := session.engine.autoMapType(reflect.New(elemType).Elem())
+	if err != nil {
+		return err
+	}
+	var aggSelect = session.statement.genAggregateColumnStr(table, session.engine.tableAggregates(table))
+	sqlStr, args, err := session.statement.genAggSQL(nil, aggSelect)
+	if err != nil {
+		return err
+	}
+
+	return session.noCacheFind(table, sliceValue, sqlStr, args...)
+}
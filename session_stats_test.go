@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/go-xorm/builder"
 	"github.com/stretchr/testify/assert"
@@ -158,3 +159,102 @@ func TestSQLCount(t *testing.T) {
 	assert.NoError(t, err)
 	assert.EqualValues(t, 0, total)
 }
+
+func TestAggregate(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+
+	type AggOrder struct {
+		Id      int64
+		Dept    string
+		UserId  int64
+		Amount  int
+		Created time.Time `xorm:"created"`
+		Deleted time.Time `xorm:"deleted"`
+	}
+
+	assertSync(t, new(AggOrder))
+
+	var orders = []AggOrder{
+		{Dept: "a", UserId: 1, Amount: 10},
+		{Dept: "a", UserId: 1, Amount: 20},
+		{Dept: "a", UserId: 2, Amount: 30},
+		{Dept: "b", UserId: 3, Amount: 40},
+		{Dept: "b", UserId: 3, Amount: 100},
+	}
+	for i := range orders {
+		_, err := testEngine.Insert(&orders[i])
+		assert.NoError(t, err)
+	}
+	_, err := testEngine.ID(orders[4].Id).Delete(new(AggOrder))
+	assert.NoError(t, err)
+
+	var minAmount int
+	has, err := testEngine.Min(new(AggOrder), "amount", &minAmount)
+	assert.NoError(t, err)
+	assert.True(t, has)
+	assert.EqualValues(t, 10, minAmount)
+
+	var maxAmount int64
+	has, err = testEngine.Max(&AggOrder{Dept: "a"}, "amount", &maxAmount)
+	assert.NoError(t, err)
+	assert.True(t, has)
+	assert.EqualValues(t, 30, maxAmount)
+
+	var maxCreated time.Time
+	has, err = testEngine.Max(new(AggOrder), "created", &maxCreated)
+	assert.NoError(t, err)
+	assert.True(t, has)
+	assert.EqualValues(t, orders[3].Created.Unix(), maxCreated.Unix())
+	assert.EqualValues(t, testEngine.GetTZLocation().String(), maxCreated.Location().String())
+
+	has, err = testEngine.Min(&AggOrder{Dept: "c"}, "amount", &minAmount)
+	assert.NoError(t, err)
+	assert.False(t, has)
+
+	avg, err := testEngine.Avg(new(AggOrder), "amount")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 25, avg)
+
+	cnt, err := testEngine.CountDistinct(new(AggOrder), "user_id")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, cnt)
+
+	cnt, err = testEngine.Where("amount > ?", 10).CountDistinct(new(AggOrder), "dept", "user_id")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, cnt)
+
+	type AggDeptStats struct {
+		Dept      string
+		Total     int       `xorm:"agg(sum,amount)"`
+		Orders    int64     `xorm:"agg(count,*)"`
+		Users     int64     `xorm:"agg(count_distinct,user_id)"`
+		Average   float64   `xorm:"agg(avg,amount)"`
+		FirstTime time.Time `xorm:"agg(min,created)"`
+	}
+
+	var stats []AggDeptStats
+	err = testEngine.Table(new(AggOrder)).GroupBy("dept").Asc("dept").Aggregate(&stats)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, len(stats))
+	assert.EqualValues(t, "a", stats[0].Dept)
+	assert.EqualValues(t, 60, stats[0].Total)
+	assert.EqualValues(t, 3, stats[0].Orders)
+	assert.EqualValues(t, 2, stats[0].Users)
+	assert.EqualValues(t, 20, stats[0].Average)
+	assert.EqualValues(t, orders[0].Created.Unix(), stats[0].FirstTime.Unix())
+	assert.EqualValues(t, "b", stats[1].Dept)
+	assert.EqualValues(t, 40, stats[1].Total)
+	assert.EqualValues(t, 1, stats[1].Orders)
+
+	var pstats []*AggDeptStats
+	err = testEngine.Table(new(AggOrder)).GroupBy("dept").Having("sum(amount) > 50").Aggregate(&pstats)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, len(pstats))
+	assert.EqualValues(t, "a", pstats[0].Dept)
+
+	type AggBadTag struct {
+		Total int `xorm:"agg(median,amount)"`
+	}
+	err = testEngine.Table(new(AggOrder)).Aggregate(&[]AggBadTag{})
+	assert.Error(t, err)
+}
@@ -4,26 +4,187 @@
 
 package xorm
 
-// Begin a transaction
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// savePointDialect is implemented by the dialects which support savepoints,
+// an empty release SQL means the dialect cannot release a savepoint explicitly.
+type savePointDialect interface {
+	SavePointSql(name string) string
+	ReleaseSavePointSql(name string) string
+	RollbackToSavePointSql(name string) string
+}
+
+// SavePoint is a nested transaction created by Session.SavePoint, the queued
+// after processors are dropped if it's rollbacked. Only the first Commit or
+// Rollback of a savepoint takes effect, so Rollback could be deferred after
+// the savepoint is created.
+type SavePoint struct {
+	session          *Session
+	name             string
+	done             bool
+	afterInsertBeans map[interface{}]int
+	afterUpdateBeans map[interface{}]int
+	afterDeleteBeans map[interface{}]int
+}
+
+func snapshotProcessors(beans map[interface{}]*[]func(interface{})) map[interface{}]int {
+	var snapshot = make(map[interface{}]int, len(beans))
+	for bean, closuresPtr := range beans {
+		if closuresPtr == nil {
+			snapshot[bean] = -1
+		} else {
+			snapshot[bean] = len(*closuresPtr)
+		}
+	}
+	return snapshot
+}
+
+func cleanupProcessorsBeans(beans *map[interface{}]*[]func(interface{})) {
+	if len(*beans) > 0 {
+		*beans = make(map[interface{}]*[]func(interface{}), 0)
+	}
+}
+
+func restoreProcessors(beans map[interface{}]*[]func(interface{}), snapshot map[interface{}]int) {
+	for bean, closuresPtr := range beans {
+		l, ok := snapshot[bean]
+		if !ok {
+			delete(beans, bean)
+		} else if l < 0 {
+			beans[bean] = nil
+		} else if closuresPtr != nil && len(*closuresPtr) > l {
+			*closuresPtr = (*closuresPtr)[:l]
+		}
+	}
+}
+
+// Begin a transaction. If the session is already in a transaction, nothing
+// will be done, and SavePoint should be used to begin a nested transaction.
 func (session *Session) Begin() error {
+	return session.BeginTx(nil)
+}
+
+// BeginTx begins a transaction with the options, such as the isolation level
+// and read only.
+func (session *Session) BeginTx(opts *sql.TxOptions) error {
 	if session.isAutoCommit {
-		tx, err := session.DB().Begin()
+		tx, err := session.DB().BeginTx(session.ctx, opts)
 		if err != nil {
 			return err
 		}
 		session.isAutoCommit = false
 		session.isCommitedOrRollbacked = false
+		session.txWritten = false
 		session.tx = tx
 		session.saveLastSQL("BEGIN TRANSACTION")
 	}
 	return nil
 }
 
+// SavePoint creates a savepoint in the transaction of the session, its Commit
+// and Rollback release or rollback to the savepoint but not the transaction.
+func (session *Session) SavePoint() (*SavePoint, error) {
+	if session.isAutoCommit || session.isCommitedOrRollbacked {
+		return nil, errors.New("savepoint needs a transaction")
+	}
+	dialect, ok := session.engine.dialect.(savePointDialect)
+	if !ok {
+		return nil, ErrNotImplemented
+	}
+
+	var name = fmt.Sprintf("xorm_sp_%d", len(session.savePoints)+1)
+	var sqlStr = dialect.SavePointSql(name)
+	session.saveLastSQL(sqlStr)
+	if _, err := session.tx.ExecContext(session.ctx, sqlStr); err != nil {
+		return nil, err
+	}
+
+	sp := &SavePoint{
+		session:          session,
+		name:             name,
+		afterInsertBeans: snapshotProcessors(session.afterInsertBeans),
+		afterUpdateBeans: snapshotProcessors(session.afterUpdateBeans),
+		afterDeleteBeans: snapshotProcessors(session.afterDeleteBeans),
+	}
+	session.savePoints = append(session.savePoints, sp)
+	return sp, nil
+}
+
+// popSavePoints removes the savepoint and the ones created after it, false is
+// returned if the savepoint has been released or rollbacked
+func (session *Session) popSavePoints(sp *SavePoint) bool {
+	for i := len(session.savePoints) - 1; i >= 0; i-- {
+		if session.savePoints[i] == sp {
+			for _, nested := range session.savePoints[i:] {
+				nested.done = true
+			}
+			session.savePoints = session.savePoints[:i]
+			return true
+		}
+	}
+	return false
+}
+
+// endSavePoints marks all the savepoints done when the transaction ends
+func (session *Session) endSavePoints() {
+	for _, sp := range session.savePoints {
+		sp.done = true
+	}
+	session.savePoints = nil
+}
+
+// Rollback rollbacks to the savepoint, the savepoints created after it are
+// rollbacked too. It does nothing after the savepoint is committed or rollbacked.
+func (sp *SavePoint) Rollback() error {
+	var session = sp.session
+	if sp.done || !session.popSavePoints(sp) {
+		return nil
+	}
+
+	// the queued processors should be discarded even if rollback failed,
+	// since the outer transaction could not be committed successfully
+	restoreProcessors(session.afterInsertBeans, sp.afterInsertBeans)
+	restoreProcessors(session.afterUpdateBeans, sp.afterUpdateBeans)
+	restoreProcessors(session.afterDeleteBeans, sp.afterDeleteBeans)
+
+	sqlStr := session.engine.dialect.(savePointDialect).RollbackToSavePointSql(sp.name)
+	session.saveLastSQL(sqlStr)
+	_, err := session.tx.ExecContext(session.ctx, sqlStr)
+	return err
+}
+
+// Commit releases the savepoint, the changes are committed with the transaction.
+// It does nothing after the savepoint is committed or rollbacked.
+func (sp *SavePoint) Commit() error {
+	var session = sp.session
+	if sp.done || !session.popSavePoints(sp) {
+		return nil
+	}
+
+	sqlStr := session.engine.dialect.(savePointDialect).ReleaseSavePointSql(sp.name)
+	if len(sqlStr) == 0 {
+		return nil
+	}
+	session.saveLastSQL(sqlStr)
+	_, err := session.tx.ExecContext(session.ctx, sqlStr)
+	return err
+}
+
 // Rollback When using transaction, you can rollback if any error
 func (session *Session) Rollback() error {
 	if !session.isAutoCommit && !session.isCommitedOrRollbacked {
 		session.saveLastSQL(session.engine.dialect.RollBackStr())
 		session.isCommitedOrRollbacked = true
+		session.isAutoCommit = true
+		session.txWritten = false
+		session.endSavePoints()
+		cleanupProcessorsBeans(&session.afterInsertBeans)
+		cleanupProcessorsBeans(&session.afterUpdateBeans)
+		cleanupProcessorsBeans(&session.afterDeleteBeans)
 		return session.tx.Rollback()
 	}
 	return nil
@@ -34,8 +195,15 @@ func (session *Session) Commit() error {
 	if !session.isAutoCommit && !session.isCommitedOrRollbacked {
 		session.saveLastSQL("COMMIT")
 		session.isCommitedOrRollbacked = true
+		session.isAutoCommit = true
+		session.endSavePoints()
 		var err error
 		if err = session.tx.Commit(); err == nil {
+			if session.txWritten {
+				session.txWritten = false
+				session.markWritten()
+			}
+
 			// handle processors after tx committed
 			closureCallFunc := func(closuresPtr *[]func(interface{}), bean interface{}) {
 				if closuresPtr != nil {
@@ -66,15 +234,14 @@ func (session *Session) Commit() error {
 					processor.AfterDelete()
 				}
 			}
-			cleanUpFunc := func(slices *map[interface{}]*[]func(interface{})) {
-				if len(*slices) > 0 {
-					*slices = make(map[interface{}]*[]func(interface{}), 0)
-				}
-			}
-			cleanUpFunc(&session.afterInsertBeans)
-			cleanUpFunc(&session.afterUpdateBeans)
-			cleanUpFunc(&session.afterDeleteBeans)
 		}
+
+		// the processors are dropped if the commit failed, since the transaction
+		// may be retried and queue them again
+		session.txWritten = false
+		cleanupProcessorsBeans(&session.afterInsertBeans)
+		cleanupProcessorsBeans(&session.afterUpdateBeans)
+		cleanupProcessorsBeans(&session.afterDeleteBeans)
 		return err
 	}
 	return nil
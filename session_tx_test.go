@@ -190,3 +190,66 @@ func TestCombineTransactionSameMapper(t *testing.T) {
 		panic(err)
 	}
 }
+
+func TestNestedTransaction(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+	assertSync(t, new(ProcessorsStruct))
+
+	session := testEngine.NewSession()
+	defer session.Close()
+
+	_, err := session.SavePoint()
+	assert.Error(t, err)
+
+	assert.NoError(t, session.Begin())
+	// Begin does nothing in a transaction
+	assert.NoError(t, session.Begin())
+
+	p1 := &ProcessorsStruct{}
+	_, err = session.Insert(p1)
+	assert.NoError(t, err)
+
+	// rollback the nested transaction, p2 should not be inserted and its
+	// after processors should not be called
+	sp, err := session.SavePoint()
+	assert.NoError(t, err)
+	p2 := &ProcessorsStruct{}
+	var p2AfterCalled bool
+	_, err = session.After(func(bean interface{}) {
+		p2AfterCalled = true
+	}).Insert(p2)
+	assert.NoError(t, err)
+	assert.NoError(t, sp.Rollback())
+	assert.NoError(t, sp.Rollback())
+
+	// commit the nested transaction, p3 will be inserted when outer transaction
+	// committed, and the deferred rollback after the commit does nothing
+	p3 := &ProcessorsStruct{}
+	assert.NoError(t, func() error {
+		sp, err := session.SavePoint()
+		if err != nil {
+			return err
+		}
+		defer sp.Rollback()
+		if _, err = session.Insert(p3); err != nil {
+			return err
+		}
+		return sp.Commit()
+	}())
+
+	assert.EqualValues(t, 0, p1.AfterInsertedFlag)
+	assert.EqualValues(t, 0, p3.AfterInsertedFlag)
+
+	assert.NoError(t, session.Commit())
+
+	assert.EqualValues(t, 1, p1.AfterInsertedFlag)
+	assert.EqualValues(t, 0, p2.AfterInsertedFlag)
+	assert.False(t, p2AfterCalled)
+	assert.EqualValues(t, 1, p3.AfterInsertedFlag)
+
+	var ps []ProcessorsStruct
+	assert.NoError(t, testEngine.Asc("id").Find(&ps))
+	assert.EqualValues(t, 2, len(ps))
+	assert.EqualValues(t, p1.Id, ps[0].Id)
+	assert.EqualValues(t, p3.Id, ps[1].Id)
+}
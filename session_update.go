@@ -353,13 +353,63 @@ func (session *Session) Update(bean interface{}, condiBean ...interface{}) (int6
 		strings.Join(colNames, ", "),
 		condSQL)
 
-	res, err := session.exec(sqlStr, append(args, condArgs...)...)
-	if err != nil {
-		return 0, err
-	} else if doIncVer {
-		if verValue != nil && verValue.IsValid() && verValue.CanSet() {
+	var returning = session.statement.returning
+	var returningMode = session.engine.returningMode()
+	var idParam = session.statement.idParam
+	if returning != nil {
+		if err = returningBean(bean); err != nil {
+			return 0, err
+		}
+
+		switch returningMode {
+		case returningClause:
+			sqlStr = session.genReturningSQL(sqlStr, table, returning)
+		case returningOutput:
+			sqlStr = session.genOutputSQL(sqlStr, len(sqlStr)-len(condSQL)-1, table, returning, "INSERTED.")
+		case returningReselect:
+			// the updated record is selected again by the primary keys
+			if idParam == nil && len(table.PrimaryKeys) > 0 {
+				if _, err = reselectPK(table, bean); err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
+
+	var affected int64
+	if returning != nil && returningMode != returningReselect {
+		rows, err := session.queryRows(sqlStr, append(args, condArgs...)...)
+		if err != nil {
+			return 0, err
+		}
+		if doIncVer && verValue != nil && verValue.IsValid() && verValue.CanSet() {
 			verValue.SetInt(verValue.Int() + 1)
 		}
+		if affected, err = session.scanReturning(rows, table, []interface{}{bean}); err != nil {
+			return affected, err
+		}
+	} else {
+		res, err := session.exec(sqlStr, append(args, condArgs...)...)
+		if err != nil {
+			return 0, err
+		} else if doIncVer {
+			if verValue != nil && verValue.IsValid() && verValue.CanSet() {
+				verValue.SetInt(verValue.Int() + 1)
+			}
+		}
+		if affected, err = res.RowsAffected(); err != nil {
+			return 0, err
+		}
+
+		if returning != nil && affected > 0 {
+			var pk core.PK
+			if idParam != nil {
+				pk = *idParam
+			}
+			if err = session.reselect(table, tableName, returning, bean, pk); err != nil {
+				return affected, err
+			}
+		}
 	}
 
 	if table != nil {
@@ -400,5 +450,5 @@ func (session *Session) Update(bean interface{}, condiBean ...interface{}) (int6
 	cleanupProcessorsClosures(&session.afterClosures) // cleanup after used
 	// --
 
-	return res.RowsAffected()
+	return affected, nil
 }
@@ -206,6 +206,84 @@ func TestForUpdate(t *testing.T) {
 	wg.Wait()
 }
 
+func TestRowLock(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+	assert.NoError(t, setupForUpdate(testEngine))
+
+	var records []ForUpdate
+	assert.NoError(t, testEngine.NewSession().ForShare().Find(&records))
+	assert.EqualValues(t, 3, len(records))
+
+	err := testEngine.NewSession().SkipLocked().Find(&records)
+	if testEngine.Dialect().DBType() == core.SQLITE {
+		assert.EqualValues(t, ErrLockNotSupported, err)
+	} else {
+		assert.NoError(t, err)
+	}
+
+	// the options of the row locking are checked by the version of mysql
+	var mysql57, mysql80 = &mysql{serverVersion: "5.7.40-log"}, &mysql{serverVersion: "8.0.32"}
+
+	var cases = []struct {
+		dialect   rowLockDialect
+		lock      rowLock
+		clause    string
+		tableHint string
+		err       error
+	}{
+		{&mysql{}, rowLock{}, " FOR UPDATE", "", nil},
+		{&mysql{}, rowLock{share: true}, " LOCK IN SHARE MODE", "", nil},
+		{mysql80, rowLock{share: true, noWait: true}, " FOR SHARE NOWAIT", "", nil},
+		{mysql80, rowLock{skipLocked: true}, " FOR UPDATE SKIP LOCKED", "", nil},
+		{mysql57, rowLock{share: true, noWait: true}, "", "", ErrLockNotSupported},
+		{mysql57, rowLock{skipLocked: true}, "", "", ErrLockNotSupported},
+		{&postgres{}, rowLock{skipLocked: true, tables: []string{"job"}}, ` FOR UPDATE OF "job" SKIP LOCKED`, "", nil},
+		{&postgres{}, rowLock{share: true}, " FOR SHARE", "", nil},
+		{&oracle{}, rowLock{noWait: true}, " FOR UPDATE NOWAIT", "", nil},
+		{&oracle{}, rowLock{share: true}, "", "", ErrLockNotSupported},
+		{&mssql{}, rowLock{skipLocked: true}, "", " WITH (UPDLOCK, READPAST)", nil},
+		{&mssql{}, rowLock{share: true, noWait: true}, "", " WITH (REPEATABLEREAD, NOWAIT)", nil},
+		{&mssql{}, rowLock{tables: []string{"job"}}, "", "", ErrLockNotSupported},
+		{&sqlite3{}, rowLock{share: true}, "", "", nil},
+		{&sqlite3{}, rowLock{noWait: true}, "", "", ErrLockNotSupported},
+	}
+	for _, c := range cases {
+		clause, tableHint, err := c.dialect.RowLockSql(&c.lock)
+		assert.EqualValues(t, c.err, err)
+		assert.EqualValues(t, c.clause, clause)
+		assert.EqualValues(t, c.tableHint, tableHint)
+	}
+
+	// the version failed to be queried is returned and queried again next time
+	if testEngine.Dialect().DBType() == core.SQLITE {
+		var engine *Engine
+		switch e := testEngine.(type) {
+		case *Engine:
+			engine = e
+		case *EngineGroup:
+			engine = e.Master()
+		}
+		var failed = &mysql{}
+		assert.NoError(t, failed.Init(engine.DB(), &core.Uri{DbType: core.MYSQL}, "mysql", ""))
+		for i := 0; i < 2; i++ {
+			_, _, err = failed.RowLockSql(&rowLock{skipLocked: true})
+			assert.Error(t, err)
+			assert.NotEqual(t, ErrLockNotSupported, err)
+			assert.EqualValues(t, "", failed.serverVersion)
+		}
+	}
+
+	// the hints of mssql follow the table
+	dialect := &mssql{}
+	assert.NoError(t, dialect.Init(nil, &core.Uri{DbType: core.MSSQL}, "mssql", ""))
+	statement := &Statement{Engine: &Engine{dialect: dialect}}
+	statement.Init()
+	statement.Table("job").Alias("j").Join("INNER", "worker", "worker.id = j.worker_id").SkipLocked()
+	sqlStr, err := statement.genSelectSQL("*", "")
+	assert.NoError(t, err)
+	assert.EqualValues(t, `SELECT * FROM "job" AS "j" WITH (UPDLOCK, READPAST) INNER JOIN "worker" ON worker.id = j.worker_id`, sqlStr)
+}
+
 func TestWithIn(t *testing.T) {
 	type temp3 struct {
 		Id   int64  `xorm:"Id pk autoincr"`
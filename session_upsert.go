@@ -0,0 +1,200 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-xorm/core"
+)
+
+// OnConflict makes the following Insert or InsertMulti update or ignore the records
+// which conflict with the existing ones on the columns. If no column is given, the
+// primary keys will be used. MySQL always checks all the unique keys, so the
+// columns will be ignored. Call DoUpdate or DoNothing to choose the action, the
+// default action is DoUpdate with all the inserted columns. The version of the
+// bean is read back on postgres, and it's left unchanged on the other databases
+// if the record may have been updated.
+func (session *Session) OnConflict(columns ...string) *Session {
+	session.statement.OnConflict(columns...)
+	return session
+}
+
+// DoUpdate updates the columns of the conflicting records with the values to be
+// inserted, all the inserted columns except the conflict columns, primary keys and
+// created columns will be updated if no column is given. The updated columns will
+// always be updated and the version column will be increased.
+func (session *Session) DoUpdate(columns ...string) *Session {
+	session.statement.DoUpdate(columns...)
+	return session
+}
+
+// DoNothing ignores the records which conflict with the existing ones
+func (session *Session) DoNothing() *Session {
+	session.statement.DoNothing()
+	return session
+}
+
+// genUpsertSQL generates the upsert statement, rowsPlaces are the placeholders or
+// the expressions of the inserted columns of every record
+func (session *Session) genUpsertSQL(tableName string, colNames []string, rowsPlaces [][]string) (string, error) {
+	var (
+		statement = session.statement
+		engine    = session.engine
+		table     = statement.RefTable
+		dbType    = engine.dialect.DBType()
+	)
+
+	conflictCols, err := statement.conflictColumns()
+	if err != nil {
+		return "", err
+	}
+	updateCols, err := statement.conflictUpdateColumns(colNames, conflictCols)
+	if err != nil {
+		return "", err
+	}
+
+	quotedCols := make([]string, len(colNames))
+	for i, colName := range colNames {
+		quotedCols[i] = engine.Quote(colName)
+	}
+
+	var sets = make([]string, 0, len(updateCols)+1)
+	for _, colName := range updateCols {
+		var value string
+		switch dbType {
+		case core.MYSQL:
+			value = "VALUES(" + engine.Quote(colName) + ")"
+		case core.POSTGRES, core.SQLITE:
+			value = "excluded." + engine.Quote(colName)
+		default:
+			value = "source." + engine.Quote(colName)
+		}
+		sets = append(sets, engine.Quote(colName)+" = "+value)
+	}
+	if len(sets) > 0 && table.Version != "" && statement.checkVersion {
+		var version string
+		switch dbType {
+		case core.MYSQL, core.SQLITE:
+			version = engine.Quote(table.Version)
+		case core.POSTGRES:
+			version = engine.Quote(tableName) + "." + engine.Quote(table.Version)
+		default:
+			version = "target." + engine.Quote(table.Version)
+		}
+		sets = append(sets, engine.Quote(table.Version)+" = "+version+" + 1")
+	}
+
+	switch dbType {
+	case core.MYSQL, core.POSTGRES, core.SQLITE:
+		var rows = make([]string, len(rowsPlaces))
+		for i, places := range rowsPlaces {
+			rows[i] = strings.Join(places, ", ")
+		}
+
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "INSERT INTO %s (%s) VALUES (%s)",
+			engine.Quote(tableName),
+			strings.Join(quotedCols, ", "),
+			strings.Join(rows, "),("))
+
+		if dbType == core.MYSQL {
+			if table.AutoIncrement != "" {
+				// so that LastInsertId returns the id of the updated record
+				sets = append(sets, fmt.Sprintf("%s = LAST_INSERT_ID(%s)",
+					engine.Quote(table.AutoIncrement), engine.Quote(table.AutoIncrement)))
+			} else if len(sets) == 0 {
+				sets = append(sets, quotedCols[0]+" = "+quotedCols[0])
+			}
+			buf.WriteString(" ON DUPLICATE KEY UPDATE ")
+			buf.WriteString(strings.Join(sets, ", "))
+			return buf.String(), nil
+		}
+
+		buf.WriteString(" ON CONFLICT")
+		if len(conflictCols) > 0 {
+			var quotedConflictCols = make([]string, len(conflictCols))
+			for i, colName := range conflictCols {
+				quotedConflictCols[i] = engine.Quote(colName)
+			}
+			buf.WriteString(" (" + strings.Join(quotedConflictCols, ", ") + ")")
+		}
+		if len(sets) == 0 {
+			buf.WriteString(" DO NOTHING")
+		} else {
+			buf.WriteString(" DO UPDATE SET ")
+			buf.WriteString(strings.Join(sets, ", "))
+		}
+		return buf.String(), nil
+	case core.MSSQL, core.ORACLE:
+		if len(conflictCols) == 0 {
+			return "", errors.New("upsert needs the conflict columns or the primary keys")
+		}
+		for _, colName := range conflictCols {
+			var inserted bool
+			for _, name := range colNames {
+				if name == colName {
+					inserted = true
+					break
+				}
+			}
+			if !inserted {
+				return "", fmt.Errorf("conflict column %s is not inserted", colName)
+			}
+		}
+
+		var source string
+		if dbType == core.MSSQL {
+			var rows = make([]string, len(rowsPlaces))
+			for i, places := range rowsPlaces {
+				rows[i] = strings.Join(places, ", ")
+			}
+			source = fmt.Sprintf("(VALUES (%s)) AS source (%s)",
+				strings.Join(rows, "),("), strings.Join(quotedCols, ", "))
+		} else {
+			var rows = make([]string, len(rowsPlaces))
+			for i, places := range rowsPlaces {
+				var aliased = make([]string, len(places))
+				for j, place := range places {
+					aliased[j] = place + " " + quotedCols[j]
+				}
+				rows[i] = "SELECT " + strings.Join(aliased, ", ") + " FROM DUAL"
+			}
+			source = "(" + strings.Join(rows, " UNION ALL ") + ") source"
+		}
+
+		var conds = make([]string, len(conflictCols))
+		for i, colName := range conflictCols {
+			conds[i] = fmt.Sprintf("target.%s = source.%s", engine.Quote(colName), engine.Quote(colName))
+		}
+		var values = make([]string, len(quotedCols))
+		for i, colName := range quotedCols {
+			values[i] = "source." + colName
+		}
+
+		var target = engine.Quote(tableName) + " target"
+		if dbType == core.MSSQL {
+			target = engine.Quote(tableName) + " AS target"
+		}
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "MERGE INTO %s USING %s ON (%s)",
+			target, source, strings.Join(conds, " AND "))
+		if len(sets) > 0 {
+			buf.WriteString(" WHEN MATCHED THEN UPDATE SET ")
+			buf.WriteString(strings.Join(sets, ", "))
+		}
+		fmt.Fprintf(&buf, " WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s)",
+			strings.Join(quotedCols, ", "), strings.Join(values, ", "))
+		if dbType == core.MSSQL {
+			// mssql requires MERGE to be terminated by a semicolon
+			buf.WriteString(";")
+		}
+		return buf.String(), nil
+	}
+	return "", ErrNotImplemented
+}
@@ -0,0 +1,105 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-xorm/core"
+	"github.com/stretchr/testify/assert"
+)
+
+type UpsertStruct struct {
+	Id      int64
+	Name    string `xorm:"unique"`
+	Score   int
+	Created time.Time `xorm:"created"`
+	Updated time.Time `xorm:"updated"`
+	Version int       `xorm:"version"`
+}
+
+func TestUpsertDoUpdate(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+	assertSync(t, new(UpsertStruct))
+
+	cnt, err := testEngine.OnConflict("name").Insert(&UpsertStruct{Name: "a", Score: 1})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+
+	var bean = UpsertStruct{Name: "a", Score: 2}
+	cnt, err = testEngine.OnConflict("name").DoUpdate("score").Insert(&bean)
+	assert.NoError(t, err)
+	assert.True(t, cnt > 0)
+	if testEngine.Dialect().DBType() == core.POSTGRES {
+		// the version of the updated record is read back
+		assert.EqualValues(t, 2, bean.Version)
+	} else {
+		// the version of the updated record is unknown
+		assert.EqualValues(t, 0, bean.Version)
+	}
+
+	var records []UpsertStruct
+	assert.NoError(t, testEngine.Find(&records))
+	assert.EqualValues(t, 1, len(records))
+	assert.EqualValues(t, 2, records[0].Score)
+	assert.EqualValues(t, 2, records[0].Version)
+
+	var beans = []*UpsertStruct{
+		{Name: "a", Score: 3},
+		{Name: "b", Score: 4},
+	}
+	cnt, err = testEngine.OnConflict("name").Insert(beans)
+	assert.NoError(t, err)
+	assert.True(t, cnt > 0)
+	assert.EqualValues(t, 0, beans[0].Version)
+	assert.EqualValues(t, 0, beans[1].Version)
+
+	records = records[:0]
+	assert.NoError(t, testEngine.Asc("name").Find(&records))
+	assert.EqualValues(t, 2, len(records))
+	assert.EqualValues(t, 3, records[0].Score)
+	assert.EqualValues(t, 3, records[0].Version)
+	assert.EqualValues(t, 4, records[1].Score)
+	assert.EqualValues(t, 1, records[1].Version)
+}
+
+func TestUpsertDoNothing(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+	assertSync(t, new(UpsertStruct))
+
+	_, err := testEngine.Insert(&UpsertStruct{Name: "a", Score: 1})
+	assert.NoError(t, err)
+
+	cnt, err := testEngine.OnConflict("name").DoNothing().Insert(&UpsertStruct{Name: "a", Score: 2})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, cnt)
+
+	var records []UpsertStruct
+	assert.NoError(t, testEngine.Find(&records))
+	assert.EqualValues(t, 1, len(records))
+	assert.EqualValues(t, 1, records[0].Score)
+	assert.EqualValues(t, 1, records[0].Version)
+
+	_, err = testEngine.OnConflict("unknown").DoNothing().Insert(&UpsertStruct{Name: "a"})
+	assert.Error(t, err)
+}
+
+func TestUpsertNoColumn(t *testing.T) {
+	assert.NoError(t, prepareEngine())
+
+	type UpsertNoColumn struct {
+		Id int64
+	}
+	assertSync(t, new(UpsertNoColumn))
+
+	// the upsert is not dropped silently when nothing is inserted
+	_, err := testEngine.OnConflict().Insert(&UpsertNoColumn{})
+	assert.Error(t, err)
+
+	cnt, err := testEngine.Count(new(UpsertNoColumn))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, cnt)
+}
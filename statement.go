@@ -33,6 +33,12 @@ type exprParam struct {
 	expr    string
 }
 
+type conflictParam struct {
+	columns       []string
+	updateColumns []string
+	doNothing     bool
+}
+
 // Statement save all the sql info for executing SQL
 type Statement struct {
 	RefTable        *core.Table
@@ -52,6 +58,7 @@ type Statement struct {
 	OmitStr         string
 	AltTableName    string
 	tableName       string
+	schema          string // kept across the statements of the session
 	RawSQL          string
 	RawParams       []interface{}
 	UseCascade      bool
@@ -72,8 +79,24 @@ type Statement struct {
 	incrColumns     map[string]incrParam
 	decrColumns     map[string]decrParam
 	exprColumns     map[string]exprParam
+	conflict        *conflictParam
+	returning       []string
 	cond            builder.Cond
 	bufferSize      int
+	batchSize       int
+	preload         bool
+	preloadFields   []string
+	cascadeRels     bool
+	fromSQL         string
+	fromArgs        []interface{}
+	useSubQuery     bool
+	ctes            []commonTableExpr
+	setOps          []setOperation
+	pageSize        int
+	pageCursor      string
+	pageBefore      bool
+	countOver       bool
+	lock            rowLock
 }
 
 // Init reset all the statement's fields
@@ -111,8 +134,24 @@ func (statement *Statement) Init() {
 	statement.incrColumns = make(map[string]incrParam)
 	statement.decrColumns = make(map[string]decrParam)
 	statement.exprColumns = make(map[string]exprParam)
+	statement.conflict = nil
+	statement.returning = nil
 	statement.cond = builder.NewCond()
 	statement.bufferSize = 0
+	statement.batchSize = 0
+	statement.preload = false
+	statement.preloadFields = nil
+	statement.cascadeRels = false
+	statement.fromSQL = ""
+	statement.fromArgs = nil
+	statement.useSubQuery = false
+	statement.ctes = nil
+	statement.setOps = nil
+	statement.pageSize = 0
+	statement.pageCursor = ""
+	statement.pageBefore = false
+	statement.countOver = false
+	statement.lock = rowLock{}
 }
 
 // NoAutoCondition if you do not want convert bean's field as query condition, then use this function
@@ -158,7 +197,7 @@ func (statement *Statement) Where(query interface{}, args ...interface{}) *State
 func (statement *Statement) And(query interface{}, args ...interface{}) *Statement {
 	switch query.(type) {
 	case string:
-		cond := builder.Expr(query.(string), args...)
+		cond := statement.expr(query.(string), args...)
 		statement.cond = statement.cond.And(cond)
 	case map[string]interface{}:
 		cond := builder.Eq(query.(map[string]interface{}))
@@ -182,7 +221,7 @@ func (statement *Statement) And(query interface{}, args ...interface{}) *Stateme
 func (statement *Statement) Or(query interface{}, args ...interface{}) *Statement {
 	switch query.(type) {
 	case string:
-		cond := builder.Expr(query.(string), args...)
+		cond := statement.expr(query.(string), args...)
 		statement.cond = statement.cond.Or(cond)
 	case map[string]interface{}:
 		cond := builder.Eq(query.(map[string]interface{}))
@@ -201,15 +240,23 @@ func (statement *Statement) Or(query interface{}, args ...interface{}) *Statemen
 	return statement
 }
 
-// In generate "Where column IN (?) " statement
+// In generate "Where column IN (?) " statement, the only argument could be a subquery
 func (statement *Statement) In(column string, args ...interface{}) *Statement {
+	if len(args) == 1 && isSubQuery(args[0]) {
+		statement.cond = statement.cond.And(statement.expr(statement.Engine.Quote(column)+" IN ?", args[0]))
+		return statement
+	}
 	in := builder.In(statement.Engine.Quote(column), args...)
 	statement.cond = statement.cond.And(in)
 	return statement
 }
 
-// NotIn generate "Where column NOT IN (?) " statement
+// NotIn generate "Where column NOT IN (?) " statement, the only argument could be a subquery
 func (statement *Statement) NotIn(column string, args ...interface{}) *Statement {
+	if len(args) == 1 && isSubQuery(args[0]) {
+		statement.cond = statement.cond.And(statement.expr(statement.Engine.Quote(column)+" NOT IN ?", args[0]))
+		return statement
+	}
 	notIn := builder.NotIn(statement.Engine.Quote(column), args...)
 	statement.cond = statement.cond.And(notIn)
 	return statement
@@ -504,10 +551,19 @@ func (statement *Statement) colName(col *core.Column, tableName string) string {
 // TableName return current tableName
 func (statement *Statement) TableName() string {
 	if statement.AltTableName != "" {
-		return statement.AltTableName
+		return statement.tbNameWithSchema(statement.AltTableName)
 	}
 
-	return statement.tableName
+	return statement.tbNameWithSchema(statement.tableName)
+}
+
+// tbNameWithSchema qualifies the table name by the schema of the session, or the
+// schema of the engine if the session has no schema
+func (statement *Statement) tbNameWithSchema(v string) string {
+	if statement.schema == "" || v == "" || strings.Contains(v, ".") {
+		return statement.Engine.tbNameWithSchema(v)
+	}
+	return statement.schema + "." + v
 }
 
 // ID generate "where id = ? " statement or for composite key "where key1 = ? and key2 = ?"
@@ -567,6 +623,107 @@ func (statement *Statement) SetExpr(column string, expression string) *Statement
 	return statement
 }
 
+// OnConflict sets the conflict columns of the upsert
+func (statement *Statement) OnConflict(columns ...string) *Statement {
+	statement.conflict = &conflictParam{columns: col2NewCols(columns...)}
+	return statement
+}
+
+// DoUpdate sets the columns to be updated when conflict
+func (statement *Statement) DoUpdate(columns ...string) *Statement {
+	if statement.conflict == nil {
+		statement.conflict = &conflictParam{}
+	}
+	statement.conflict.updateColumns = col2NewCols(columns...)
+	statement.conflict.doNothing = false
+	return statement
+}
+
+// DoNothing ignores the conflicting records
+func (statement *Statement) DoNothing() *Statement {
+	if statement.conflict == nil {
+		statement.conflict = &conflictParam{}
+	}
+	statement.conflict.updateColumns = nil
+	statement.conflict.doNothing = true
+	return statement
+}
+
+// Returning sets the columns to be returned after insert, update or delete
+func (statement *Statement) Returning(columns ...string) *Statement {
+	statement.returning = col2NewCols(columns...)
+	return statement
+}
+
+// conflictColumns returns the column names of the conflict target, the primary
+// keys will be returned if no column is given
+func (statement *Statement) conflictColumns() ([]string, error) {
+	table := statement.RefTable
+	if len(statement.conflict.columns) == 0 {
+		return table.PrimaryKeys, nil
+	}
+
+	var columns = make([]string, 0, len(statement.conflict.columns))
+	for _, name := range statement.conflict.columns {
+		col := table.GetColumn(name)
+		if col == nil {
+			return nil, fmt.Errorf("column %s is not found in table %s", name, table.Name)
+		}
+		columns = append(columns, col.Name)
+	}
+	return columns, nil
+}
+
+// conflictUpdateColumns returns the column names to be updated when conflict
+func (statement *Statement) conflictUpdateColumns(colNames, conflictCols []string) ([]string, error) {
+	if statement.conflict.doNothing {
+		return nil, nil
+	}
+
+	table := statement.RefTable
+	var inserted = make(map[string]bool, len(colNames))
+	for _, colName := range colNames {
+		inserted[colName] = true
+	}
+
+	var columns []string
+	if len(statement.conflict.updateColumns) > 0 {
+		for _, name := range statement.conflict.updateColumns {
+			col := table.GetColumn(name)
+			if col == nil {
+				return nil, fmt.Errorf("column %s is not found in table %s", name, table.Name)
+			}
+			if !inserted[col.Name] {
+				return nil, fmt.Errorf("column %s is not inserted", col.Name)
+			}
+			if !col.IsVersion && !(col.IsUpdated && statement.UseAutoTime) {
+				columns = append(columns, col.Name)
+			}
+		}
+	} else {
+		var conflicts = make(map[string]bool, len(conflictCols))
+		for _, colName := range conflictCols {
+			conflicts[colName] = true
+		}
+		for _, colName := range colNames {
+			col := table.GetColumn(colName)
+			if conflicts[colName] || col == nil || col.IsPrimaryKey || col.IsAutoIncrement ||
+				col.IsCreated || col.IsVersion || col.IsUpdated {
+				continue
+			}
+			columns = append(columns, colName)
+		}
+	}
+
+	// the updated columns will always be updated with the inserted time
+	for _, colName := range colNames {
+		if col := table.GetColumn(colName); col != nil && col.IsUpdated && statement.UseAutoTime {
+			columns = append(columns, colName)
+		}
+	}
+	return columns, nil
+}
+
 // Generate  "Update ... Set column = column + arg" statement
 func (statement *Statement) getInc() map[string]incrParam {
 	return statement.incrColumns
@@ -629,6 +786,7 @@ func (statement *Statement) Distinct(columns ...string) *Statement {
 // ForUpdate generates "SELECT ... FOR UPDATE" statement
 func (statement *Statement) ForUpdate() *Statement {
 	statement.IsForUpdate = true
+	statement.lock.share = false
 	return statement
 }
 
@@ -743,7 +901,8 @@ func (statement *Statement) Asc(colNames ...string) *Statement {
 	return statement
 }
 
-// Join The joinOP should be one of INNER, LEFT OUTER, CROSS etc - this will be prepended to JOIN
+// Join The joinOP should be one of INNER, LEFT OUTER, CROSS etc - this will be prepended to JOIN.
+// The table could be a subquery, and []interface{}{subquery, alias} joins it with the alias.
 func (statement *Statement) Join(joinOP string, tablename interface{}, condition string, args ...interface{}) *Statement {
 	var buf bytes.Buffer
 	if len(statement.JoinStr) > 0 {
@@ -756,9 +915,9 @@ func (statement *Statement) Join(joinOP string, tablename interface{}, condition
 	case []string:
 		t := tablename.([]string)
 		if len(t) > 1 {
-			fmt.Fprintf(&buf, "%v AS %v", statement.Engine.Quote(t[0]), statement.Engine.Quote(t[1]))
+			fmt.Fprintf(&buf, "%v AS %v", statement.Engine.Quote(statement.tbNameWithSchema(t[0])), statement.Engine.Quote(t[1]))
 		} else if len(t) == 1 {
-			fmt.Fprintf(&buf, statement.Engine.Quote(t[0]))
+			fmt.Fprintf(&buf, statement.Engine.Quote(statement.tbNameWithSchema(t[0])))
 		}
 	case []interface{}:
 		t := tablename.([]interface{})
@@ -766,22 +925,43 @@ func (statement *Statement) Join(joinOP string, tablename interface{}, condition
 		var table string
 		if l > 0 {
 			f := t[0]
-			v := rValue(f)
-			t := v.Type()
-			if t.Kind() == reflect.String {
-				table = f.(string)
-			} else if t.Kind() == reflect.Struct {
-				table = statement.Engine.tbName(v)
+			if isSubQuery(f) {
+				sqlStr, subArgs, err := subQuerySQL(f)
+				if err != nil {
+					statement.cond = statement.cond.And(errCond{err})
+					return statement
+				}
+				statement.useSubQuery = true
+				statement.joinArgs = append(statement.joinArgs, subArgs...)
+				table = "(" + sqlStr + ")"
+			} else {
+				v := rValue(f)
+				t := v.Type()
+				if t.Kind() == reflect.String {
+					table = f.(string)
+				} else if t.Kind() == reflect.Struct {
+					table = statement.Engine.tbName(v)
+				}
+				table = statement.Engine.Quote(statement.tbNameWithSchema(table))
 			}
 		}
 		if l > 1 {
-			fmt.Fprintf(&buf, "%v AS %v", statement.Engine.Quote(table),
+			fmt.Fprintf(&buf, "%v AS %v", table,
 				statement.Engine.Quote(fmt.Sprintf("%v", t[1])))
 		} else if l == 1 {
-			fmt.Fprintf(&buf, statement.Engine.Quote(table))
+			buf.WriteString(table)
 		}
+	case *Session, *Statement, *builder.Builder:
+		sqlStr, subArgs, err := subQuerySQL(tablename)
+		if err != nil {
+			statement.cond = statement.cond.And(errCond{err})
+			return statement
+		}
+		statement.useSubQuery = true
+		statement.joinArgs = append(statement.joinArgs, subArgs...)
+		fmt.Fprintf(&buf, "(%s)", sqlStr)
 	default:
-		fmt.Fprintf(&buf, statement.Engine.Quote(fmt.Sprintf("%v", tablename)))
+		fmt.Fprintf(&buf, statement.Engine.Quote(statement.tbNameWithSchema(fmt.Sprintf("%v", tablename))))
 	}
 
 	fmt.Fprintf(&buf, " ON %v", condition)
@@ -862,7 +1042,7 @@ func (statement *Statement) genIndexSQL() []string {
 	quote := statement.Engine.Quote
 	for idxName, index := range statement.RefTable.Indexes {
 		if index.Type == core.IndexType {
-			sql := fmt.Sprintf("CREATE INDEX %v ON %v (%v);", quote(indexName(tbName, idxName)),
+			sql := fmt.Sprintf("CREATE INDEX %v ON %v (%v);", quote(indexName(tableNameNoSchema(tbName), idxName)),
 				quote(tbName), quote(strings.Join(index.Cols, quote(","))))
 			sqls = append(sqls, sql)
 		}
@@ -892,9 +1072,13 @@ func (statement *Statement) genDelIndexSQL() []string {
 	for idxName, index := range statement.RefTable.Indexes {
 		var rIdxName string
 		if index.Type == core.UniqueType {
-			rIdxName = uniqueName(tbName, idxName)
+			rIdxName = uniqueName(tableNameNoSchema(tbName), idxName)
 		} else if index.Type == core.IndexType {
-			rIdxName = indexName(tbName, idxName)
+			rIdxName = indexName(tableNameNoSchema(tbName), idxName)
+		}
+		if idx := strings.LastIndex(tbName, "."); idx > 0 && !statement.Engine.dialect.IndexOnTable() {
+			// the index is in the schema of the table
+			rIdxName = tbName[:idx+1] + rIdxName
 		}
 		sql := fmt.Sprintf("DROP INDEX %v", statement.Engine.Quote(rIdxName))
 		if statement.Engine.dialect.IndexOnTable() {
@@ -993,7 +1177,7 @@ func (statement *Statement) genGetSQL(bean interface{}) (string, []interface{},
 		return "", nil, err
 	}
 
-	return sqlStr, append(statement.joinArgs, condArgs...), nil
+	return sqlStr, statement.selectArgs(condArgs), nil
 }
 
 func (statement *Statement) genCountSQL(beans ...interface{}) (string, []interface{}, error) {
@@ -1023,12 +1207,113 @@ func (statement *Statement) genCountSQL(beans ...interface{}) (string, []interfa
 		return "", nil, err
 	}
 
-	return sqlStr, append(statement.joinArgs, condArgs...), nil
+	return sqlStr, statement.selectArgs(condArgs), nil
 }
 
-func (statement *Statement) genSumSQL(bean interface{}, columns ...string) (string, []interface{}, error) {
-	statement.setRefValue(rValue(bean))
+// the alias of the select counted by FindAndCount and the column of the count
+// selected by the window function
+const (
+	countAlias      = "count_result"
+	countOverColumn = "xorm_count_over"
+)
+
+// genFindColumnStr returns the columns selected by Find
+func (statement *Statement) genFindColumnStr() string {
+	if len(statement.selectStr) > 0 {
+		return statement.selectStr
+	}
+
+	var columnStr = statement.ColumnStr
+	if columnStr == "" {
+		if statement.GroupByStr != "" {
+			columnStr = statement.Engine.Quote(strings.Replace(statement.GroupByStr, ",", statement.Engine.Quote(","), -1))
+		} else if statement.JoinStr == "" {
+			columnStr = statement.genColumnStr()
+		}
+	}
+	if columnStr == "" {
+		columnStr = "*"
+	}
+	return columnStr
+}
+
+// genCountOverColumnStr appends the count of all the rows found to the columns,
+// * is qualified by the table since it can't be followed by other columns on oracle
+func (statement *Statement) genCountOverColumnStr(columnStr string) string {
+	if columnStr == "*" {
+		var tableName = statement.TableName()
+		if len(statement.TableAlias) > 0 {
+			tableName = statement.TableAlias
+		}
+		columnStr = statement.Engine.Quote(tableName) + ".*"
+	}
+	return fmt.Sprintf("%s, count(*) OVER() AS %s", columnStr, statement.Engine.Quote(countOverColumn))
+}
+
+// genFindCountSQL generates the sql which counts the records found by Find
+// without the ordering and the pagination. The groups of GroupBy, the rows of
+// Distinct, the combined rows of the set operations and the rows of the raw sql
+// are counted by wrapping the select in a subquery.
+func (statement *Statement) genFindCountSQL(bean interface{}) (string, []interface{}, error) {
+	if statement.RawSQL != "" {
+		var outer = Statement{
+			Engine:     statement.Engine,
+			TableAlias: countAlias,
+			fromSQL:    statement.RawSQL,
+		}
+		sqlStr, err := outer.genSelectSQL("count(*)", "")
+		if err != nil {
+			return "", nil, err
+		}
+		return sqlStr, statement.RawParams, nil
+	}
 
+	var condSQL string
+	var condArgs []interface{}
+	var err error
+	if bean != nil {
+		statement.setRefValue(rValue(bean))
+		condSQL, condArgs, err = statement.genConds(bean)
+	} else {
+		condSQL, condArgs, err = builder.ToSQL(statement.cond)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	statement.OrderStr = ""
+	statement.Start = 0
+	statement.LimitN = 0
+	if statement.GroupByStr == "" && !statement.IsDistinct && len(statement.setOps) == 0 {
+		sqlStr, err := statement.genSelectSQL("count(*)", condSQL)
+		if err != nil {
+			return "", nil, err
+		}
+		return sqlStr, statement.selectArgs(condArgs), nil
+	}
+
+	var inner = *statement
+	inner.ctes = nil
+	innerSQL, err := inner.genSelectSQL(statement.genFindColumnStr(), condSQL)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var outer = Statement{
+		Engine:     statement.Engine,
+		RefTable:   statement.RefTable,
+		TableAlias: countAlias,
+		fromSQL:    innerSQL,
+		ctes:       statement.ctes,
+	}
+	sqlStr, err := outer.genSelectSQL("count(*)", "")
+	if err != nil {
+		return "", nil, err
+	}
+	return sqlStr, statement.selectArgs(condArgs), nil
+}
+
+func (statement *Statement) genSumSQL(bean interface{}, columns ...string) (string, []interface{}, error) {
 	var sumStrs = make([]string, 0, len(columns))
 	for _, colName := range columns {
 		if !strings.Contains(colName, " ") && !strings.Contains(colName, "(") {
@@ -1038,20 +1323,100 @@ func (statement *Statement) genSumSQL(bean interface{}, columns ...string) (stri
 	}
 	sumSelect := strings.Join(sumStrs, ", ")
 
-	condSQL, condArgs, err := statement.genConds(bean)
+	return statement.genAggSQL(bean, sumSelect)
+}
+
+// genAggSQL generates the select of the aggregates, bean's non-empty fields are
+// conditions. If bean is nil, the conditions of the table such as the deleted
+// column are used.
+func (statement *Statement) genAggSQL(bean interface{}, aggSelect string) (string, []interface{}, error) {
+	if bean != nil {
+		statement.setRefValue(rValue(bean))
+	} else if statement.RefTable != nil {
+		bean = reflect.New(statement.RefTable.Type).Interface()
+	}
+	if len(statement.TableName()) == 0 {
+		return "", nil, ErrTableNotFound
+	}
+
+	var condSQL string
+	var condArgs []interface{}
+	var err error
+	if bean != nil {
+		condSQL, condArgs, err = statement.genConds(bean)
+	} else {
+		condSQL, condArgs, err = builder.ToSQL(statement.cond)
+	}
 	if err != nil {
 		return "", nil, err
 	}
 
-	sqlStr, err := statement.genSelectSQL(sumSelect, condSQL)
+	sqlStr, err := statement.genSelectSQL(aggSelect, condSQL)
 	if err != nil {
 		return "", nil, err
 	}
 
-	return sqlStr, append(statement.joinArgs, condArgs...), nil
+	return sqlStr, statement.selectArgs(condArgs), nil
+}
+
+// quoteAggColumn quotes the column of an aggregate function unless it is *, an
+// expression or a column qualified by the table
+func (statement *Statement) quoteAggColumn(colName string) string {
+	if strings.ContainsAny(colName, " (*.") {
+		return colName
+	}
+	return statement.Engine.Quote(colName)
+}
+
+// genCountDistinctSQL generates the sql which counts the distinct values of the
+// columns, the distinct rows of several columns are counted by a subquery and
+// the rows with NULL are not counted like count(DISTINCT column)
+func (statement *Statement) genCountDistinctSQL(bean interface{}, columns ...string) (string, []interface{}, error) {
+	if len(columns) == 1 {
+		return statement.genAggSQL(bean, fmt.Sprintf("count(DISTINCT %s)", statement.quoteAggColumn(columns[0])))
+	}
+
+	for _, col := range columns {
+		statement.cond = statement.cond.And(builder.NotNull{statement.quoteAggColumn(col)})
+	}
+	statement.selectStr = ""
+	statement.Distinct(columns...)
+	return statement.genFindCountSQL(bean)
+}
+
+// genAggregateColumnStr returns the columns of the result struct selected by
+// Aggregate, the aggregates are selected as their columns
+func (statement *Statement) genAggregateColumnStr(table *core.Table, aggregates []*aggregate) string {
+	var aggs = make(map[string]*aggregate, len(aggregates))
+	for _, agg := range aggregates {
+		aggs[agg.column] = agg
+	}
+
+	var colNames = make([]string, 0, len(table.Columns()))
+	for _, col := range table.Columns() {
+		agg, ok := aggs[col.Name]
+		if !ok {
+			colNames = append(colNames, statement.Engine.Quote(col.Name))
+			continue
+		}
+
+		var expr string
+		switch agg.fn {
+		case "count_distinct":
+			expr = fmt.Sprintf("count(DISTINCT %s)", statement.quoteAggColumn(agg.arg))
+		default:
+			expr = fmt.Sprintf("%s(%s)", agg.fn, statement.quoteAggColumn(agg.arg))
+		}
+		colNames = append(colNames, expr+" AS "+statement.Engine.Quote(col.Name))
+	}
+	return strings.Join(colNames, ", ")
 }
 
 func (statement *Statement) genSelectSQL(columnStr, condSQL string) (a string, err error) {
+	if len(statement.setOps) > 0 {
+		return statement.genSetOpSQL(columnStr, condSQL)
+	}
+
 	var distinct string
 	if statement.IsDistinct && !strings.HasPrefix(columnStr, "count") {
 		distinct = "DISTINCT "
@@ -1073,7 +1438,9 @@ func (statement *Statement) genSelectSQL(columnStr, condSQL string) (a string, e
 	var whereStr = buf.String()
 	var fromStr = " FROM "
 
-	if dialect.DBType() == core.MSSQL && strings.Contains(statement.TableName(), "..") {
+	if statement.fromSQL != "" {
+		fromStr += "(" + statement.fromSQL + ")"
+	} else if dialect.DBType() == core.MSSQL && strings.Contains(statement.TableName(), "..") {
 		fromStr += statement.TableName()
 	} else {
 		fromStr += quote(statement.TableName())
@@ -1086,6 +1453,15 @@ func (statement *Statement) genSelectSQL(columnStr, condSQL string) (a string, e
 			fromStr += " AS " + quote(statement.TableAlias)
 		}
 	}
+
+	var lockClause string
+	if statement.IsForUpdate {
+		var tableHint string
+		if lockClause, tableHint, err = statement.genRowLock(); err != nil {
+			return "", err
+		}
+		fromStr += tableHint
+	}
 	if statement.JoinStr != "" {
 		fromStr = fmt.Sprintf("%v %v", fromStr, statement.JoinStr)
 	}
@@ -1157,11 +1533,18 @@ func (statement *Statement) genSelectSQL(columnStr, condSQL string) (a string, e
 		}
 	} else if dialect.DBType() == core.ORACLE {
 		if statement.Start != 0 || statement.LimitN != 0 {
-			a = fmt.Sprintf("SELECT %v FROM (SELECT %v,ROWNUM RN FROM (%v) at WHERE ROWNUM <= %d) aat WHERE RN > %d", columnStr, columnStr, a, statement.Start+statement.LimitN, statement.Start)
+			var innerColumns, outerColumns = columnStr, columnStr
+			if statement.countOver {
+				// the count of all the rows is selected from the paginated query
+				// instead of being computed again over the paginated rows
+				innerColumns, outerColumns = "at.*", "*"
+			}
+			a = fmt.Sprintf("SELECT %v FROM (SELECT %v,ROWNUM RN FROM (%v) at WHERE ROWNUM <= %d) aat WHERE RN > %d", outerColumns, innerColumns, a, statement.Start+statement.LimitN, statement.Start)
 		}
 	}
-	if statement.IsForUpdate {
-		a = dialect.ForUpdateSql(a)
+	a += lockClause
+	if with := statement.genWithSQL(); with != "" {
+		a = with + " " + a
 	}
 
 	return
@@ -0,0 +1,102 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"bytes"
+	"strings"
+)
+
+// rowLock is the mode of the row locking of a select, the rows are locked when
+// IsForUpdate of the statement is true
+type rowLock struct {
+	share      bool     // FOR SHARE instead of FOR UPDATE
+	noWait     bool     // fail instead of waiting for the locked rows
+	skipLocked bool     // skip the locked rows
+	tables     []string // the tables whose rows are locked by FOR UPDATE OF
+}
+
+// isPlain returns true if the rows are locked by the plain FOR UPDATE
+func (lock *rowLock) isPlain() bool {
+	return !lock.share && !lock.noWait && !lock.skipLocked && len(lock.tables) == 0
+}
+
+// clause returns the standard clause of the row locking, shareStr is the clause
+// of the shared lock
+func (lock *rowLock) clause(quote func(string) string, shareStr string) string {
+	var buf bytes.Buffer
+	if lock.share {
+		buf.WriteString(" " + shareStr)
+	} else {
+		buf.WriteString(" FOR UPDATE")
+	}
+	if len(lock.tables) > 0 {
+		var tables = make([]string, 0, len(lock.tables))
+		for _, table := range lock.tables {
+			tables = append(tables, quote(table))
+		}
+		buf.WriteString(" OF " + strings.Join(tables, ", "))
+	}
+	if lock.noWait {
+		buf.WriteString(" NOWAIT")
+	} else if lock.skipLocked {
+		buf.WriteString(" SKIP LOCKED")
+	}
+	return buf.String()
+}
+
+// rowLockDialect is implemented by the dialects which render the modes of the
+// row locking, the lock is a clause appended to the select or a hint of the
+// table, ErrLockNotSupported is returned if the mode could not be honoured
+type rowLockDialect interface {
+	RowLockSql(lock *rowLock) (clause, tableHint string, err error)
+}
+
+// genRowLock returns the clause appended to the select and the hint of the
+// table of the row locking
+func (statement *Statement) genRowLock() (clause, tableHint string, err error) {
+	if dialect, ok := statement.Engine.dialect.(rowLockDialect); ok {
+		return dialect.RowLockSql(&statement.lock)
+	}
+	if !statement.lock.isPlain() {
+		return "", "", ErrLockNotSupported
+	}
+	// the plain FOR UPDATE is appended by the dialect
+	return statement.Engine.dialect.ForUpdateSql(""), "", nil
+}
+
+// ForShare generates "SELECT ... FOR SHARE" statement
+func (statement *Statement) ForShare() *Statement {
+	statement.IsForUpdate = true
+	statement.lock.share = true
+	return statement
+}
+
+// ForUpdateOf generates "SELECT ... FOR UPDATE OF tables" statement, only the
+// rows of the tables are locked
+func (statement *Statement) ForUpdateOf(tables ...string) *Statement {
+	statement.IsForUpdate = true
+	statement.lock.share = false
+	statement.lock.tables = append(statement.lock.tables, tables...)
+	return statement
+}
+
+// NoWait makes the row locking fail instead of waiting for the locked rows, the
+// rows are locked by FOR UPDATE if no locking is set
+func (statement *Statement) NoWait() *Statement {
+	statement.IsForUpdate = true
+	statement.lock.noWait = true
+	statement.lock.skipLocked = false
+	return statement
+}
+
+// SkipLocked makes the row locking skip the locked rows, the rows are locked by
+// FOR UPDATE if no locking is set
+func (statement *Statement) SkipLocked() *Statement {
+	statement.IsForUpdate = true
+	statement.lock.skipLocked = true
+	statement.lock.noWait = false
+	return statement
+}
@@ -0,0 +1,277 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-xorm/builder"
+	"github.com/go-xorm/core"
+)
+
+// errCond is a condition which fails to be written, it's used to return the
+// error of a subquery when the statement is built
+type errCond struct {
+	err error
+}
+
+var _ builder.Cond = errCond{}
+
+func (c errCond) WriteTo(w builder.Writer) error {
+	return c.err
+}
+
+func (c errCond) And(conds ...builder.Cond) builder.Cond {
+	return builder.And(c, builder.And(conds...))
+}
+
+func (c errCond) Or(conds ...builder.Cond) builder.Cond {
+	return builder.Or(c, builder.Or(conds...))
+}
+
+func (c errCond) IsValid() bool {
+	return true
+}
+
+// isSubQuery returns true if the argument is a subquery, which could be a
+// *Session, a *Statement or a *builder.Builder
+func isSubQuery(arg interface{}) bool {
+	switch arg.(type) {
+	case *Session, *Statement, *builder.Builder:
+		return true
+	}
+	return false
+}
+
+// subQuerySQL returns the sql and the arguments of the subquery
+func subQuerySQL(sub interface{}) (string, []interface{}, error) {
+	switch t := sub.(type) {
+	case *Session:
+		return t.statement.genSubQuerySQL()
+	case *Statement:
+		return t.genSubQuerySQL()
+	case *builder.Builder:
+		return t.ToSQL()
+	}
+	return "", nil, fmt.Errorf("unsupported subquery type %T", sub)
+}
+
+// genSubQuerySQL generates the select sql of the statement which is used as a
+// subquery, the conditions of the table such as the deleted column are included
+// and the statement is kept so that it could be used again
+func (statement *Statement) genSubQuerySQL() (string, []interface{}, error) {
+	if statement.RawSQL != "" {
+		return statement.RawSQL, statement.RawParams, nil
+	}
+	if len(statement.TableName()) == 0 && statement.fromSQL == "" {
+		return "", nil, ErrTableNotFound
+	}
+
+	var columnStr = statement.ColumnStr
+	if len(statement.selectStr) > 0 {
+		columnStr = statement.selectStr
+	}
+	if len(columnStr) == 0 {
+		columnStr = "*"
+	}
+
+	var cond = statement.cond
+	defer func() {
+		statement.cond = cond
+	}()
+	if statement.RefTable != nil {
+		if err := statement.mergeConds(reflect.New(statement.RefTable.Type).Interface()); err != nil {
+			return "", nil, err
+		}
+	}
+	condSQL, condArgs, err := builder.ToSQL(statement.cond)
+	if err != nil {
+		return "", nil, err
+	}
+
+	sqlStr, err := statement.genSelectSQL(columnStr, condSQL)
+	if err != nil {
+		return "", nil, err
+	}
+	return sqlStr, statement.selectArgs(condArgs), nil
+}
+
+// selectArgs returns the arguments of the sql generated by genSelectSQL
+func (statement *Statement) selectArgs(condArgs []interface{}) []interface{} {
+	var args []interface{}
+	for _, cte := range statement.ctes {
+		args = append(args, cte.args...)
+	}
+	var n = len(args)
+	if len(statement.setOps) > 0 {
+		args = append(args, statement.setOpArgs(condArgs)...)
+	} else {
+		args = append(args, statement.fromArgs...)
+		args = append(args, statement.joinArgs...)
+		args = append(args, condArgs...)
+	}
+
+	// the from and where clauses are repeated by the pagination of mssql
+	if statement.Engine.dialect.DBType() == core.MSSQL && statement.Start > 0 {
+		args = append(args, args[n:]...)
+	}
+	return args
+}
+
+// expandSubQueries replaces the placeholders of the subqueries in the query by
+// their sql, the parentheses are added if the placeholder is not in them
+func expandSubQueries(query string, args []interface{}) (string, []interface{}, error) {
+	var buf bytes.Buffer
+	var newArgs = make([]interface{}, 0, len(args))
+	var idx int
+	for i := 0; i < len(query); i++ {
+		if query[i] != '?' || idx >= len(args) {
+			buf.WriteByte(query[i])
+			continue
+		}
+
+		arg := args[idx]
+		idx++
+		if !isSubQuery(arg) {
+			buf.WriteByte('?')
+			newArgs = append(newArgs, arg)
+			continue
+		}
+
+		sqlStr, subArgs, err := subQuerySQL(arg)
+		if err != nil {
+			return "", nil, err
+		}
+		if strings.HasSuffix(strings.TrimSpace(query[:i]), "(") &&
+			strings.HasPrefix(strings.TrimSpace(query[i+1:]), ")") {
+			buf.WriteString(sqlStr)
+		} else {
+			fmt.Fprintf(&buf, "(%s)", sqlStr)
+		}
+		newArgs = append(newArgs, subArgs...)
+	}
+	return buf.String(), append(newArgs, args[idx:]...), nil
+}
+
+// expr returns the condition of the query, the arguments could be subqueries
+func (statement *Statement) expr(query string, args ...interface{}) builder.Cond {
+	var hasSubQuery bool
+	for _, arg := range args {
+		if isSubQuery(arg) {
+			hasSubQuery = true
+			break
+		}
+	}
+	if !hasSubQuery {
+		return builder.Expr(query, args...)
+	}
+
+	statement.useSubQuery = true
+	sqlStr, newArgs, err := expandSubQueries(query, args)
+	if err != nil {
+		return errCond{err}
+	}
+	return builder.Expr(sqlStr, newArgs...)
+}
+
+// Exists generates "EXISTS (subquery)" statement
+func (statement *Statement) Exists(sub interface{}) *Statement {
+	statement.cond = statement.cond.And(statement.expr("EXISTS ?", sub))
+	return statement
+}
+
+// NotExists generates "NOT EXISTS (subquery)" statement
+func (statement *Statement) NotExists(sub interface{}) *Statement {
+	statement.cond = statement.cond.And(statement.expr("NOT EXISTS ?", sub))
+	return statement
+}
+
+// From selects from the subquery with the alias instead of the table
+func (statement *Statement) From(sub interface{}, alias string) *Statement {
+	sqlStr, args, err := subQuerySQL(sub)
+	if err != nil {
+		statement.cond = statement.cond.And(errCond{err})
+		return statement
+	}
+	statement.useSubQuery = true
+	statement.fromSQL = sqlStr
+	statement.fromArgs = args
+	statement.TableAlias = alias
+	return statement
+}
+
+// commonTableExpr is a common table expression prepended to the select sql
+type commonTableExpr struct {
+	name      string
+	sql       string
+	args      []interface{}
+	recursive bool
+}
+
+// addCTE adds the common table expression of the subqueries, they are joined by
+// UNION ALL for a recursive one
+func (statement *Statement) addCTE(name string, recursive bool, subs ...interface{}) *Statement {
+	var cte = commonTableExpr{name: name, recursive: recursive}
+	var sqls = make([]string, 0, len(subs))
+	for _, sub := range subs {
+		sqlStr, args, err := subQuerySQL(sub)
+		if err != nil {
+			statement.cond = statement.cond.And(errCond{err})
+			return statement
+		}
+		sqls = append(sqls, sqlStr)
+		cte.args = append(cte.args, args...)
+	}
+	cte.sql = strings.Join(sqls, " UNION ALL ")
+
+	// the results depend on the tables of the expressions, so they are not cached
+	statement.useSubQuery = true
+	statement.ctes = append(statement.ctes, cte)
+	return statement
+}
+
+// With adds the subquery as a common table expression named name
+func (statement *Statement) With(name string, sub interface{}) *Statement {
+	return statement.addCTE(name, false, sub)
+}
+
+// WithRecursive adds a recursive common table expression named name, which is
+// the anchor subquery UNION ALL the recursive subquery referencing name
+func (statement *Statement) WithRecursive(name string, anchor, recursive interface{}) *Statement {
+	return statement.addCTE(name, true, anchor, recursive)
+}
+
+// genWithSQL returns the WITH clause of the common table expressions
+func (statement *Statement) genWithSQL() string {
+	if len(statement.ctes) == 0 {
+		return ""
+	}
+
+	var recursive bool
+	var exprs = make([]string, 0, len(statement.ctes))
+	for _, cte := range statement.ctes {
+		recursive = recursive || cte.recursive
+		name := cte.name
+		if !strings.Contains(name, "(") {
+			// a name with the column list is kept as it is
+			name = statement.Engine.Quote(name)
+		}
+		exprs = append(exprs, fmt.Sprintf("%s AS (%s)", name, cte.sql))
+	}
+
+	var with = "WITH "
+	switch statement.Engine.dialect.DBType() {
+	case core.MSSQL, core.ORACLE:
+		// the recursive expressions are detected without the keyword
+	default:
+		if recursive {
+			with = "WITH RECURSIVE "
+		}
+	}
+	return with + strings.Join(exprs, ", ")
+}
@@ -0,0 +1,188 @@
+// Copyright 2017 The Xorm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xorm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-xorm/core"
+)
+
+// the alias of the combined result of the set operations
+const setOpAlias = "set_result"
+
+// setOperation is a select combined with the statement by UNION, UNION ALL,
+// INTERSECT or EXCEPT
+type setOperation struct {
+	op   string
+	sql  string
+	args []interface{}
+}
+
+func (statement *Statement) addSetOp(op string, other *Session) *Statement {
+	columnStr, err := other.statement.setOpColumnStr()
+	if err != nil {
+		statement.cond = statement.cond.And(errCond{err})
+		return statement
+	}
+	other.statement.ColumnStr = columnStr
+
+	sqlStr, args, err := other.statement.genSubQuerySQL()
+	if err != nil {
+		statement.cond = statement.cond.And(errCond{err})
+		return statement
+	}
+
+	// the results depend on the tables of the other selects, so they are not cached
+	statement.useSubQuery = true
+	statement.setOps = append(statement.setOps, setOperation{op, sqlStr, args})
+	return statement
+}
+
+// Union combines the statement with the select of the other session by UNION
+func (statement *Statement) Union(other *Session) *Statement {
+	return statement.addSetOp("UNION", other)
+}
+
+// UnionAll combines the statement with the select of the other session by UNION ALL
+func (statement *Statement) UnionAll(other *Session) *Statement {
+	return statement.addSetOp("UNION ALL", other)
+}
+
+// Intersect combines the statement with the select of the other session by INTERSECT
+func (statement *Statement) Intersect(other *Session) *Statement {
+	return statement.addSetOp("INTERSECT", other)
+}
+
+// Except combines the statement with the select of the other session by EXCEPT,
+// which is MINUS on oracle
+func (statement *Statement) Except(other *Session) *Statement {
+	return statement.addSetOp("EXCEPT", other)
+}
+
+// the column of a select, which is an optionally quoted and qualified name
+// with an optional alias
+var setOpColumnRegexp = regexp.MustCompile(`(?i)^(?:[^\s.,()]+\.)*([^\s.,()]+)(?:\s+(?:AS\s+)?([^\s.,()]+))?$`)
+
+// setOpColumnStr returns the columns of Cols in the order of the columns of the
+// table, since Cols keeps the columns in a map but the combined selects should
+// have the same columns in the same order
+func (statement *Statement) setOpColumnStr() (string, error) {
+	if len(statement.columnMap) < 2 {
+		return statement.ColumnStr, nil
+	}
+
+	var errUnordered = errors.New("the order of the columns of Cols is unknown, Select should be used with the set operations")
+	if statement.RefTable == nil {
+		return "", errUnordered
+	}
+	var cols = make([]string, 0, len(statement.columnMap))
+	for _, col := range statement.RefTable.Columns() {
+		if statement.columnMap[strings.ToLower(col.Name)] {
+			cols = append(cols, statement.Engine.Quote(col.Name))
+		}
+	}
+	if len(cols) != len(statement.columnMap) {
+		// some of the columns are qualified or not in the table
+		return "", errUnordered
+	}
+	return strings.Join(cols, ", "), nil
+}
+
+// setOpColumns returns the columns selected from the combined result, they are
+// the names of the columns of the branches, or * if any of them is an expression
+// without an alias
+func setOpColumns(columnStr string) string {
+	var cols = strings.Split(columnStr, ",")
+	for i, col := range cols {
+		matches := setOpColumnRegexp.FindStringSubmatch(strings.TrimSpace(col))
+		if matches == nil || matches[1] == "*" {
+			return "*"
+		}
+		if matches[2] != "" {
+			cols[i] = matches[2]
+		} else {
+			cols[i] = matches[1]
+		}
+	}
+	return strings.Join(cols, ", ")
+}
+
+// genSetOpSQL generates the select of the combined result of the set operations,
+// the statement without the ordering and the pagination is the first branch and
+// every branch is wrapped so that it could have its own ordering and pagination.
+// The ordering and the pagination of the statement are applied to the combined
+// result by the select of the dialect.
+func (statement *Statement) genSetOpSQL(columnStr, condSQL string) (string, error) {
+	if columnStr == statement.ColumnStr && len(statement.selectStr) == 0 {
+		var err error
+		if columnStr, err = statement.setOpColumnStr(); err != nil {
+			return "", err
+		}
+	}
+
+	var branchColumns, outerColumns = columnStr, setOpColumns(columnStr)
+	if strings.HasPrefix(columnStr, "count") {
+		// count the rows of the combined result
+		branchColumns = "*"
+		if statement.RefTable != nil {
+			branchColumns = statement.genColumnStr()
+		}
+		outerColumns = columnStr
+	}
+
+	var branch = *statement
+	branch.setOps = nil
+	branch.ctes = nil
+	branch.OrderStr = ""
+	branch.Start = 0
+	branch.LimitN = 0
+	branch.IsForUpdate = false
+	branchSQL, err := branch.genSelectSQL(branchColumns, condSQL)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	var quote = statement.Engine.Quote
+	fmt.Fprintf(&buf, "SELECT * FROM (%s) %s", branchSQL, quote("b0"))
+	for i, setOp := range statement.setOps {
+		var op = setOp.op
+		if op == "EXCEPT" && statement.Engine.dialect.DBType() == core.ORACLE {
+			op = "MINUS"
+		}
+		fmt.Fprintf(&buf, " %s SELECT * FROM (%s) %s", op, setOp.sql, quote(fmt.Sprintf("b%d", i+1)))
+	}
+
+	var outer = Statement{
+		Engine:      statement.Engine,
+		RefTable:    statement.RefTable,
+		Start:       statement.Start,
+		LimitN:      statement.LimitN,
+		OrderStr:    statement.OrderStr,
+		IsForUpdate: statement.IsForUpdate,
+		lock:        statement.lock,
+		TableAlias:  setOpAlias,
+		fromSQL:     buf.String(),
+		ctes:        statement.ctes,
+	}
+	return outer.genSelectSQL(outerColumns, "")
+}
+
+// setOpArgs returns the arguments of the combined result of the set operations
+func (statement *Statement) setOpArgs(condArgs []interface{}) []interface{} {
+	var args = make([]interface{}, 0, len(statement.fromArgs)+len(statement.joinArgs)+len(condArgs))
+	args = append(args, statement.fromArgs...)
+	args = append(args, statement.joinArgs...)
+	args = append(args, condArgs...)
+	for _, setOp := range statement.setOps {
+		args = append(args, setOp.args...)
+	}
+	return args
+}
@@ -28,6 +28,8 @@ type tagContext struct {
 	hasCacheTag     bool
 	hasNoCacheTag   bool
 	ignoreNext      bool
+	relation        *relation
+	aggregate       *aggregate
 }
 
 // tagHandler describes tag handler for XORM
@@ -55,6 +57,10 @@ var (
 		"CACHE":    CacheTagHandler,
 		"NOCACHE":  NoCacheTagHandler,
 		"COMMENT":  CommentTagHandler,
+
+		"HAS_MANY":     HasManyTagHandler,
+		"MANY_TO_MANY": ManyToManyTagHandler,
+		"AGG":          AggTagHandler,
 	}
 )
 
@@ -241,6 +247,75 @@ func SQLTypeTagHandler(ctx *tagContext) error {
 	return nil
 }
 
+// HasManyTagHandler describes has_many tag handler, e.g. has_many(user_id), the
+// field is a slice of the children whose column references the primary key
+func HasManyTagHandler(ctx *tagContext) error {
+	if len(ctx.params) != 1 {
+		return fmt.Errorf("field %s tag has_many needs the column of the children", ctx.col.FieldName)
+	}
+	return newRelation(ctx, hasManyRelation)
+}
+
+// ManyToManyTagHandler describes many_to_many tag handler, e.g.
+// many_to_many(user_role,user_id,role_id), the parameters are the join table,
+// its column referencing the primary key and its column referencing the children
+func ManyToManyTagHandler(ctx *tagContext) error {
+	if len(ctx.params) != 3 {
+		return fmt.Errorf("field %s tag many_to_many needs the join table and its two columns", ctx.col.FieldName)
+	}
+	return newRelation(ctx, manyToManyRelation)
+}
+
+// AggTagHandler describes agg tag handler, e.g. agg(sum,amount), the field of the
+// result struct of Aggregate is the aggregate function of the column
+func AggTagHandler(ctx *tagContext) error {
+	if len(ctx.params) != 2 {
+		return fmt.Errorf("field %s tag agg needs the function and the column", ctx.col.FieldName)
+	}
+	var fn = strings.ToLower(strings.TrimSpace(ctx.params[0]))
+	if !aggFuncs[fn] {
+		return fmt.Errorf("field %s tag agg has unsupported function %s", ctx.col.FieldName, ctx.params[0])
+	}
+	ctx.aggregate = &aggregate{
+		fn:  fn,
+		arg: strings.TrimSpace(ctx.params[1]),
+	}
+	// the aggregate is only read from the database
+	ctx.col.MapType = core.ONLYFROMDB
+	return nil
+}
+
+// newRelation sets the relation of the field described by the tag
+func newRelation(ctx *tagContext, kind relationKind) error {
+	var t = ctx.fieldValue.Type()
+	if t.Kind() != reflect.Slice {
+		return fmt.Errorf("field %s of relation should be a slice", ctx.col.FieldName)
+	}
+	var rel = relation{
+		kind:      kind,
+		fieldName: ctx.col.FieldName,
+		elemType:  t.Elem(),
+	}
+	if rel.elemType.Kind() == reflect.Ptr {
+		rel.elemType = rel.elemType.Elem()
+		rel.isPtrElem = true
+	}
+	if rel.elemType.Kind() != reflect.Struct {
+		return fmt.Errorf("field %s of relation should be a slice of structs", ctx.col.FieldName)
+	}
+
+	for i := range ctx.params {
+		ctx.params[i] = strings.TrimSpace(ctx.params[i])
+	}
+	if kind == hasManyRelation {
+		rel.foreignKey = ctx.params[0]
+	} else {
+		rel.joinTable, rel.foreignKey, rel.otherKey = ctx.params[0], ctx.params[1], ctx.params[2]
+	}
+	ctx.relation = &rel
+	return nil
+}
+
 // ExtendsTagHandler describes extends tag handler
 func ExtendsTagHandler(ctx *tagContext) error {
 	var fieldValue = ctx.fieldValue